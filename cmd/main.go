@@ -1,42 +1,97 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"io"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/0xagentlabs/mini-agent-gateway/pkg/channel"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
 	"github.com/0xagentlabs/mini-agent-gateway/pkg/gateway"
 )
 
+// defaultShutdownTimeout 默认等待进行中请求完成的时间
+const defaultShutdownTimeout = 30 * time.Second
+
 func main() {
 	// 加载环境变量
 	if err := godotenv.Load(); err != nil {
 		log.Println("未找到 .env 文件，使用环境变量")
 	}
 
-	// 创建网关
+	if len(os.Args) > 1 && os.Args[1] == "chat" {
+		runChat(os.Args[2:])
+		return
+	}
+
+	runServer()
+}
+
+// runChat 终端对话模式：只启用 CLI 频道，便于本地调试技能
+func runChat(args []string) {
+	fs := flag.NewFlagSet("chat", flag.ExitOnError)
+	verbose := fs.Bool("v", false, "输出网关日志")
+	fs.Parse(args)
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
 	gw := gateway.New()
+	cli := channel.NewCLIAdapter(gw)
+	gw.RegisterChannel(cli)
+
+	gw.Start()
 
-	// 创建 Telegram 频道适配器
-	telegramToken := os.Getenv("TELEGRAM_BOT_TOKEN")
-	if telegramToken == "" {
-		log.Fatal("请设置 TELEGRAM_BOT_TOKEN 环境变量")
+	if err := cli.Start(); err != nil {
+		log.Printf("终端对话异常退出: %v", err)
 	}
 
-	telegramAdapter := channel.NewTelegramAdapter(telegramToken, gw)
-	
-	// 启动 Telegram 接收消息
-	go func() {
-		if err := telegramAdapter.Start(); err != nil {
-			log.Fatalf("Telegram 启动失败: %v", err)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultShutdownTimeout)
+	defer cancel()
+	gw.Shutdown(ctx)
+}
+
+// runServer 服务模式：启动配置中声明的所有频道
+func runServer() {
+	// 加载频道配置
+	cfg, err := config.Load(getEnv("CONFIG_FILE", "config.yaml"))
+	if err != nil {
+		log.Fatalf("加载配置失败: %v", err)
+	}
+
+	// 创建网关
+	gw := gateway.New()
+	gw.Configure(cfg)
+
+	// 创建并注册配置中声明的频道适配器
+	for _, cc := range cfg.Channels {
+		if cc.Disabled {
+			continue
 		}
-	}()
+		ch, err := channel.New(cc, gw)
+		if err != nil {
+			log.Printf("跳过频道: %v", err)
+			continue
+		}
+		gw.RegisterChannel(ch)
+		log.Printf("已注册频道: %s (%s)", cc.Name, cc.Type)
+	}
+	if len(cfg.Channels) == 0 {
+		log.Println("⚠️  未配置任何频道，请设置 TELEGRAM_BOT_TOKEN 或编写 config.yaml")
+	}
 
 	// 启动网关处理消息
-	go gw.Start()
+	gw.Start()
+
+	// 启动频道（各自独立监管）
+	gw.StartChannels()
 
 	log.Println("🚀 Mini Agent Gateway 已启动")
 	log.Println("按 Ctrl+C 停止服务")
@@ -46,6 +101,30 @@ func main() {
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
 	<-sig
 
-	log.Println("正在关闭服务...")
-	telegramAdapter.Stop()
+	timeout := cfg.Gateway.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	log.Printf("正在关闭服务，最多等待 %s...（再次按 Ctrl+C 强制退出）", timeout)
+
+	go func() {
+		<-sig
+		log.Println("强制退出")
+		os.Exit(1)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := gw.Shutdown(ctx); err != nil {
+		log.Printf("关闭超时，部分请求已被中断: %v", err)
+	}
+	log.Println("服务已停止")
+}
+
+// getEnv 获取环境变量，如果不存在返回默认值
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
 }
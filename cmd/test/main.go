@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -25,7 +26,7 @@ func main() {
 
 	// 2. 测试工具执行
 	fmt.Println("\n✓ Tool Execution Test:")
-	result, err := toolReg.Execute("exec_shell", `{"command": "echo 'Hello from Mini Agent Gateway!'"}`)
+	result, err := toolReg.Execute(context.Background(), "exec_shell", `{"command": "echo 'Hello from Mini Agent Gateway!'"}`)
 	if err != nil {
 		fmt.Printf("  ❌ Error: %v\n", err)
 	} else {
@@ -34,14 +35,14 @@ func main() {
 
 	// 3. 测试文件读写
 	fmt.Println("\n✓ File I/O Test:")
-	writeResult, err := toolReg.Execute("write_file", `{"path": "/tmp/test.txt", "content": "Test content from Mini Agent Gateway"}`)
+	writeResult, err := toolReg.Execute(context.Background(), "write_file", `{"path": "/tmp/test.txt", "content": "Test content from Mini Agent Gateway"}`)
 	if err != nil {
 		fmt.Printf("  ❌ Write error: %v\n", err)
 	} else {
 		fmt.Printf("  ✓ Write: %s\n", writeResult)
 	}
 	
-	readResult, err := toolReg.Execute("read_file", `{"path": "/tmp/test.txt"}`)
+	readResult, err := toolReg.Execute(context.Background(), "read_file", `{"path": "/tmp/test.txt"}`)
 	if err != nil {
 		fmt.Printf("  ❌ Read error: %v\n", err)
 	} else {
@@ -7,3 +7,5 @@ require (
 	github.com/joho/godotenv v1.5.1
 	gopkg.in/yaml.v3 v3.0.1
 )
+
+require github.com/gorilla/websocket v1.5.3
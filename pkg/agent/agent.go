@@ -1,20 +1,27 @@
 package agent
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/0xagentlabs/mini-agent-gateway/pkg/skill"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/skills"
 	"github.com/0xagentlabs/mini-agent-gateway/pkg/tools"
 )
 
+// maxToolRounds 单次 Run 中最多的工具调用轮数，超过后要求模型直接回复
+const maxToolRounds = 10
+
 // LLMClient 轻量级 OpenAI 兼容客户端
 type LLMClient struct {
 	baseURL    string
@@ -43,17 +50,58 @@ type ChatCompletionRequest struct {
 	Model    string                   `json:"model"`
 	Messages []Message                `json:"messages"`
 	Tools    []map[string]interface{} `json:"tools,omitempty"`
+	Stream   bool                     `json:"stream,omitempty"`
+	User     string                   `json:"user,omitempty"`
 }
 
 // ChatCompletionResponse OpenAI 聊天完成响应
 type ChatCompletionResponse struct {
-	Choices []struct {
-		Message struct {
-			Role      string     `json:"role"`
-			Content   string     `json:"content"`
-			ToolCalls []ToolCall `json:"tool_calls,omitempty"`
-		} `json:"message"`
-	} `json:"choices"`
+	ID      string   `json:"id,omitempty"`
+	Object  string   `json:"object,omitempty"`
+	Created int64    `json:"created,omitempty"`
+	Model   string   `json:"model,omitempty"`
+	Choices []Choice `json:"choices"`
+}
+
+// Choice 聊天完成候选
+type Choice struct {
+	Index        int     `json:"index"`
+	Message      Message `json:"message"`
+	FinishReason string  `json:"finish_reason,omitempty"`
+}
+
+// ChatCompletionChunk 流式响应片段（stream: true）
+type ChatCompletionChunk struct {
+	ID      string        `json:"id,omitempty"`
+	Object  string        `json:"object,omitempty"`
+	Created int64         `json:"created,omitempty"`
+	Model   string        `json:"model,omitempty"`
+	Choices []ChunkChoice `json:"choices"`
+}
+
+// ChunkChoice 流式候选
+type ChunkChoice struct {
+	Index        int     `json:"index"`
+	Delta        Delta   `json:"delta"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+// Delta 流式增量内容
+type Delta struct {
+	Role      string          `json:"role,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	ToolCalls []ToolCallDelta `json:"tool_calls,omitempty"`
+}
+
+// ToolCallDelta 流式工具调用增量，按 Index 拼接
+type ToolCallDelta struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments,omitempty"`
+	} `json:"function"`
 }
 
 // ToolCall 工具调用
@@ -68,18 +116,213 @@ type ToolCall struct {
 
 // Message 对话消息
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+
+	// Parts 多模态内容，非空时替代 Content 序列化为内容数组
+	Parts []ContentPart `json:"-"`
+}
+
+// ContentPart 多模态消息内容片段
+type ContentPart struct {
+	Type     string    `json:"type"` // text / image_url
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL 图片地址，支持 data URL
+type ImageURL struct {
+	URL string `json:"url"`
+}
+
+// TextPart 文本内容片段
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: "text", Text: text}
+}
+
+// ImagePart 以 data URL 内联的图片内容片段
+func ImagePart(mimeType string, data []byte) ContentPart {
+	url := "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+	return ContentPart{Type: "image_url", ImageURL: &ImageURL{URL: url}}
+}
+
+// MarshalJSON 有多模态内容时将 content 输出为数组
+func (m Message) MarshalJSON() ([]byte, error) {
+	type plain Message
+	if len(m.Parts) == 0 {
+		return json.Marshal(plain(m))
+	}
+	return json.Marshal(struct {
+		plain
+		Content []ContentPart `json:"content"`
+	}{plain(m), m.Parts})
+}
+
+// UnmarshalJSON 兼容字符串与数组两种 content 格式
+//
+// 数组格式的文本片段会合并到 Content，完整内容保留在 Parts 中。
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type plain Message
+	var raw struct {
+		plain
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = Message(raw.plain)
+
+	content := bytes.TrimSpace(raw.Content)
+	if len(content) == 0 || string(content) == "null" {
+		return nil
+	}
+	if content[0] != '[' {
+		return json.Unmarshal(content, &m.Content)
+	}
+
+	if err := json.Unmarshal(content, &m.Parts); err != nil {
+		return err
+	}
+	var texts []string
+	for _, p := range m.Parts {
+		if p.Type == "text" {
+			texts = append(texts, p.Text)
+		}
+	}
+	m.Content = strings.Join(texts, "\n")
+	return nil
+}
+
+// Model 客户端使用的模型名
+func (c *LLMClient) Model() string {
+	return c.model
+}
+
+// WithModel 返回使用指定模型、其余配置相同的客户端
+func (c *LLMClient) WithModel(model string) *LLMClient {
+	clone := *c
+	clone.model = model
+	return &clone
+}
+
+// WithEndpoint 返回使用指定 API 地址和密钥、其余配置相同的客户端，空值沿用原配置
+func (c *LLMClient) WithEndpoint(baseURL, apiKey string) *LLMClient {
+	clone := *c
+	if baseURL != "" {
+		clone.baseURL = baseURL
+	}
+	if apiKey != "" {
+		clone.apiKey = apiKey
+	}
+	return &clone
 }
 
 // Chat 发送聊天请求
 func (c *LLMClient) Chat(ctx context.Context, messages []Message, tools []map[string]interface{}) (*ChatCompletionResponse, error) {
-	reqBody := ChatCompletionRequest{
+	resp, err := c.do(ctx, ChatCompletionRequest{
 		Model:    c.model,
 		Messages: messages,
 		Tools:    tools,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result ChatCompletionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
 	}
 
+	return &result, nil
+}
+
+// ChatStream 以流式方式发送聊天请求
+//
+// 每收到一段文本增量调用一次 onDelta，结束后返回拼接完整的响应
+// （包括按 index 拼接好的工具调用），便于与 Chat 共用后续处理逻辑。
+func (c *LLMClient) ChatStream(ctx context.Context, messages []Message, tools []map[string]interface{}, onDelta func(string)) (*ChatCompletionResponse, error) {
+	resp, err := c.do(ctx, ChatCompletionRequest{
+		Model:    c.model,
+		Messages: messages,
+		Tools:    tools,
+		Stream:   true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var (
+		content   strings.Builder
+		toolCalls []ToolCall
+		finish    string
+	)
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("read stream: %w", err)
+		}
+
+		line = strings.TrimSpace(line)
+		if data, ok := strings.CutPrefix(line, "data:"); ok {
+			data = strings.TrimSpace(data)
+			if data == "[DONE]" {
+				break
+			}
+
+			var chunk ChatCompletionChunk
+			if jerr := json.Unmarshal([]byte(data), &chunk); jerr != nil {
+				return nil, fmt.Errorf("decode chunk: %w", jerr)
+			}
+			for _, ch := range chunk.Choices {
+				if ch.Delta.Content != "" {
+					content.WriteString(ch.Delta.Content)
+					if onDelta != nil {
+						onDelta(ch.Delta.Content)
+					}
+				}
+				for _, d := range ch.Delta.ToolCalls {
+					for len(toolCalls) <= d.Index {
+						toolCalls = append(toolCalls, ToolCall{Type: "function"})
+					}
+					tc := &toolCalls[d.Index]
+					if d.ID != "" {
+						tc.ID = d.ID
+					}
+					tc.Function.Name += d.Function.Name
+					tc.Function.Arguments += d.Function.Arguments
+				}
+				if ch.FinishReason != nil {
+					finish = *ch.FinishReason
+				}
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return &ChatCompletionResponse{
+		Model: c.model,
+		Choices: []Choice{{
+			Message: Message{
+				Role:      "assistant",
+				Content:   content.String(),
+				ToolCalls: toolCalls,
+			},
+			FinishReason: finish,
+		}},
+	}, nil
+}
+
+// do 发送请求并检查状态码，调用方负责关闭响应体
+func (c *LLMClient) do(ctx context.Context, reqBody ChatCompletionRequest) (*http.Response, error) {
 	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
@@ -98,19 +341,83 @@ func (c *LLMClient) Chat(ctx context.Context, messages []Message, tools []map[st
 	if err != nil {
 		return nil, fmt.Errorf("do request: %w", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
 		body, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
 	}
+	return resp, nil
+}
 
-	var result ChatCompletionResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
-	}
+// EventType Agent 运行事件类型
+type EventType string
+
+const (
+	// EventDelta 回复文本增量
+	EventDelta EventType = "delta"
+	// EventToolStarted 开始执行工具
+	EventToolStarted EventType = "tool_started"
+	// EventToolFinished 工具执行结束
+	EventToolFinished EventType = "tool_finished"
+	// EventError 运行失败
+	EventError EventType = "error"
+	// EventFile 工具要求随回复发送文件
+	EventFile EventType = "file"
+)
 
-	return &result, nil
+// Event Agent 运行过程中的事件
+type Event struct {
+	Type  EventType
+	Delta string // EventDelta: 文本增量
+
+	ToolCallID string // EventToolStarted / EventToolFinished
+	ToolName   string
+	ToolArgs   string
+	ToolResult string
+
+	Error string // EventToolFinished / EventError: 错误信息
+
+	FilePath string // EventFile: 待发送的文件路径
+}
+
+// RunOptions 单次运行选项
+type RunOptions struct {
+	// OnEvent 运行事件回调（可选）
+	OnEvent func(Event)
+	// Stream 以流式方式调用 LLM，通过 OnEvent 回调文本增量
+	Stream bool
+
+	// Client 覆盖默认的 LLM 客户端（可选），用于不同的 API 地址或密钥
+	Client *LLMClient
+	// Model 覆盖默认模型（可选）
+	Model string
+	// SystemPrompt 替换默认的系统提示词（可选），技能说明仍追加在后面
+	SystemPrompt string
+	// MaxToolRounds 覆盖单次运行最多的工具调用轮数（可选）
+	MaxToolRounds int
+	// Tools 仅在本次运行中提供的工具（可选），如绑定到当前会话的工具，
+	// 同名时覆盖内置工具，同样受 AllowTool 限制
+	Tools []tools.Tool
+
+	// AllowTool 本次运行可使用的工具（可选，nil 表示不限制）
+	// 内置工具按名称判断，工具技能按 "skill:tool" 判断
+	AllowTool func(name string) bool
+	// AllowSkill 本次运行可使用的技能（可选，nil 表示不限制）
+	// 同时作用于系统提示中的 SKILL.md 技能和工具技能
+	AllowSkill func(name string) bool
+
+	// Approve 每次执行工具前调用（可选），返回错误表示不执行，
+	// 错误信息作为工具结果反馈给模型；可以阻塞等待用户审批
+	Approve func(ctx context.Context, call ToolApproval) error
+}
+
+// ToolApproval 待审批的工具调用
+type ToolApproval struct {
+	ToolCallID string
+	ToolName   string // 内部名称：内置工具名或 "skill:tool"
+	Args       string
+	Risk       string // tools.RiskLow / tools.RiskHigh
 }
 
 // Agent 核心智能体
@@ -118,6 +425,7 @@ type Agent struct {
 	client    *LLMClient
 	skillReg  *skill.Registry
 	toolReg   *tools.Registry
+	toolSkill *skills.Registry
 	workspace string
 }
 
@@ -137,18 +445,57 @@ func New(apiKey string) *Agent {
 	// 创建工具注册表
 	toolReg := tools.NewRegistry()
 
+	// 加载工具型技能（skill.json / MCP），仅在配置了 SKILLS_DIR 时启用
+	toolSkill := skills.NewRegistry()
+	if dir := os.Getenv("SKILLS_DIR"); dir != "" {
+		if err := toolSkill.LoadFromDir(dir); err != nil {
+			fmt.Printf("加载工具技能失败: %v\n", err)
+		}
+	}
+
 	return &Agent{
 		client:    NewLLMClient(baseURL, apiKey, model),
 		skillReg:  skillReg,
 		toolReg:   toolReg,
+		toolSkill: toolSkill,
 		workspace: workspace,
 	}
 }
 
+// Client 返回默认的 LLM 客户端
+func (a *Agent) Client() *LLMClient {
+	return a.client
+}
+
+// Skills 返回 SKILL.md 技能注册表
+func (a *Agent) Skills() *skill.Registry {
+	return a.skillReg
+}
+
+// Model 当前使用的模型名
+func (a *Agent) Model() string {
+	return a.client.Model()
+}
+
+// Workspace 工作目录
+func (a *Agent) Workspace() string {
+	return a.workspace
+}
+
+// Close 释放资源，关闭工具技能的 MCP 子进程
+func (a *Agent) Close() {
+	a.toolSkill.Close()
+}
+
 // Run 执行 Agent Loop
 func (a *Agent) Run(ctx context.Context, history []Message) (string, error) {
+	return a.RunWithOptions(ctx, history, RunOptions{})
+}
+
+// RunWithOptions 执行 Agent Loop：推理 → 工具调用 → 结果反馈，直到模型给出最终回复
+func (a *Agent) RunWithOptions(ctx context.Context, history []Message, opts RunOptions) (string, error) {
 	// 构建系统消息
-	systemMsg := a.buildSystemPrompt()
+	systemMsg := a.buildSystemPrompt(opts)
 	
 	messages := []Message{
 		{Role: "system", Content: systemMsg},
@@ -156,44 +503,88 @@ func (a *Agent) Run(ctx context.Context, history []Message) (string, error) {
 	messages = append(messages, history...)
 
 	// 获取工具定义
-	toolDefs := a.toolReg.GetToolDefinitions()
+	toolDefs := a.toolDefinitions(opts)
 
-	// 调用 LLM
-	resp, err := a.client.Chat(ctx, messages, toolDefs)
-	if err != nil {
-		return "", err
+	maxRounds := maxToolRounds
+	if opts.MaxToolRounds > 0 {
+		maxRounds = opts.MaxToolRounds
 	}
 
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("LLM 返回空响应")
-	}
+	for round := 0; ; round++ {
+		// 超过最大轮数后不再提供工具，强制模型直接回复
+		if round == maxRounds {
+			toolDefs = nil
+		}
 
-	choice := resp.Choices[0].Message
+		resp, err := a.chat(ctx, messages, toolDefs, opts)
+		if err == nil && len(resp.Choices) == 0 {
+			err = fmt.Errorf("LLM 返回空响应")
+		}
+		if err != nil {
+			opts.emit(Event{Type: EventError, Error: err.Error()})
+			return "", err
+		}
+
+		choice := resp.Choices[0].Message
+		if len(choice.ToolCalls) == 0 {
+			return choice.Content, nil
+		}
 
-	// 处理工具调用
-	if len(choice.ToolCalls) > 0 {
-		return a.handleToolCalls(ctx, messages, choice.ToolCalls)
+		// 处理工具调用
+		messages = append(messages, a.handleToolCalls(ctx, choice, opts)...)
+		if err := ctx.Err(); err != nil {
+			opts.emit(Event{Type: EventError, Error: err.Error()})
+			return "", err
+		}
 	}
+}
 
-	return choice.Content, nil
+// emit 回调运行事件（未设置回调时忽略）
+func (o RunOptions) emit(ev Event) {
+	if o.OnEvent != nil {
+		o.OnEvent(ev)
+	}
+}
+
+// chat 根据选项选择普通或流式调用
+func (a *Agent) chat(ctx context.Context, messages []Message, toolDefs []map[string]interface{}, opts RunOptions) (*ChatCompletionResponse, error) {
+	client := a.client
+	if opts.Client != nil {
+		client = opts.Client
+	}
+	if opts.Model != "" {
+		client = client.WithModel(opts.Model)
+	}
+	if !opts.Stream {
+		return client.Chat(ctx, messages, toolDefs)
+	}
+	return client.ChatStream(ctx, messages, toolDefs, func(delta string) {
+		opts.emit(Event{Type: EventDelta, Delta: delta})
+	})
 }
 
 // buildSystemPrompt 构建系统提示词
-func (a *Agent) buildSystemPrompt() string {
+func (a *Agent) buildSystemPrompt(opts RunOptions) string {
 	prompt := `你是一个有用的 AI 助手。你可以使用以下工具来帮助用户：
 
 1. fs:read - 读取文件内容
 2. fs:write - 写入文件内容  
 3. fs:exec - 执行 shell 命令
+4. send_file - 将文件作为附件随回复发送给用户
+
+用户上传的图片会直接附在消息中，其他文件会保存到工作区并在消息中注明路径。
 
 当你收到用户请求时：
 - 分析需要使用哪些工具
 - 按顺序执行工具
 - 根据结果给出最终回复
 `
+	if opts.SystemPrompt != "" {
+		prompt = opts.SystemPrompt
+	}
 	
 	// 添加技能说明
-	skillsPrompt := a.skillReg.BuildSystemPrompt()
+	skillsPrompt := a.skillReg.BuildSystemPromptFor(opts.AllowSkill)
 	if skillsPrompt != "" {
 		prompt += "\n\n" + skillsPrompt
 	}
@@ -201,41 +592,174 @@ func (a *Agent) buildSystemPrompt() string {
 	return prompt
 }
 
-// handleToolCalls 处理工具调用
-func (a *Agent) handleToolCalls(ctx context.Context, messages []Message, toolCalls []ToolCall) (string, error) {
+// handleToolCalls 执行工具调用，返回需要追加到对话中的 assistant 与 tool 消息
+func (a *Agent) handleToolCalls(ctx context.Context, choice Message, opts RunOptions) []Message {
 	// 添加 assistant 的 tool_calls 消息
-	assistantMsg := Message{
-		Role:    "assistant",
-		Content: "",
-	}
-	messages = append(messages, assistantMsg)
+	messages := []Message{{
+		Role:      "assistant",
+		Content:   choice.Content,
+		ToolCalls: choice.ToolCalls,
+	}}
 
 	// 执行每个工具调用
-	for _, tc := range toolCalls {
-		result, err := a.toolReg.Execute(tc.Function.Name, tc.Function.Arguments)
+	for _, tc := range choice.ToolCalls {
+		// 已取消时不再启动新的工具，由 RunWithOptions 结束运行
+		if ctx.Err() != nil {
+			break
+		}
+
+		opts.emit(Event{
+			Type:       EventToolStarted,
+			ToolCallID: tc.ID,
+			ToolName:   tc.Function.Name,
+			ToolArgs:   tc.Function.Arguments,
+		})
+
+		result, err := a.approveAndExecute(ctx, tc, opts)
+		finished := Event{
+			Type:       EventToolFinished,
+			ToolCallID: tc.ID,
+			ToolName:   tc.Function.Name,
+			ToolResult: result,
+		}
 		if err != nil {
+			finished.Error = err.Error()
 			result = fmt.Sprintf("错误: %v", err)
 		}
+		opts.emit(finished)
+
+		// send_file 成功后由频道随回复发送文件
+		if err == nil && tc.Function.Name == tools.SendFileTool {
+			var params struct {
+				Path string `json:"path"`
+			}
+			if json.Unmarshal([]byte(tc.Function.Arguments), &params) == nil {
+				opts.emit(Event{Type: EventFile, ToolCallID: tc.ID, FilePath: params.Path})
+			}
+		}
 
 		// 添加 tool 结果到消息
-		toolMsg := Message{
-			Role:    "tool",
-			Content: result,
+		messages = append(messages, Message{
+			Role:       "tool",
+			Content:    result,
+			ToolCallID: tc.ID,
+		})
+	}
+
+	return messages
+}
+
+// toolDefinitions 合并内置工具与工具技能的定义
+//
+// 技能工具内部以 "skill:tool" 命名，而 OpenAI 函数名不允许冒号，
+// 因此暴露给 LLM 时替换为 "skill__tool"。
+func (a *Agent) toolDefinitions(opts RunOptions) []map[string]interface{} {
+	var defs []map[string]interface{}
+	for _, t := range opts.Tools {
+		if opts.toolAllowed(t.Name) {
+			defs = append(defs, t.Definition())
 		}
-		messages = append(messages, toolMsg)
 	}
+	for _, def := range a.toolReg.GetToolDefinitions() {
+		name := toolDefName(def)
+		if _, ok := opts.tool(name); !ok && opts.toolAllowed(name) {
+			defs = append(defs, def)
+		}
+	}
+	for _, def := range a.toolSkill.GetToolDefinitions() {
+		name := toolDefName(def)
+		if !opts.toolAllowed(name) {
+			continue
+		}
+		if fn, ok := def["function"].(map[string]interface{}); ok {
+			fn["name"] = strings.ReplaceAll(name, ":", "__")
+		}
+		defs = append(defs, def)
+	}
+	return defs
+}
 
-	// 再次调用 LLM 获取最终回复
-	finalResp, err := a.client.Chat(ctx, messages, nil)
-	if err != nil {
-		return "", err
+// toolDefName 取出工具定义中的函数名
+func toolDefName(def map[string]interface{}) string {
+	fn, _ := def["function"].(map[string]interface{})
+	name, _ := fn["name"].(string)
+	return name
+}
+
+// toolAllowed 检查工具是否允许在本次运行中使用，name 为内部名称
+func (o RunOptions) toolAllowed(name string) bool {
+	if skillName, _, ok := strings.Cut(name, ":"); ok && o.AllowSkill != nil && !o.AllowSkill(skillName) {
+		return false
 	}
+	return o.AllowTool == nil || o.AllowTool(name)
+}
+
+// tool 查找本次运行提供的工具
+func (o RunOptions) tool(name string) (tools.Tool, bool) {
+	for _, t := range o.Tools {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return tools.Tool{}, false
+}
 
-	if len(finalResp.Choices) == 0 {
-		return "", fmt.Errorf("LLM 返回空响应")
+// approveAndExecute 检查权限并按选项审批后执行工具调用
+//
+// 模型可能调用未提供给它的工具，因此执行前再次检查权限。
+func (a *Agent) approveAndExecute(ctx context.Context, tc ToolCall, opts RunOptions) (string, error) {
+	internal := internalToolName(tc.Function.Name)
+	if !opts.toolAllowed(internal) {
+		return "", fmt.Errorf("无权使用工具: %s", internal)
 	}
 
-	return finalResp.Choices[0].Message.Content, nil
+	extra, isExtra := opts.tool(internal)
+	if opts.Approve != nil {
+		risk := a.ToolRisk(internal)
+		if isExtra {
+			risk = extra.Risk
+			if risk == "" {
+				risk = tools.RiskLow
+			}
+		}
+		err := opts.Approve(ctx, ToolApproval{
+			ToolCallID: tc.ID,
+			ToolName:   internal,
+			Args:       tc.Function.Arguments,
+			Risk:       risk,
+		})
+		if err != nil {
+			return "", fmt.Errorf("未执行: %w", err)
+		}
+	}
+	if isExtra {
+		return extra.Handler(ctx, tc.Function.Arguments)
+	}
+	return a.executeTool(ctx, tc.Function.Name, tc.Function.Arguments)
+}
+
+// ToolRisk 返回工具的风险等级，name 为内部名称
+func (a *Agent) ToolRisk(name string) string {
+	if strings.Contains(name, ":") {
+		return a.toolSkill.Risk(name)
+	}
+	return a.toolReg.Risk(name)
+}
+
+// internalToolName 将暴露给 LLM 的 "skill__tool" 还原为 "skill:tool"
+func internalToolName(name string) string {
+	if skillName, toolName, ok := strings.Cut(name, "__"); ok {
+		return skillName + ":" + toolName
+	}
+	return name
+}
+
+// executeTool 按名称分发到内置工具或工具技能
+func (a *Agent) executeTool(ctx context.Context, name, args string) (string, error) {
+	if internal := internalToolName(name); internal != name {
+		return a.toolSkill.Execute(ctx, internal, args)
+	}
+	return a.toolReg.Execute(ctx, name, args)
 }
 
 // getEnv 获取环境变量，如果不存在返回默认值
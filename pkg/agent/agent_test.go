@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeToolCallLLM 第一次请求返回一次工具调用，之后直接回复
+func fakeToolCallLLM(t *testing.T, name, args string) string {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		msg := map[string]interface{}{"role": "assistant", "content": "完成"}
+		if calls.Add(1) == 1 {
+			msg = map[string]interface{}{
+				"role": "assistant",
+				"tool_calls": []map[string]interface{}{{
+					"id":       "call_1",
+					"type":     "function",
+					"function": map[string]string{"name": name, "arguments": args},
+				}},
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": msg, "finish_reason": "stop"}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestBuiltinSkillToolsRequireApproval(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "pwned")
+	cmd, _ := json.Marshal(map[string]string{"command": "touch " + marker})
+	write, _ := json.Marshal(map[string]string{"path": marker, "content": "x"})
+
+	tests := []struct {
+		name string
+		tool string
+		args string
+	}{
+		{"执行命令", "fs__exec", string(cmd)},
+		{"写入文件", "fs__write", string(write)},
+		{"未注册的技能工具", "nope__run", `{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OPENAI_BASE_URL", fakeToolCallLLM(t, tt.tool, tt.args))
+			t.Setenv("WORKSPACE", dir)
+			a := New("test")
+			defer a.Close()
+
+			var asked []ToolApproval
+			_, err := a.RunWithOptions(context.Background(), []Message{{Role: "user", Content: "hi"}}, RunOptions{
+				Approve: func(ctx context.Context, call ToolApproval) error {
+					asked = append(asked, call)
+					return errors.New("拒绝")
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(asked) != 1 || asked[0].Risk != "high" {
+				t.Fatalf("审批请求 %+v，期望一次 high 风险审批", asked)
+			}
+			if _, err := os.Stat(marker); err == nil {
+				t.Fatal("被拒绝的工具调用仍然执行了")
+			}
+		})
+	}
+}
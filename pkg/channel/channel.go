@@ -0,0 +1,115 @@
+package channel
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/gateway"
+)
+
+// New 根据配置创建频道适配器
+func New(cfg config.ChannelConfig, gw *gateway.Gateway) (gateway.Channel, error) {
+	switch cfg.Type {
+	case "telegram":
+		return NewTelegramAdapter(cfg, gw)
+	case "discord":
+		if cfg.Token == "" {
+			return nil, fmt.Errorf("频道 %s: 缺少 token", cfg.Name)
+		}
+		return NewDiscordAdapter(cfg, gw), nil
+	case "slack":
+		return NewSlackAdapter(cfg, gw)
+	case "http":
+		return NewHTTPAdapter(cfg, gw)
+	case "openai":
+		return NewOpenAIAdapter(cfg, gw)
+	case "websocket":
+		return NewWebSocketAdapter(cfg, gw)
+	default:
+		return nil, fmt.Errorf("频道 %s: 不支持的类型 %q", cfg.Name, cfg.Type)
+	}
+}
+
+// splitMessage 按平台单条消息长度上限切分文本
+//
+// 优先在换行处切分，其次在空格处，均不可用时按字符硬切。
+func splitMessage(text string, limit int) []string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return []string{text}
+	}
+
+	var chunks []string
+	for len(runes) > limit {
+		cut := lastIndexRune(runes[:limit], '\n')
+		if cut <= 0 {
+			cut = lastIndexRune(runes[:limit], ' ')
+		}
+		if cut <= 0 {
+			cut = limit
+		}
+		chunks = append(chunks, string(runes[:cut]))
+		runes = runes[cut:]
+		// 去掉切分处的分隔符
+		if len(runes) > 0 && (runes[0] == '\n' || runes[0] == ' ') {
+			runes = runes[1:]
+		}
+	}
+	if len(runes) > 0 {
+		chunks = append(chunks, string(runes))
+	}
+	return chunks
+}
+
+// lastIndexRune 返回 r 在 runes 中最后出现的位置
+func lastIndexRune(runes []rune, r rune) int {
+	for i := len(runes) - 1; i >= 0; i-- {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// newID 生成随机 ID
+func newID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// httpOpener 返回通过 HTTP GET 下载附件的函数，header 用于需要鉴权的文件地址
+func httpOpener(url string, header http.Header) func(ctx context.Context) (io.ReadCloser, error) {
+	return func(ctx context.Context) (io.ReadCloser, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("下载附件失败: HTTP %d", resp.StatusCode)
+		}
+		return resp.Body, nil
+	}
+}
+
+// retryAfterSeconds 将等待时间转为 Retry-After 头的秒数，向上取整
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(max(d, time.Second).Seconds())))
+}
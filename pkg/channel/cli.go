@@ -0,0 +1,291 @@
+package channel
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/agent"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/gateway"
+)
+
+// ANSI 样式
+const (
+	ansiReset     = "\033[0m"
+	ansiBold      = "\033[1m"
+	ansiDim       = "\033[2m"
+	ansiUnderline = "\033[4m"
+	ansiCyan      = "\033[36m"
+	ansiGreen     = "\033[32m"
+	ansiRed       = "\033[31m"
+	ansiYellow    = "\033[33m"
+)
+
+// CLIAdapter 终端交互频道，供本地开发调试
+//
+// 与其他频道一样经过 Gateway → Agent → 工具的完整链路，
+// 会话历史保存在 session.Manager 中；工具调用实时显示，回复按 Markdown 渲染。
+type CLIAdapter struct {
+	name    string
+	userID  string
+	gateway *gateway.Gateway
+	in      io.Reader
+	out     io.Writer
+	color   bool
+
+	// lines 由唯一的读取协程写入，REPL 与审批确认共用
+	lines    chan string
+	inputErr error
+
+	mu      sync.Mutex
+	waiting chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewCLIAdapter 创建终端频道，读写标准输入输出
+func NewCLIAdapter(gw *gateway.Gateway) *CLIAdapter {
+	userID := os.Getenv("USER")
+	if userID == "" {
+		userID = "cli"
+	}
+	return &CLIAdapter{
+		name:    "cli",
+		userID:  userID,
+		gateway: gw,
+		in:      os.Stdin,
+		out:     os.Stdout,
+		color:   isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == "",
+		lines:   make(chan string),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Name 适配器名称
+func (c *CLIAdapter) Name() string {
+	return c.name
+}
+
+// Start 运行 REPL，输入 /exit 或 EOF 时返回
+func (c *CLIAdapter) Start() error {
+	fmt.Fprintf(c.out, "%s Mini Agent Gateway 终端对话（模型: %s）\n",
+		c.style(ansiBold, "🤖"), c.gateway.Agent().Model())
+	fmt.Fprintln(c.out, c.style(ansiDim, "输入 /help 查看命令，/exit 退出"))
+
+	go c.readLines()
+
+	for {
+		fmt.Fprint(c.out, "\n"+c.style(ansiGreen+ansiBold, "> "))
+		line, ok := <-c.lines
+		if !ok {
+			fmt.Fprintln(c.out)
+			return c.inputErr
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		text, exit := c.command(line)
+		if exit {
+			return nil
+		}
+		if text == "" {
+			continue
+		}
+
+		if !c.ask(text) {
+			return nil
+		}
+	}
+}
+
+// readLines 逐行读取输入，EOF 时关闭 lines
+func (c *CLIAdapter) readLines() {
+	scanner := bufio.NewScanner(c.in)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		c.lines <- scanner.Text()
+	}
+	c.inputErr = scanner.Err()
+	close(c.lines)
+}
+
+// SendApproval 实现 gateway.ApprovalSender，在终端中确认高风险工具调用
+//
+// REPL 等待回复期间不读取输入，由这里读取一行作为决定；超时后不再读取。
+func (c *CLIAdapter) SendApproval(msg gateway.Message, req gateway.ApprovalRequest) error {
+	fmt.Fprintf(c.out, "%s 执行高风险工具 %s %s\n%s ",
+		c.style(ansiYellow+ansiBold, "⚠"), c.style(ansiBold, req.Tool), c.style(ansiDim, preview(req.Args, 200)),
+		c.style(ansiYellow, "允许执行？[y]es / [n]o / [a]lways:"))
+
+	go func() {
+		var d gateway.Decision
+		select {
+		case line, ok := <-c.lines:
+			if !ok {
+				return
+			}
+			switch strings.ToLower(strings.TrimSpace(line)) {
+			case "y", "yes":
+				d = gateway.DecisionApprove
+			case "a", "always":
+				d = gateway.DecisionAlways
+			default:
+				d = gateway.DecisionDeny
+			}
+		case <-time.After(time.Until(req.Expires)):
+			fmt.Fprintln(c.out, c.style(ansiRed, "\n审批超时，已拒绝"))
+			return
+		case <-c.stopped:
+			return
+		}
+		if err := c.gateway.ResolveApproval(c.name, msg.UserID, req.ID, d); err != nil {
+			fmt.Fprintf(c.out, "%s %v\n", c.style(ansiRed, "✗"), err)
+		}
+	}()
+	return nil
+}
+
+// Stop 停止 REPL
+func (c *CLIAdapter) Stop() {
+	c.once.Do(func() { close(c.stopped) })
+}
+
+// Send 实现 gateway.Channel，渲染最终回复
+func (c *CLIAdapter) Send(reply gateway.Reply) error {
+	fmt.Fprintln(c.out, c.renderMarkdown(reply.Text))
+	for _, att := range reply.Attachments {
+		fmt.Fprintf(c.out, "%s %s %s\n", c.style(ansiCyan, "📎"), att.Path, c.style(ansiDim, fmt.Sprintf("(%s, %d 字节)", att.MIMEType, att.Size)))
+	}
+
+	c.mu.Lock()
+	if c.waiting != nil {
+		close(c.waiting)
+		c.waiting = nil
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// SendEvent 实现 gateway.EventSender，实时显示工具调用
+func (c *CLIAdapter) SendEvent(msg gateway.Message, ev agent.Event) error {
+	switch ev.Type {
+	case agent.EventToolStarted:
+		fmt.Fprintf(c.out, "%s %s %s\n",
+			c.style(ansiYellow, "⚙"), c.style(ansiBold, ev.ToolName), c.style(ansiDim, preview(ev.ToolArgs, 200)))
+	case agent.EventToolFinished:
+		if ev.Error != "" {
+			fmt.Fprintf(c.out, "  %s %s\n", c.style(ansiRed, "✗"), ev.Error)
+		} else {
+			result := strings.ReplaceAll(preview(strings.TrimSpace(ev.ToolResult), 200), "\n", " ⏎ ")
+			fmt.Fprintf(c.out, "  %s %s\n", c.style(ansiGreen, "✓"), c.style(ansiDim, result))
+		}
+	case agent.EventError:
+		fmt.Fprintf(c.out, "%s %s\n", c.style(ansiRed, "错误:"), ev.Error)
+	}
+	return nil
+}
+
+// ask 发送消息到网关并等待回复
+func (c *CLIAdapter) ask(text string) bool {
+	done := make(chan struct{})
+	c.mu.Lock()
+	c.waiting = done
+	c.mu.Unlock()
+
+	c.gateway.HandleMessage(gateway.Message{
+		ID:        newID(),
+		UserID:    c.userID,
+		ChatID:    c.userID,
+		Text:      text,
+		Channel:   c.name,
+		Timestamp: time.Now(),
+	})
+
+	select {
+	case <-done:
+		return true
+	case <-c.stopped:
+		return false
+	}
+}
+
+// command 处理以 / 开头的输入
+//
+// 返回需要发送给网关的文本（为空表示已在本地处理），以及是否退出。
+func (c *CLIAdapter) command(line string) (string, bool) {
+	if !strings.HasPrefix(line, "/") {
+		return line, false
+	}
+
+	cmd, _, _ := strings.Cut(line, " ")
+	switch cmd {
+	case "/exit", "/quit":
+		return "", true
+	}
+
+	// 其他命令（/help、/reset、技能命令等）由网关处理
+	return line, false
+}
+
+var (
+	cliBold       = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	cliInlineCode = regexp.MustCompile("`([^`]+)`")
+	cliHeading    = regexp.MustCompile(`^(#{1,6})\s+(.+)$`)
+	cliBullet     = regexp.MustCompile(`^(\s*)[-*]\s+`)
+)
+
+// renderMarkdown 将常见 Markdown 渲染为终端样式
+func (c *CLIAdapter) renderMarkdown(text string) string {
+	if !c.color {
+		return text
+	}
+
+	lines := strings.Split(text, "\n")
+	inCode := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			lines[i] = c.style(ansiDim, line)
+			continue
+		}
+		if inCode {
+			lines[i] = c.style(ansiCyan, line)
+			continue
+		}
+
+		if m := cliHeading.FindStringSubmatch(line); m != nil {
+			lines[i] = c.style(ansiBold+ansiUnderline, m[2])
+			continue
+		}
+		line = cliBullet.ReplaceAllString(line, "$1• ")
+		line = cliBold.ReplaceAllString(line, ansiBold+"$1"+ansiReset)
+		line = cliInlineCode.ReplaceAllString(line, ansiCyan+"$1"+ansiReset)
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// style 在终端支持颜色时添加 ANSI 样式
+func (c *CLIAdapter) style(code, s string) string {
+	if !c.color {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// isTerminal 判断文件是否为终端
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,740 @@
+package channel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/gateway"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	discordAPIBase      = "https://discord.com/api/v10"
+	discordMessageLimit = 2000
+	discordMaxFiles     = 10
+
+	// GUILDS | GUILD_MESSAGES | DIRECT_MESSAGES | MESSAGE_CONTENT
+	discordIntents = 1<<0 | 1<<9 | 1<<12 | 1<<15
+)
+
+// Discord Gateway opcodes
+const (
+	discordOpDispatch       = 0
+	discordOpHeartbeat      = 1
+	discordOpIdentify       = 2
+	discordOpResume         = 6
+	discordOpReconnect      = 7
+	discordOpInvalidSession = 9
+	discordOpHello          = 10
+	discordOpHeartbeatACK   = 11
+)
+
+// discordPayload Gateway 帧
+type discordPayload struct {
+	Op int             `json:"op"`
+	D  json.RawMessage `json:"d,omitempty"`
+	S  *int64          `json:"s,omitempty"`
+	T  string          `json:"t,omitempty"`
+}
+
+// discordCommand 发往 Gateway 的帧
+type discordCommand struct {
+	Op int         `json:"op"`
+	D  interface{} `json:"d"`
+}
+
+// discordMessage MESSAGE_CREATE / MESSAGE_UPDATE 事件数据
+type discordMessage struct {
+	ID        string        `json:"id"`
+	ChannelID string        `json:"channel_id"`
+	GuildID   string        `json:"guild_id"`
+	Content   string        `json:"content"`
+	Author    discordUser   `json:"author"`
+	Mentions  []discordUser `json:"mentions"`
+	// EditedTimestamp 用户编辑消息的时间，嵌入内容更新等非编辑事件为空
+	EditedTimestamp *time.Time `json:"edited_timestamp"`
+	// ReferencedMessage 被回复的消息（仅包含需要的字段）
+	ReferencedMessage *struct {
+		ID      string      `json:"id"`
+		Content string      `json:"content"`
+		Author  discordUser `json:"author"`
+	} `json:"referenced_message"`
+	Attachments []struct {
+		Filename    string `json:"filename"`
+		ContentType string `json:"content_type"`
+		Size        int64  `json:"size"`
+		URL         string `json:"url"`
+	} `json:"attachments"`
+}
+
+// discordThread 子区（thread）频道，仅包含需要的字段
+type discordThread struct {
+	ID       string `json:"id"`
+	ParentID string `json:"parent_id"`
+}
+
+// discordUser 消息作者或被提及的用户
+type discordUser struct {
+	ID         string `json:"id"`
+	Username   string `json:"username"`
+	GlobalName string `json:"global_name"`
+	Bot        bool   `json:"bot"`
+}
+
+// discordFatalError 不可恢复的 Gateway 错误（鉴权失败、非法 intents 等）
+type discordFatalError struct {
+	code int
+	text string
+}
+
+func (e *discordFatalError) Error() string {
+	return fmt.Sprintf("Discord Gateway 关闭 %d: %s", e.code, e.text)
+}
+
+// DiscordAdapter Discord 频道适配器
+//
+// 通过 Gateway websocket 接收消息（identify / heartbeat / resume），
+// 通过 REST API 发送回复。
+type DiscordAdapter struct {
+	name       string
+	token      string
+	apiBase    string
+	gatewayURL string
+	gateway    *gateway.Gateway
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	conn      *websocket.Conn
+	stopped   bool
+	sessionID string
+	resumeURL string
+	seq       int64
+	botID     string
+	// threads 已知的子区 → 所在频道，子区内的消息以所在频道为会话、子区为线程
+	threads map[string]string
+
+	writeMu sync.Mutex
+}
+
+// NewDiscordAdapter 创建 Discord 适配器
+func NewDiscordAdapter(cfg config.ChannelConfig, gw *gateway.Gateway) *DiscordAdapter {
+	apiBase := cfg.APIBaseURL
+	if apiBase == "" {
+		apiBase = discordAPIBase
+	}
+	return &DiscordAdapter{
+		name:       cfg.Name,
+		token:      cfg.Token,
+		apiBase:    strings.TrimRight(apiBase, "/"),
+		gatewayURL: cfg.GatewayURL,
+		gateway:    gw,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		threads:    make(map[string]string),
+	}
+}
+
+// Name 适配器名称
+func (d *DiscordAdapter) Name() string {
+	return d.name
+}
+
+// Start 连接 Gateway 并接收消息
+//
+// 服务端要求重连或连接中断时自动 resume；不可恢复的错误返回给网关监管。
+func (d *DiscordAdapter) Start() error {
+	failures := 0
+	for {
+		started := time.Now()
+		err := d.session()
+		if d.isStopped() {
+			return nil
+		}
+
+		var fatal *discordFatalError
+		if errors.As(err, &fatal) || !d.canResume() {
+			return err
+		}
+
+		// 连续快速失败时交给网关监管退避
+		if time.Since(started) < 10*time.Second {
+			failures++
+		} else {
+			failures = 0
+		}
+		if failures >= 3 {
+			return err
+		}
+
+		log.Printf("[%s] Gateway 连接断开，正在恢复: %v", d.name, err)
+		time.Sleep(time.Second)
+	}
+}
+
+// Stop 断开 Gateway 连接
+func (d *DiscordAdapter) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.stopped = true
+	if d.conn != nil {
+		d.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+			time.Now().Add(time.Second))
+		d.conn.Close()
+	}
+}
+
+// session 运行一次 Gateway 连接，直到连接断开
+func (d *DiscordAdapter) session() error {
+	url, err := d.dialURL()
+	if err != nil {
+		return err
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return fmt.Errorf("连接 Gateway: %w", err)
+	}
+	defer conn.Close()
+
+	d.mu.Lock()
+	if d.stopped {
+		d.mu.Unlock()
+		return nil
+	}
+	d.conn = conn
+	d.mu.Unlock()
+
+	// 首帧必须是 Hello
+	var hello discordPayload
+	if err := conn.ReadJSON(&hello); err != nil {
+		return fmt.Errorf("读取 Hello: %w", err)
+	}
+	if hello.Op != discordOpHello {
+		return fmt.Errorf("期望 Hello，收到 op %d", hello.Op)
+	}
+	var helloData struct {
+		HeartbeatInterval int `json:"heartbeat_interval"`
+	}
+	if err := json.Unmarshal(hello.D, &helloData); err != nil {
+		return fmt.Errorf("解析 Hello: %w", err)
+	}
+
+	if err := d.identifyOrResume(conn); err != nil {
+		return err
+	}
+
+	acked := make(chan struct{}, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go d.heartbeat(conn, time.Duration(helloData.HeartbeatInterval)*time.Millisecond, acked, done)
+
+	for {
+		var p discordPayload
+		if err := conn.ReadJSON(&p); err != nil {
+			return d.closeError(err)
+		}
+		if p.S != nil {
+			d.mu.Lock()
+			d.seq = *p.S
+			d.mu.Unlock()
+		}
+
+		switch p.Op {
+		case discordOpDispatch:
+			d.dispatch(p.T, p.D)
+		case discordOpHeartbeat:
+			d.sendHeartbeat(conn)
+		case discordOpHeartbeatACK:
+			select {
+			case acked <- struct{}{}:
+			default:
+			}
+		case discordOpReconnect:
+			return fmt.Errorf("服务端要求重连")
+		case discordOpInvalidSession:
+			var resumable bool
+			json.Unmarshal(p.D, &resumable)
+			if !resumable {
+				d.resetSession()
+			}
+			// 文档要求等待 1-5 秒后重新 identify
+			time.Sleep(time.Duration(1+time.Now().UnixNano()%4) * time.Second)
+			return fmt.Errorf("会话失效 (resumable=%v)", resumable)
+		}
+	}
+}
+
+// dialURL 计算本次连接的 Gateway 地址
+func (d *DiscordAdapter) dialURL() (string, error) {
+	d.mu.Lock()
+	url := d.resumeURL
+	if d.sessionID == "" {
+		url = ""
+	}
+	d.mu.Unlock()
+
+	if url == "" {
+		url = d.gatewayURL
+	}
+	if url == "" {
+		var resp struct {
+			URL string `json:"url"`
+		}
+		if err := d.api(http.MethodGet, "/gateway/bot", nil, &resp); err != nil {
+			return "", fmt.Errorf("获取 Gateway 地址: %w", err)
+		}
+		url = resp.URL
+	}
+	return strings.TrimRight(url, "/") + "/?v=10&encoding=json", nil
+}
+
+// identifyOrResume 有会话时 resume，否则 identify
+func (d *DiscordAdapter) identifyOrResume(conn *websocket.Conn) error {
+	d.mu.Lock()
+	sessionID, seq := d.sessionID, d.seq
+	d.mu.Unlock()
+
+	if sessionID != "" {
+		return d.write(conn, discordCommand{
+			Op: discordOpResume,
+			D: map[string]interface{}{
+				"token":      d.token,
+				"session_id": sessionID,
+				"seq":        seq,
+			},
+		})
+	}
+
+	return d.write(conn, discordCommand{
+		Op: discordOpIdentify,
+		D: map[string]interface{}{
+			"token":   d.token,
+			"intents": discordIntents,
+			"properties": map[string]string{
+				"os":      "linux",
+				"browser": "mini-agent-gateway",
+				"device":  "mini-agent-gateway",
+			},
+		},
+	})
+}
+
+// heartbeat 按服务端要求的间隔发送心跳，未收到 ACK 时判定为僵死连接
+func (d *DiscordAdapter) heartbeat(conn *websocket.Conn, interval time.Duration, acked <-chan struct{}, done <-chan struct{}) {
+	if interval <= 0 {
+		return
+	}
+
+	// 首次心跳带随机抖动
+	jitter := time.Duration(time.Now().UnixNano() % int64(interval))
+	select {
+	case <-time.After(jitter):
+	case <-done:
+		return
+	}
+
+	for {
+		d.sendHeartbeat(conn)
+
+		select {
+		case <-done:
+			return
+		case <-time.After(interval):
+		}
+
+		select {
+		case <-acked:
+		default:
+			log.Printf("[%s] 未收到心跳 ACK，断开重连", d.name)
+			conn.Close()
+			return
+		}
+	}
+}
+
+// sendHeartbeat 发送心跳帧
+func (d *DiscordAdapter) sendHeartbeat(conn *websocket.Conn) {
+	d.mu.Lock()
+	var seq interface{}
+	if d.seq > 0 {
+		seq = d.seq
+	}
+	d.mu.Unlock()
+
+	if err := d.write(conn, discordCommand{Op: discordOpHeartbeat, D: seq}); err != nil {
+		log.Printf("[%s] 发送心跳失败: %v", d.name, err)
+	}
+}
+
+// dispatch 处理 Gateway 事件
+func (d *DiscordAdapter) dispatch(event string, data json.RawMessage) {
+	switch event {
+	case "READY":
+		var ready struct {
+			SessionID        string `json:"session_id"`
+			ResumeGatewayURL string `json:"resume_gateway_url"`
+			User             struct {
+				ID       string `json:"id"`
+				Username string `json:"username"`
+			} `json:"user"`
+		}
+		if err := json.Unmarshal(data, &ready); err != nil {
+			log.Printf("[%s] 解析 READY 失败: %v", d.name, err)
+			return
+		}
+		d.mu.Lock()
+		d.sessionID = ready.SessionID
+		d.resumeURL = ready.ResumeGatewayURL
+		d.botID = ready.User.ID
+		d.mu.Unlock()
+		log.Printf("[%s] 已连接 Discord Bot: %s", d.name, ready.User.Username)
+
+	case "RESUMED":
+		log.Printf("[%s] Discord 会话已恢复", d.name)
+
+	case "GUILD_CREATE", "THREAD_LIST_SYNC":
+		var g struct {
+			Threads []discordThread `json:"threads"`
+		}
+		if err := json.Unmarshal(data, &g); err != nil {
+			log.Printf("[%s] 解析 %s 失败: %v", d.name, event, err)
+			return
+		}
+		d.trackThreads(g.Threads...)
+
+	case "THREAD_CREATE", "THREAD_UPDATE":
+		var th discordThread
+		if err := json.Unmarshal(data, &th); err != nil {
+			log.Printf("[%s] 解析 %s 失败: %v", d.name, event, err)
+			return
+		}
+		d.trackThreads(th)
+
+	case "THREAD_DELETE":
+		var th discordThread
+		if err := json.Unmarshal(data, &th); err == nil {
+			d.mu.Lock()
+			delete(d.threads, th.ID)
+			d.mu.Unlock()
+		}
+
+	case "MESSAGE_CREATE":
+		var m discordMessage
+		if err := json.Unmarshal(data, &m); err != nil {
+			log.Printf("[%s] 解析消息失败: %v", d.name, err)
+			return
+		}
+		d.handleMessage(m)
+
+	case "MESSAGE_UPDATE":
+		var m discordMessage
+		if err := json.Unmarshal(data, &m); err != nil {
+			log.Printf("[%s] 解析消息失败: %v", d.name, err)
+			return
+		}
+		if m.EditedTimestamp != nil {
+			d.handleMessage(m)
+		}
+
+	case "MESSAGE_DELETE":
+		var m struct {
+			ID        string `json:"id"`
+			ChannelID string `json:"channel_id"`
+		}
+		if err := json.Unmarshal(data, &m); err != nil {
+			log.Printf("[%s] 解析消息失败: %v", d.name, err)
+			return
+		}
+		chatID, _ := d.chatOf(m.ChannelID)
+		d.gateway.HandleDelete(d.name, chatID, m.ID)
+	}
+}
+
+// trackThreads 记录子区所在的频道
+func (d *DiscordAdapter) trackThreads(threads ...discordThread) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, th := range threads {
+		if th.ID != "" && th.ParentID != "" {
+			d.threads[th.ID] = th.ParentID
+		}
+	}
+}
+
+// chatOf 返回消息所在频道对应的会话与线程：子区内的消息属于所在频道的子区线程
+func (d *DiscordAdapter) chatOf(channelID string) (chatID, threadID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if parent, ok := d.threads[channelID]; ok {
+		return parent, channelID
+	}
+	return channelID, ""
+}
+
+// handleMessage 将 Discord 消息转换为网关消息
+func (d *DiscordAdapter) handleMessage(m discordMessage) {
+	d.mu.Lock()
+	botID := d.botID
+	d.mu.Unlock()
+
+	// 忽略机器人（包括自己）的消息
+	if m.Author.Bot || m.Author.ID == botID {
+		return
+	}
+	if m.Content == "" && len(m.Attachments) == 0 {
+		return
+	}
+
+	chatID, threadID := d.chatOf(m.ChannelID)
+	msg := gateway.Message{
+		ID:        m.ID,
+		UserID:    m.Author.ID,
+		UserName:  m.Author.GlobalName,
+		ChatID:    chatID,
+		GuildID:   m.GuildID,
+		ThreadID:  threadID,
+		Text:      m.Content,
+		Channel:   d.name,
+		Timestamp: time.Now(),
+		IsGroup:   m.GuildID != "",
+	}
+	if m.EditedTimestamp != nil {
+		msg.Edited, msg.Timestamp = true, *m.EditedTimestamp
+	}
+	if msg.UserName == "" {
+		msg.UserName = m.Author.Username
+	}
+	if r := m.ReferencedMessage; r != nil {
+		msg.ReplyToID, msg.ReplyToText = r.ID, r.Content
+		msg.ReplyToUser = r.Author.GlobalName
+		if msg.ReplyToUser == "" {
+			msg.ReplyToUser = r.Author.Username
+		}
+	}
+	if msg.IsGroup && botID != "" {
+		for _, u := range m.Mentions {
+			if u.ID == botID {
+				msg.Mentioned = true
+			}
+		}
+		if m.ReferencedMessage != nil && m.ReferencedMessage.Author.ID == botID {
+			msg.Mentioned = true
+		}
+		// 去掉 <@id> / <@!id> 形式的提及
+		msg.Text = strings.TrimSpace(strings.NewReplacer("<@"+botID+">", "", "<@!"+botID+">", "").Replace(msg.Text))
+	}
+	for _, a := range m.Attachments {
+		mimeType := a.ContentType
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+		// 附件 CDN 地址自带签名，无需鉴权头
+		msg.Attachments = append(msg.Attachments, gateway.Attachment{
+			Kind:     gateway.KindOf(mimeType),
+			MIMEType: mimeType,
+			Size:     a.Size,
+			FileName: a.Filename,
+			Open:     httpOpener(a.URL, nil),
+		})
+	}
+
+	d.gateway.HandleMessage(msg)
+
+	kind := "消息"
+	if msg.Edited {
+		kind = "编辑的消息"
+	}
+	log.Printf("[%s] 收到%s from %s: %s（%d 个附件）", d.name, kind, m.Author.Username, m.Content, len(msg.Attachments))
+}
+
+// Send 实现 gateway.Channel，超过 2000 字符时分段发送，子区内的消息回复到子区
+func (d *DiscordAdapter) Send(reply gateway.Reply) error {
+	channelID := reply.ChatID
+	if reply.ThreadID != "" {
+		channelID = reply.ThreadID
+	}
+	if !discordSnowflake(channelID) {
+		return fmt.Errorf("无效的 Discord channel ID %q", channelID)
+	}
+
+	var chunks []string
+	if reply.Text != "" {
+		chunks = splitMessage(reply.Text, discordMessageLimit)
+	}
+	for i, chunk := range chunks {
+		body := map[string]interface{}{
+			"content": chunk,
+		}
+		// 仅第一段引用原消息；不是 snowflake 的 ID 不是 Discord 消息，引用会被拒绝
+		if i == 0 && discordSnowflake(reply.ReplyToID) {
+			body["message_reference"] = map[string]interface{}{
+				"message_id":         reply.ReplyToID,
+				"fail_if_not_exists": false,
+			}
+		}
+		if err := d.api(http.MethodPost, "/channels/"+channelID+"/messages", body, nil); err != nil {
+			return err
+		}
+	}
+
+	// 单条消息最多 10 个附件
+	for start := 0; start < len(reply.Attachments); start += discordMaxFiles {
+		end := start + discordMaxFiles
+		if end > len(reply.Attachments) {
+			end = len(reply.Attachments)
+		}
+		if err := d.sendFiles(channelID, reply.Attachments[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendFiles 以 multipart/form-data 上传附件
+func (d *DiscordAdapter) sendFiles(channelID string, atts []gateway.Attachment) error {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	meta := make([]map[string]interface{}, len(atts))
+	for i, att := range atts {
+		data, err := att.Read(context.Background())
+		if err != nil {
+			return fmt.Errorf("读取附件 %s 失败: %w", att.FileName, err)
+		}
+		fw, err := mw.CreateFormFile(fmt.Sprintf("files[%d]", i), att.FileName)
+		if err != nil {
+			return err
+		}
+		fw.Write(data)
+		meta[i] = map[string]interface{}{"id": i, "filename": att.FileName}
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{"attachments": meta})
+	if err := mw.WriteField("payload_json", string(payload)); err != nil {
+		return err
+	}
+	mw.Close()
+
+	return d.do(http.MethodPost, "/channels/"+channelID+"/messages", mw.FormDataContentType(), buf.Bytes(), nil)
+}
+
+// api 以 JSON 请求体调用 Discord REST API
+func (d *DiscordAdapter) api(method, path string, body, out interface{}) error {
+	var payload []byte
+	contentType := ""
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+		contentType = "application/json"
+	}
+	return d.do(method, path, contentType, payload, out)
+}
+
+// do 发送 REST 请求，遇到 429 时按 retry_after 重试
+func (d *DiscordAdapter) do(method, path, contentType string, payload []byte, out interface{}) error {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, d.apiBase+path, bytes.NewReader(payload))
+		if err != nil {
+			return fmt.Errorf("create request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bot "+d.token)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		resp, err := d.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("do request: %w", err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < 3 {
+			var limit struct {
+				RetryAfter float64 `json:"retry_after"`
+			}
+			json.Unmarshal(data, &limit)
+			time.Sleep(time.Duration(limit.RetryAfter * float64(time.Second)))
+			continue
+		}
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("Discord API error %d: %s", resp.StatusCode, string(data))
+		}
+		if out != nil {
+			if err := json.Unmarshal(data, out); err != nil {
+				return fmt.Errorf("decode response: %w", err)
+			}
+		}
+		return nil
+	}
+}
+
+// write 串行写入 websocket（gorilla 不支持并发写）
+func (d *DiscordAdapter) write(conn *websocket.Conn, v interface{}) error {
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	return conn.WriteJSON(v)
+}
+
+// closeError 将连接关闭原因转换为错误，区分不可恢复的关闭码
+func (d *DiscordAdapter) closeError(err error) error {
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) {
+		return err
+	}
+
+	switch ce.Code {
+	case 4004, 4010, 4011, 4012, 4013, 4014:
+		// 鉴权失败 / 分片错误 / API 版本或 intents 非法
+		d.resetSession()
+		return &discordFatalError{code: ce.Code, text: ce.Text}
+	case 4007, 4009:
+		// 序列号非法 / 会话超时：需要重新 identify
+		d.resetSession()
+	}
+	return fmt.Errorf("Gateway 关闭 %d: %s", ce.Code, ce.Text)
+}
+
+// resetSession 丢弃 resume 状态，下次连接重新 identify
+func (d *DiscordAdapter) resetSession() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sessionID = ""
+	d.resumeURL = ""
+	d.seq = 0
+}
+
+// canResume 是否持有可恢复的会话
+func (d *DiscordAdapter) canResume() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.sessionID != ""
+}
+
+// isStopped 是否已停止
+func (d *DiscordAdapter) isStopped() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stopped
+}
+
+// discordSnowflake 校验 Discord ID 格式
+func discordSnowflake(id string) bool {
+	_, err := strconv.ParseUint(id, 10, 64)
+	return err == nil
+}
@@ -0,0 +1,171 @@
+package channel
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/gateway"
+	"github.com/gorilla/websocket"
+)
+
+// fakeDiscord 假 Discord REST API 与 Gateway
+type fakeDiscord struct {
+	server *httptest.Server
+	frames chan discordPayload         // 每个连接收到的第一帧（identify / resume）
+	out    chan discordPayload         // 推送给当前连接的帧
+	posts  chan map[string]interface{} // 发送消息的请求体，附带 channel_id
+}
+
+func newFakeDiscord(t *testing.T) *fakeDiscord {
+	f := &fakeDiscord{
+		frames: make(chan discordPayload, 1),
+		out:    make(chan discordPayload, 1),
+		posts:  make(chan map[string]interface{}, 1),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/gateway/bot", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"url": f.wsURL()})
+	})
+	mux.HandleFunc("/api/channels/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bot token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		// 与 Discord 一样拒绝引用不是 snowflake 的消息
+		if ref, ok := body["message_reference"].(map[string]interface{}); ok {
+			if id, _ := ref["message_id"].(string); !discordSnowflake(id) {
+				http.Error(w, `{"code":50035,"message":"Invalid Form Body"}`, http.StatusBadRequest)
+				return
+			}
+		}
+		body["channel_id"] = strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/channels/"), "/messages")
+		f.posts <- body
+		json.NewEncoder(w).Encode(map[string]string{"id": "1"})
+	})
+	mux.HandleFunc("/gw/", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteJSON(discordPayload{Op: discordOpHello, D: json.RawMessage(`{"heartbeat_interval":45000}`)})
+
+		var first discordPayload
+		if err := conn.ReadJSON(&first); err != nil {
+			return
+		}
+		f.frames <- first
+
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				var p discordPayload
+				if err := conn.ReadJSON(&p); err != nil {
+					return
+				}
+				if p.Op == discordOpHeartbeat {
+					conn.WriteJSON(discordPayload{Op: discordOpHeartbeatACK})
+				}
+			}
+		}()
+		for {
+			select {
+			case p := <-f.out:
+				conn.WriteJSON(p)
+			case <-closed:
+				return
+			}
+		}
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeDiscord) wsURL() string {
+	return "ws" + strings.TrimPrefix(f.server.URL, "http") + "/gw"
+}
+
+// dispatch 推送一个事件
+func (f *fakeDiscord) dispatch(t *testing.T, seq int64, event, data string) {
+	t.Helper()
+	f.out <- discordPayload{Op: discordOpDispatch, S: &seq, T: event, D: json.RawMessage(data)}
+}
+
+func TestDiscordRoundTrip(t *testing.T) {
+	api := newFakeDiscord(t)
+	g := newTestGateway(t)
+	d := NewDiscordAdapter(config.ChannelConfig{Name: "discord", Token: "token", APIBaseURL: api.server.URL + "/api"}, g)
+	g.RegisterChannel(d)
+	g.StartChannels()
+
+	identify := receive(t, api.frames)
+	var id struct {
+		Token   string `json:"token"`
+		Intents int    `json:"intents"`
+	}
+	json.Unmarshal(identify.D, &id)
+	if identify.Op != discordOpIdentify || id.Token != "token" || id.Intents != discordIntents {
+		t.Fatalf("首帧 op %d %s，期望 identify", identify.Op, identify.D)
+	}
+	api.dispatch(t, 1, "READY", `{"session_id":"sess","resume_gateway_url":"`+api.wsURL()+`","user":{"id":"900","username":"bot"}}`)
+
+	// 私聊消息回复到原频道并引用原消息
+	api.dispatch(t, 2, "MESSAGE_CREATE", `{"id":"222","channel_id":"111","content":"你好","author":{"id":"333","username":"u"}}`)
+	post := receive(t, api.posts)
+	ref, _ := post["message_reference"].(map[string]interface{})
+	if post["channel_id"] != "111" || post["content"] != "echo: 你好" || ref["message_id"] != "222" {
+		t.Fatalf("回复 %v，期望在 111 引用 222 回复 echo: 你好", post)
+	}
+
+	// 服务器中 @机器人 的消息去掉提及，标注发言人后处理
+	api.dispatch(t, 3, "MESSAGE_CREATE", `{"id":"555","channel_id":"444","guild_id":"1","content":"<@900> 早","mentions":[{"id":"900"}],"author":{"id":"333","username":"u"}}`)
+	post = receive(t, api.posts)
+	if post["channel_id"] != "444" || post["content"] != "echo: [u]: 早" {
+		t.Fatalf("回复 %v，期望在 444 回复 echo: [u]: 早", post)
+	}
+
+	// 服务端要求重连后以最后的序号 resume
+	api.out <- discordPayload{Op: discordOpReconnect}
+	resume := receive(t, api.frames)
+	var r struct {
+		SessionID string `json:"session_id"`
+		Seq       int64  `json:"seq"`
+	}
+	json.Unmarshal(resume.D, &r)
+	if resume.Op != discordOpResume || r.SessionID != "sess" || r.Seq != 3 {
+		t.Fatalf("重连首帧 op %d %s，期望 resume sess 序号 3", resume.Op, resume.D)
+	}
+}
+
+func TestDiscordNotify(t *testing.T) {
+	api := newFakeDiscord(t)
+	g := newTestGateway(t)
+	d := NewDiscordAdapter(config.ChannelConfig{Name: "discord", Token: "token", APIBaseURL: api.server.URL + "/api"}, g)
+	g.RegisterChannel(d)
+
+	// 通知没有对应的 Discord 消息，回复不带 message_reference
+	if err := g.Notify(gateway.Notification{Channel: "discord", ChatID: "444", IsGroup: true, Source: "ci", Text: "构建失败"}); err != nil {
+		t.Fatal(err)
+	}
+	post := receive(t, api.posts)
+	if post["channel_id"] != "444" || post["content"] != "构建失败" || post["message_reference"] != nil {
+		t.Fatalf("通知 %v，期望在 444 发送构建失败且不引用消息", post)
+	}
+
+	// 带 prompt 的通知由 Agent 回复，同样不引用消息
+	if err := g.Notify(gateway.Notification{Channel: "discord", ChatID: "111", UserID: "333", Text: "构建失败", Prompt: "总结"}); err != nil {
+		t.Fatal(err)
+	}
+	post = receive(t, api.posts)
+	if post["channel_id"] != "111" || post["message_reference"] != nil {
+		t.Fatalf("回复 %v，期望在 111 发送且不引用消息", post)
+	}
+}
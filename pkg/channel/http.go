@@ -0,0 +1,653 @@
+package channel
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/gateway"
+)
+
+const (
+	// 同步请求等待回复的最长时间，超时后转为异步
+	httpSyncTimeout = 2 * time.Minute
+	// 已完成的 run 保留时长
+	httpRunTTL = time.Hour
+	// 请求体上限，附件以 base64 内联
+	httpMaxBody = 32 << 20
+)
+
+// Run 状态
+const (
+	runPending   = "pending"
+	runApproval  = "awaiting_approval"
+	runCompleted = "completed"
+	runFailed    = "failed"
+)
+
+// runDropped 排队中被过载策略丢弃的 run 的失败原因
+const runDropped = "dropped"
+
+// apiAttachment JSON API 中的附件，内容以 base64 编码
+type apiAttachment struct {
+	FileName string `json:"file_name"`
+	MIMEType string `json:"mime_type"`
+	Size     int64  `json:"size,omitempty"`
+	Data     string `json:"data"`
+}
+
+// httpRun 一次消息处理
+type httpRun struct {
+	ID             string                   `json:"run_id"`
+	ConversationID string                   `json:"conversation_id"`
+	Status         string                   `json:"status"`
+	Reply          string                   `json:"reply,omitempty"`
+	Attachments    []apiAttachment          `json:"attachments,omitempty"`
+	Approval       *gateway.ApprovalRequest `json:"approval,omitempty"`
+	Error          string                   `json:"error,omitempty"` // failed 时的原因，如 dropped
+	CreatedAt      time.Time                `json:"created_at"`
+	CompletedAt    *time.Time               `json:"completed_at,omitempty"`
+
+	// caller 发起请求的调用方，由 API Key 派生
+	caller string
+	// idemKey 客户端提供的 Idempotency-Key，与调用方和会话 ID 组合后唯一
+	idemKey string
+
+	done chan struct{}
+	// approval 首次等待审批时关闭，同步请求随即返回 202
+	approval chan struct{}
+}
+
+// HTTPAdapter HTTP REST 频道适配器
+//
+// 供内部服务以编程方式调用 Agent：
+//
+//	POST /v1/conversations/{id}/messages  发送消息（默认同步返回回复，async=true 时返回 run ID）
+//	                                      附件以 attachments: [{file_name, mime_type, data(base64)}] 内联
+//	GET  /v1/runs/{id}                    查询 run 状态与回复（awaiting_approval 时附带 approval）
+//	POST /v1/approvals/{id}               提交审批决定 {"decision": "approve|deny|always"}
+//	GET  /v1/status                       网关消息队列状态
+//	GET  /v1/ratelimits                   各用户、会话的限流状态（需 admin_keys）
+//	POST /v1/notify                       向其他频道的会话推送通知（需 notify_keys），
+//	                                      {channel, chat_id, text, prompt?, ...}，带 prompt 时由 Agent 处理
+//
+// 请求需携带 Authorization: Bearer <key> 或 X-API-Key 头。发送消息时可携带
+// Idempotency-Key 头，同一会话内相同的 key 在 run 保留期内只处理一次，重试返回原来的 run。
+type HTTPAdapter struct {
+	name       string
+	listen     string
+	apiKeys    []string
+	adminKeys  []string
+	notifyKeys []string
+	gateway    *gateway.Gateway
+
+	mu     sync.Mutex
+	runs   map[string]*httpRun
+	keys   map[string]string // 会话 ID + Idempotency-Key → run ID
+	server *http.Server
+}
+
+// NewHTTPAdapter 创建 HTTP 适配器
+func NewHTTPAdapter(cfg config.ChannelConfig, gw *gateway.Gateway) (*HTTPAdapter, error) {
+	if cfg.Listen == "" {
+		return nil, fmt.Errorf("频道 %s: 缺少 listen", cfg.Name)
+	}
+	if len(cfg.APIKeys) == 0 {
+		return nil, fmt.Errorf("频道 %s: 至少需要配置一个 api_keys", cfg.Name)
+	}
+
+	return &HTTPAdapter{
+		name:       cfg.Name,
+		listen:     cfg.Listen,
+		apiKeys:    cfg.APIKeys,
+		adminKeys:  cfg.AdminKeys,
+		notifyKeys: cfg.NotifyKeys,
+		gateway:    gw,
+		runs:       make(map[string]*httpRun),
+		keys:       make(map[string]string),
+	}, nil
+}
+
+// Name 适配器名称
+func (h *HTTPAdapter) Name() string {
+	return h.name
+}
+
+// Start 启动 HTTP 服务
+func (h *HTTPAdapter) Start() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/conversations/", h.requireKey(h.handleConversation))
+	mux.HandleFunc("/v1/runs/", h.requireKey(h.handleRun))
+	mux.HandleFunc("/v1/approvals/", h.requireKey(h.handleApproval))
+	mux.HandleFunc("/v1/status", h.requireKey(h.handleStatus))
+	if len(h.adminKeys) > 0 {
+		mux.HandleFunc("/v1/ratelimits", requireKeys(h.adminKeys, "缺少或无效的管理密钥", h.handleRateLimits))
+	}
+	if len(h.notifyKeys) > 0 {
+		mux.HandleFunc("/v1/notify", requireKeys(h.notifyKeys, "缺少或无效的通知密钥", h.handleNotify))
+	}
+
+	server := &http.Server{Addr: h.listen, Handler: mux}
+
+	h.mu.Lock()
+	h.server = server
+	h.mu.Unlock()
+
+	log.Printf("[%s] HTTP API 监听 %s", h.name, h.listen)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Stop 关闭 HTTP 服务
+func (h *HTTPAdapter) Stop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.server != nil {
+		h.server.Close()
+	}
+}
+
+// Send 实现 gateway.Channel，将回复写入对应的 run
+func (h *HTTPAdapter) Send(reply gateway.Reply) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	run, ok := h.runs[reply.ReplyToID]
+	if !ok {
+		// 定时任务、通知等主动发起的运行没有等待中的请求，记为新的 run 供 /v1/runs/{id} 查询
+		id := reply.ReplyToID
+		if id == "" {
+			id = newID()
+		}
+		run = &httpRun{
+			ID:             id,
+			ConversationID: reply.ChatID,
+			Status:         runPending,
+			CreatedAt:      time.Now(),
+			done:           make(chan struct{}),
+			approval:       make(chan struct{}),
+		}
+		h.runs[run.ID] = run
+	}
+
+	// 被合并处理的 run 共享同一个回复
+	attachments := encodeAttachments(reply.Attachments)
+	h.completeLocked(run, reply.Text, attachments)
+	for _, id := range reply.CoalescedIDs {
+		if run, ok := h.runs[id]; ok {
+			h.completeLocked(run, reply.Text, attachments)
+		}
+	}
+	return nil
+}
+
+// SendApproval 实现 gateway.ApprovalSender，将审批请求挂到 run 上，等待客户端提交决定
+func (h *HTTPAdapter) SendApproval(msg gateway.Message, req gateway.ApprovalRequest) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	run, ok := h.runs[msg.ID]
+	if !ok || run.CompletedAt != nil {
+		return fmt.Errorf("没有等待回复的 run: %s", msg.ID)
+	}
+	run.Status = runApproval
+	run.Approval = &req
+	select {
+	case <-run.approval:
+	default:
+		close(run.approval)
+	}
+	return nil
+}
+
+// ReportDropped 实现 gateway.DropReporter，将被丢弃的 run 标记为失败，reply 为繁忙提示
+func (h *HTTPAdapter) ReportDropped(msg gateway.Message, notice string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, id := range append([]string{msg.ID}, msg.CoalescedIDs...) {
+		if run, ok := h.runs[id]; ok && run.CompletedAt == nil {
+			run.Error = runDropped
+			h.finishLocked(run, runFailed, notice, nil)
+		}
+	}
+	return nil
+}
+
+// completeLocked 将 run 标记为已完成，调用方需持有锁
+func (h *HTTPAdapter) completeLocked(run *httpRun, text string, attachments []apiAttachment) {
+	h.finishLocked(run, runCompleted, text, attachments)
+}
+
+// finishLocked 以 status 结束 run，调用方需持有锁
+func (h *HTTPAdapter) finishLocked(run *httpRun, status, text string, attachments []apiAttachment) {
+	if run.CompletedAt != nil {
+		return
+	}
+	run.Status = status
+	run.Reply = text
+	run.Attachments = attachments
+	run.Approval = nil
+	now := time.Now()
+	run.CompletedAt = &now
+	close(run.done)
+}
+
+// handleConversation 处理 POST /v1/conversations/{id}/messages
+func (h *HTTPAdapter) handleConversation(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/conversations/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "messages" {
+		writeError(w, http.StatusNotFound, "not_found", "未知的路径")
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "仅支持 POST")
+		return
+	}
+	conversationID := parts[0]
+	// 用户身份取自鉴权的 API Key，会话 ID 由客户端自选，不能用来冒充其他用户
+	caller := keyCaller(requestKey(r))
+
+	var body struct {
+		Text        string          `json:"text"`
+		Attachments []apiAttachment `json:"attachments"`
+		Async       bool            `json:"async"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, httpMaxBody)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "请求体不是合法的 JSON")
+		return
+	}
+	if strings.TrimSpace(body.Text) == "" && len(body.Attachments) == 0 {
+		writeError(w, http.StatusBadRequest, "invalid_request", "text 和 attachments 不能同时为空")
+		return
+	}
+	attachments, err := decodeAttachments(body.Attachments)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	async := body.Async || r.URL.Query().Get("async") == "true"
+
+	run, retried := h.newRun(caller, conversationID, r.Header.Get("Idempotency-Key"))
+	if retried {
+		log.Printf("[%s] 重复请求 %s，返回已有的 run %s", h.name, r.Header.Get("Idempotency-Key"), run.ID)
+		h.respondRun(w, r, run, async)
+		return
+	}
+
+	err = h.gateway.HandleMessage(gateway.Message{
+		ID:          run.ID,
+		UserID:      caller,
+		ChatID:      conversationID,
+		ClientChat:  true,
+		Text:        body.Text,
+		Channel:     h.name,
+		Timestamp:   run.CreatedAt,
+		Attachments: attachments,
+	})
+	if err != nil {
+		// 未被接受的消息允许客户端用同一个 Idempotency-Key 重试
+		h.discardRun(run)
+	}
+	var limited *gateway.RateLimitError
+	switch {
+	case errors.As(err, &limited):
+		w.Header().Set("Retry-After", retryAfterSeconds(limited.RetryAfter))
+		writeError(w, http.StatusTooManyRequests, "rate_limited", err.Error())
+		return
+	case errors.Is(err, gateway.ErrBusy):
+		w.Header().Set("Retry-After", "5")
+		writeError(w, http.StatusTooManyRequests, "busy", err.Error())
+		return
+	case errors.Is(err, gateway.ErrForbidden):
+		writeError(w, http.StatusForbidden, "forbidden", err.Error())
+		return
+	case errors.Is(err, gateway.ErrShuttingDown):
+		writeError(w, http.StatusServiceUnavailable, "shutting_down", err.Error())
+		return
+	}
+
+	h.respondRun(w, r, run, async)
+}
+
+// respondRun 同步请求等待回复，异步或等待超时时返回 202 和 run 状态
+func (h *HTTPAdapter) respondRun(w http.ResponseWriter, r *http.Request, run *httpRun, async bool) {
+	if !async {
+		select {
+		case <-run.done:
+			// 与入队时被拒绝一样返回 429，客户端可以重试
+			if snap := h.snapshot(run.ID); snap != nil && snap.Status == runFailed {
+				w.Header().Set("Retry-After", "5")
+				writeError(w, http.StatusTooManyRequests, "busy", snap.Reply)
+			} else {
+				writeJSON(w, http.StatusOK, snap)
+			}
+			return
+		case <-run.approval:
+			// 等待审批时转为异步，客户端提交决定后继续轮询
+		case <-r.Context().Done():
+			return
+		case <-time.After(httpSyncTimeout):
+			// 超时转为异步，客户端可继续轮询
+		}
+	}
+
+	w.Header().Set("Location", "/v1/runs/"+run.ID)
+	writeJSON(w, http.StatusAccepted, h.snapshot(run.ID))
+}
+
+// handleRun 处理 GET /v1/runs/{id}
+func (h *HTTPAdapter) handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "仅支持 GET")
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/v1/runs/")
+	run := h.snapshot(id)
+	if run == nil {
+		writeError(w, http.StatusNotFound, "run_not_found", "run 不存在或已过期")
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
+
+// handleApproval 处理 POST /v1/approvals/{id}
+func (h *HTTPAdapter) handleApproval(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "仅支持 POST")
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/v1/approvals/")
+	var body struct {
+		Decision string `json:"decision"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "请求体不是合法的 JSON")
+		return
+	}
+	d, ok := gateway.ParseDecision(body.Decision)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid_request", "decision 必须是 approve、deny 或 always")
+		return
+	}
+
+	// 只有发起请求的 API Key 能提交决定
+	_, msg, ok := h.gateway.PendingApproval(id)
+	if !ok || msg.Channel != h.name || msg.UserID != keyCaller(requestKey(r)) {
+		writeError(w, http.StatusNotFound, "approval_not_found", gateway.ErrApprovalNotFound.Error())
+		return
+	}
+	if err := h.gateway.ResolveApproval(h.name, msg.UserID, id, d); err != nil {
+		writeError(w, http.StatusNotFound, "approval_not_found", err.Error())
+		return
+	}
+
+	h.mu.Lock()
+	if run, ok := h.runs[msg.ID]; ok && run.CompletedAt == nil {
+		run.Status = runPending
+		run.Approval = nil
+	}
+	h.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":       id,
+		"decision": d,
+		"run_id":   msg.ID,
+	})
+}
+
+// handleStatus 处理 GET /v1/status
+func (h *HTTPAdapter) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "仅支持 GET")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"queue": h.gateway.QueueStats(),
+	})
+}
+
+// handleRateLimits 处理 GET /v1/ratelimits，返回生效的限额与未补满的令牌桶
+func (h *HTTPAdapter) handleRateLimits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "仅支持 GET")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.gateway.RateLimitStats())
+}
+
+// handleNotify 处理 POST /v1/notify
+//
+// 纯文本通知发送后返回 200；带 prompt 的通知进入队列后返回 202，Agent 的回复直接发到目标会话。
+func (h *HTTPAdapter) handleNotify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "仅支持 POST")
+		return
+	}
+
+	var n gateway.Notification
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, httpMaxBody)).Decode(&n); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "请求体不是合法的 JSON")
+		return
+	}
+
+	err := h.gateway.Notify(n)
+	switch {
+	case err == nil && strings.TrimSpace(n.Prompt) != "":
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "queued"})
+	case err == nil:
+		writeJSON(w, http.StatusOK, map[string]string{"status": "sent"})
+	case errors.Is(err, gateway.ErrInvalidNotify):
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+	case errors.Is(err, gateway.ErrChannelNotFound):
+		writeError(w, http.StatusNotFound, "channel_not_found", err.Error())
+	case errors.Is(err, gateway.ErrForbidden):
+		writeError(w, http.StatusForbidden, "forbidden", err.Error())
+	case errors.Is(err, gateway.ErrBusy):
+		w.Header().Set("Retry-After", "5")
+		writeError(w, http.StatusTooManyRequests, "busy", err.Error())
+	case errors.Is(err, gateway.ErrShuttingDown):
+		writeError(w, http.StatusServiceUnavailable, "shutting_down", err.Error())
+	default:
+		log.Printf("[%s] 推送通知到 %s/%s 失败: %v", h.name, n.Channel, n.ChatID, err)
+		writeError(w, http.StatusBadGateway, "send_failed", err.Error())
+	}
+}
+
+// newRun 创建 run 并顺带清理过期记录
+//
+// idemKey 非空且同一调用方的同一会话中已有对应的 run 时返回该 run 和 true。
+func (h *HTTPAdapter) newRun(caller, conversationID, idemKey string) (*httpRun, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	for _, run := range h.runs {
+		expired := run.CompletedAt != nil && now.Sub(*run.CompletedAt) > httpRunTTL
+		// 没有收到回复的 pending run（如网关重启前排队的消息）按创建时间过期
+		stale := run.CompletedAt == nil && now.Sub(run.CreatedAt) > httpRunTTL
+		if expired || stale {
+			h.discardRunLocked(run)
+		}
+	}
+
+	if idemKey != "" {
+		if run, ok := h.runs[h.keys[runKey(caller, conversationID, idemKey)]]; ok {
+			return run, true
+		}
+	}
+
+	run := &httpRun{
+		ID:             newID(),
+		ConversationID: conversationID,
+		Status:         runPending,
+		CreatedAt:      now,
+		caller:         caller,
+		idemKey:        idemKey,
+		done:           make(chan struct{}),
+		approval:       make(chan struct{}),
+	}
+	h.runs[run.ID] = run
+	if idemKey != "" {
+		h.keys[runKey(caller, conversationID, idemKey)] = run.ID
+	}
+	return run, false
+}
+
+// runKey Idempotency-Key 的索引键
+func runKey(caller, conversationID, idemKey string) string {
+	return caller + ":" + conversationID + ":" + idemKey
+}
+
+// discardRun 删除 run 及其 Idempotency-Key
+func (h *HTTPAdapter) discardRun(run *httpRun) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.discardRunLocked(run)
+}
+
+// discardRunLocked 删除 run 及其 Idempotency-Key，调用方需持有锁
+func (h *HTTPAdapter) discardRunLocked(run *httpRun) {
+	delete(h.runs, run.ID)
+	if run.idemKey != "" {
+		delete(h.keys, runKey(run.caller, run.ConversationID, run.idemKey))
+	}
+}
+
+// snapshot 返回 run 的只读副本
+func (h *HTTPAdapter) snapshot(id string) *httpRun {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	run, ok := h.runs[id]
+	if !ok {
+		return nil
+	}
+	cp := *run
+	return &cp
+}
+
+// requireKey API Key 鉴权中间件
+func (h *HTTPAdapter) requireKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAPIKey(r, h.apiKeys) {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "缺少或无效的 API Key")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requireKeys 只接受指定密钥的鉴权中间件，用于管理、通知等高权限接口
+func requireKeys(keys []string, message string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAPIKey(r, keys) {
+			writeError(w, http.StatusUnauthorized, "unauthorized", message)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requestKey 请求中携带的 API Key，Authorization 头优先
+func requestKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// checkAPIKey 校验请求中的 API Key
+func checkAPIKey(r *http.Request, keys []string) bool {
+	key := requestKey(r)
+	if key == "" {
+		return false
+	}
+
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSON 输出 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError 输出 JSON 错误响应
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]string{
+			"code":    code,
+			"message": message,
+		},
+	})
+}
+
+// decodeAttachments 解码请求中的 base64 附件
+func decodeAttachments(in []apiAttachment) ([]gateway.Attachment, error) {
+	var atts []gateway.Attachment
+	for i, a := range in {
+		data, err := base64.StdEncoding.DecodeString(a.Data)
+		if err != nil {
+			return nil, fmt.Errorf("attachments[%d].data 不是合法的 base64", i)
+		}
+		if len(data) > gateway.MaxAttachmentSize {
+			return nil, fmt.Errorf("attachments[%d] 超过 %d 字节", i, gateway.MaxAttachmentSize)
+		}
+		mimeType := a.MIMEType
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+		atts = append(atts, gateway.Attachment{
+			Kind:     gateway.KindOf(mimeType),
+			MIMEType: mimeType,
+			Size:     int64(len(data)),
+			FileName: a.FileName,
+			Open: func(ctx context.Context) (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(data)), nil
+			},
+		})
+	}
+	return atts, nil
+}
+
+// encodeAttachments 将回复附件编码为 base64，读取失败的附件跳过
+func encodeAttachments(in []gateway.Attachment) []apiAttachment {
+	var atts []apiAttachment
+	for _, a := range in {
+		data, err := a.Read(context.Background())
+		if err != nil {
+			log.Printf("读取附件 %s 失败: %v", a.FileName, err)
+			continue
+		}
+		atts = append(atts, apiAttachment{
+			FileName: a.FileName,
+			MIMEType: a.MIMEType,
+			Size:     int64(len(data)),
+			Data:     base64.StdEncoding.EncodeToString(data),
+		})
+	}
+	return atts
+}
@@ -0,0 +1,97 @@
+package channel
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/gateway"
+)
+
+func TestHTTPConversationCaller(t *testing.T) {
+	g := newTestGateway(t)
+	cfg := config.ChannelConfig{
+		Name:    "http",
+		Listen:  ":0",
+		APIKeys: []string{"alice", "bob"},
+		Access:  config.AccessConfig{AllowUsers: []string{keyCaller("alice")}},
+	}
+	g.Configure(&config.Config{Channels: []config.ChannelConfig{cfg}})
+	h, err := NewHTTPAdapter(cfg, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.RegisterChannel(h)
+	handler := h.requireKey(h.handleConversation)
+
+	post := func(key, conversation string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/conversations/"+conversation+"/messages", strings.NewReader(`{"text":"hi"}`))
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	// 会话 ID 与被允许的调用方相同也不能冒充
+	if rec := post("bob", keyCaller("alice")); rec.Code != http.StatusForbidden {
+		t.Fatalf("bob 的请求状态码 %d，期望 403: %s", rec.Code, rec.Body)
+	}
+
+	rec := post("alice", "demo")
+	var run httpRun
+	if err := json.NewDecoder(rec.Body).Decode(&run); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("alice 的请求状态码 %d: %v", rec.Code, err)
+	}
+	if run.Reply != "echo: hi" {
+		t.Fatalf("回复 %q", run.Reply)
+	}
+
+	msg := gateway.Message{Channel: "http", ChatID: "demo", ClientChat: true}
+	msg.UserID = keyCaller("alice")
+	if g.SessionOf(msg) == nil {
+		t.Fatal("alice 的会话不存在")
+	}
+	msg.UserID = keyCaller("bob")
+	if g.SessionOf(msg) != nil {
+		t.Fatal("bob 通过相同的会话 ID 读到了 alice 的会话")
+	}
+}
+
+func TestHTTPDroppedRun(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "test")
+	// 网关未启动，消息留在队列中
+	g := gateway.New()
+	cfg := config.ChannelConfig{Name: "http", Listen: ":0", APIKeys: []string{"secret"}}
+	g.Configure(&config.Config{
+		Gateway:  config.GatewayConfig{QueueSize: 1, Overload: gateway.OverloadDropOldest},
+		Channels: []config.ChannelConfig{cfg},
+	})
+	h, err := NewHTTPAdapter(cfg, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.RegisterChannel(h)
+
+	post := func(conversation string) httpRun {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/v1/conversations/"+conversation+"/messages", strings.NewReader(`{"text":"hi","async":true}`))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		h.requireKey(h.handleConversation)(rec, req)
+		var run httpRun
+		if err := json.NewDecoder(rec.Body).Decode(&run); err != nil || rec.Code != http.StatusAccepted {
+			t.Fatalf("状态码 %d: %v", rec.Code, err)
+		}
+		return run
+	}
+
+	first := post("a")
+	post("b")
+	run := h.snapshot(first.ID)
+	if run.Status != runFailed || run.Error != runDropped || run.Reply == "" {
+		t.Fatalf("被丢弃的 run %+v，期望 failed / dropped 并附繁忙提示", run)
+	}
+}
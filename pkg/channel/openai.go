@@ -0,0 +1,318 @@
+package channel
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/agent"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/gateway"
+)
+
+// OpenAIAdapter OpenAI 兼容 API 门面
+//
+// 对外提供 /v1/chat/completions（含 stream: true）和 /v1/models，
+// 由网关的 Agent 执行，所有工具与技能都在服务端调用，客户端只看到最终回复。
+// 对话历史由客户端携带，因此不经过网关会话，也不支持主动发送；
+// 请求与其他频道的消息共用网关的队列、工作协程和关闭流程。
+type OpenAIAdapter struct {
+	name    string
+	listen  string
+	apiKeys []string
+	gateway *gateway.Gateway
+
+	mu     sync.Mutex
+	server *http.Server
+}
+
+// NewOpenAIAdapter 创建 OpenAI 兼容适配器
+func NewOpenAIAdapter(cfg config.ChannelConfig, gw *gateway.Gateway) (*OpenAIAdapter, error) {
+	if cfg.Listen == "" {
+		return nil, fmt.Errorf("频道 %s: 缺少 listen", cfg.Name)
+	}
+	if len(cfg.APIKeys) == 0 {
+		return nil, fmt.Errorf("频道 %s: 至少需要配置一个 api_keys", cfg.Name)
+	}
+
+	return &OpenAIAdapter{
+		name:    cfg.Name,
+		listen:  cfg.Listen,
+		apiKeys: cfg.APIKeys,
+		gateway: gw,
+	}, nil
+}
+
+// Name 适配器名称
+func (o *OpenAIAdapter) Name() string {
+	return o.name
+}
+
+// Start 启动 HTTP 服务
+func (o *OpenAIAdapter) Start() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/models", o.requireKey(o.handleModels))
+	mux.HandleFunc("/v1/chat/completions", o.requireKey(o.handleChatCompletions))
+
+	server := &http.Server{Addr: o.listen, Handler: mux}
+
+	o.mu.Lock()
+	o.server = server
+	o.mu.Unlock()
+
+	log.Printf("[%s] OpenAI 兼容 API 监听 %s", o.name, o.listen)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Stop 关闭 HTTP 服务
+func (o *OpenAIAdapter) Stop() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.server != nil {
+		o.server.Close()
+	}
+}
+
+// Send 请求-响应式 API 不支持主动发送
+func (o *OpenAIAdapter) Send(reply gateway.Reply) error {
+	return fmt.Errorf("频道 %s 不支持主动发送消息", o.name)
+}
+
+// handleModels 处理 GET /v1/models
+func (o *OpenAIAdapter) handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "仅支持 GET")
+		return
+	}
+
+	caller := keyCaller(requestKey(r))
+	role, err := o.gateway.Authorize(o.name, caller, caller)
+	if err != nil {
+		writeOpenAIError(w, http.StatusForbidden, "permission_error", err.Error())
+		return
+	}
+
+	// 默认模型之外，调用方可用的每个 Agent 配置以配置名作为一个模型
+	ids := []string{o.gateway.Agent().Model()}
+	for _, name := range o.gateway.AgentNames() {
+		if o.gateway.AgentAllowed(o.name, caller, caller, role, name) {
+			ids = append(ids, name)
+		}
+	}
+	data := make([]map[string]interface{}, 0, len(ids))
+	for _, id := range ids {
+		data = append(data, map[string]interface{}{
+			"id":       id,
+			"object":   "model",
+			"created":  0,
+			"owned_by": "mini-agent-gateway",
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"object": "list",
+		"data":   data,
+	})
+}
+
+// handleChatCompletions 处理 POST /v1/chat/completions
+func (o *OpenAIAdapter) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "仅支持 POST")
+		return
+	}
+
+	var req agent.ChatCompletionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<20)).Decode(&req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "请求体解析失败: "+err.Error())
+		return
+	}
+	if len(req.Messages) == 0 {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "messages 不能为空")
+		return
+	}
+
+	// 以 API Key 区分调用方：请求中的 user 字段由客户端填写，不能用于鉴权
+	caller := keyCaller(requestKey(r))
+	role, err := o.gateway.Authorize(o.name, caller, caller)
+	if err != nil {
+		writeOpenAIError(w, http.StatusForbidden, "permission_error", err.Error())
+		return
+	}
+	opts, model, ok := o.runOptions(req.Model, caller, role)
+	if !ok {
+		writeOpenAIErrorCode(w, http.StatusNotFound, "invalid_request_error", "model_not_found", "模型不存在: "+req.Model)
+		return
+	}
+	if err := o.gateway.CheckRateLimit(o.name, caller, caller); err != nil {
+		var limited *gateway.RateLimitError
+		if errors.As(err, &limited) {
+			w.Header().Set("Retry-After", retryAfterSeconds(limited.RetryAfter))
+		}
+		writeOpenAIError(w, http.StatusTooManyRequests, "rate_limit_error", err.Error())
+		return
+	}
+
+	id := "chatcmpl-" + newID()
+	created := time.Now().Unix()
+
+	// 与其他频道的消息共用工作协程和队列上限；网关关闭时拒绝新请求，关闭超时后取消运行中的请求。
+	// 每个请求自带完整对话，按请求 ID 单独排队，同一调用方的并发请求互不等待
+	msg := gateway.Message{ID: id, Channel: o.name, UserID: caller, ChatID: id, ClientChat: true}
+	err = o.gateway.Execute(r.Context(), msg, func(ctx context.Context) {
+		if req.Stream {
+			o.streamCompletion(ctx, w, req, opts, id, created, model)
+			return
+		}
+		o.complete(ctx, w, req, opts, id, created, model)
+	})
+	switch {
+	case errors.Is(err, gateway.ErrShuttingDown):
+		writeOpenAIError(w, http.StatusServiceUnavailable, "api_error", err.Error())
+	case errors.Is(err, gateway.ErrBusy):
+		w.Header().Set("Retry-After", "5")
+		writeOpenAIError(w, http.StatusTooManyRequests, "rate_limit_error", err.Error())
+	}
+}
+
+// complete 运行 Agent 并一次性返回回复
+func (o *OpenAIAdapter) complete(ctx context.Context, w http.ResponseWriter, req agent.ChatCompletionRequest, opts agent.RunOptions, id string, created int64, model string) {
+	reply, err := o.gateway.Agent().RunWithOptions(ctx, req.Messages, opts)
+	if err != nil {
+		log.Printf("[%s] Agent 错误: %v", o.name, err)
+		writeOpenAIError(w, http.StatusBadGateway, "api_error", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, agent.ChatCompletionResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: created,
+		Model:   model,
+		Choices: []agent.Choice{{
+			Message:      agent.Message{Role: "assistant", Content: reply},
+			FinishReason: "stop",
+		}},
+	})
+}
+
+// runOptions 按请求的 model 选择 Agent 配置，按调用方角色限制可用的工具与技能
+//
+// model 为调用方可用的 Agent 配置名（路由为其选择的配置，管理员可用所有配置）时使用该配置；
+// 为空或等于路由选中的模型时按路由规则选择；其他模型对调用方不存在，返回 false。
+func (o *OpenAIAdapter) runOptions(model, caller, role string) (agent.RunOptions, string, bool) {
+	if o.gateway.AgentAllowed(o.name, caller, caller, role, model) {
+		opts, _ := o.gateway.AgentRunOptions(model, role)
+		return opts, model, true
+	}
+	opts := o.gateway.RunOptions(o.name, caller, caller, role)
+	routed := opts.Model
+	if routed == "" {
+		routed = o.gateway.Agent().Model()
+	}
+	if model != "" && model != routed {
+		return agent.RunOptions{}, "", false
+	}
+	return opts, routed, true
+}
+
+// keyCaller 由 API Key 派生的调用方 ID：key- 加密钥 SHA-256 的前 12 位十六进制
+func keyCaller(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key-" + hex.EncodeToString(sum[:])[:12]
+}
+
+// streamCompletion 以 SSE 推送回复增量
+func (o *OpenAIAdapter) streamCompletion(ctx context.Context, w http.ResponseWriter, req agent.ChatCompletionRequest, opts agent.RunOptions, id string, created int64, model string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeOpenAIError(w, http.StatusInternalServerError, "api_error", "服务端不支持流式响应")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(delta agent.Delta, finish *string) {
+		data, _ := json.Marshal(agent.ChatCompletionChunk{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+			Choices: []agent.ChunkChoice{{Delta: delta, FinishReason: finish}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
+
+	send(agent.Delta{Role: "assistant"}, nil)
+
+	opts.Stream = true
+	opts.OnEvent = func(ev agent.Event) {
+		if ev.Type == agent.EventDelta {
+			send(agent.Delta{Content: ev.Delta}, nil)
+		}
+	}
+	_, err := o.gateway.Agent().RunWithOptions(ctx, req.Messages, opts)
+	if err != nil {
+		log.Printf("[%s] Agent 错误: %v", o.name, err)
+		data, _ := json.Marshal(openAIError("api_error", "", err.Error()))
+		fmt.Fprintf(w, "data: %s\n\n", data)
+	} else {
+		stop := "stop"
+		send(agent.Delta{}, &stop)
+	}
+
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+// requireKey API Key 鉴权中间件
+func (o *OpenAIAdapter) requireKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAPIKey(r, o.apiKeys) {
+			writeOpenAIError(w, http.StatusUnauthorized, "invalid_request_error", "缺少或无效的 API Key")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// openAIError OpenAI 格式的错误体
+//
+// code 为空时输出 null。
+func openAIError(errType, code, message string) map[string]interface{} {
+	var c interface{}
+	if code != "" {
+		c = code
+	}
+	return map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    errType,
+			"code":    c,
+		},
+	}
+}
+
+// writeOpenAIError 输出 OpenAI 格式的错误响应
+func writeOpenAIError(w http.ResponseWriter, status int, errType, message string) {
+	writeOpenAIErrorCode(w, status, errType, "", message)
+}
+
+// writeOpenAIErrorCode 输出带错误码的 OpenAI 格式错误响应
+func writeOpenAIErrorCode(w http.ResponseWriter, status int, errType, code, message string) {
+	writeJSON(w, status, openAIError(errType, code, message))
+}
@@ -0,0 +1,163 @@
+package channel
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/agent"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/gateway"
+)
+
+func newTestOpenAI(t *testing.T) *OpenAIAdapter {
+	t.Helper()
+	t.Setenv("OPENAI_API_KEY", "test")
+	o, err := NewOpenAIAdapter(config.ChannelConfig{Name: "openai", Listen: ":0", APIKeys: []string{"secret"}}, gateway.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func TestKeyCaller(t *testing.T) {
+	a, b := keyCaller("secret"), keyCaller("other")
+	if a == b {
+		t.Fatalf("不同密钥得到相同的调用方 %s", a)
+	}
+	if a != keyCaller("secret") || !strings.HasPrefix(a, "key-") || len(a) != len("key-")+12 {
+		t.Fatalf("调用方 ID 格式错误: %s", a)
+	}
+}
+
+func TestOpenAIChatCompletions(t *testing.T) {
+	o := newTestOpenAI(t)
+	handler := o.requireKey(o.handleChatCompletions)
+
+	tests := []struct {
+		name   string
+		key    string
+		body   string
+		status int
+	}{
+		{"缺少密钥", "", `{"messages":[{"role":"user","content":"hi"}]}`, http.StatusUnauthorized},
+		{"错误密钥", "wrong", `{"messages":[{"role":"user","content":"hi"}]}`, http.StatusUnauthorized},
+		{"空消息", "secret", `{"messages":[]}`, http.StatusBadRequest},
+		{"未知模型", "secret", `{"model":"nope","user":"admin","messages":[{"role":"user","content":"hi"}]}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.body))
+			if tt.key != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.key)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("状态码 %d，期望 %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+func TestOpenAIModels(t *testing.T) {
+	o := newTestOpenAI(t)
+	req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	req.Header.Set("X-API-Key", "secret")
+	rec := httptest.NewRecorder()
+	o.requireKey(o.handleModels)(rec, req)
+
+	var resp struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].ID != o.gateway.Agent().Model() {
+		t.Fatalf("模型列表 %+v，期望只有默认模型", resp.Data)
+	}
+}
+
+func TestOpenAICompletionQueued(t *testing.T) {
+	g := newTestGateway(t)
+	o, err := NewOpenAIAdapter(config.ChannelConfig{Name: "openai", Listen: ":0", APIKeys: []string{"secret"}}, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	o.requireKey(o.handleChatCompletions)(rec, req)
+
+	var resp agent.ChatCompletionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("状态码 %d: %v", rec.Code, err)
+	}
+	if len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "echo: hi" {
+		t.Fatalf("回复 %+v", resp.Choices)
+	}
+}
+
+func TestOpenAIModelAccess(t *testing.T) {
+	g := newTestGateway(t)
+	cfg := config.ChannelConfig{
+		Name:    "openai",
+		Listen:  ":0",
+		APIKeys: []string{"secret", "root"},
+		Access:  config.AccessConfig{Users: map[string]string{keyCaller("root"): config.RoleAdmin}},
+	}
+	g.Configure(&config.Config{
+		Agents:   map[string]config.AgentConfig{"ops": {}, "writer": {}},
+		Routes:   []config.RouteConfig{{Agent: "writer", Channel: "openai", Users: []string{keyCaller("secret")}}},
+		Channels: []config.ChannelConfig{cfg},
+	})
+	o, err := NewOpenAIAdapter(cfg, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key, model string
+		status     int
+	}{
+		{"secret", "writer", http.StatusOK},
+		{"secret", "ops", http.StatusNotFound},
+		{"root", "ops", http.StatusOK},
+		{"root", "nope", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		body := `{"model":"` + tt.model + `","messages":[{"role":"user","content":"hi"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+tt.key)
+		rec := httptest.NewRecorder()
+		o.requireKey(o.handleChatCompletions)(rec, req)
+		if rec.Code != tt.status {
+			t.Fatalf("%s 使用 %s: 状态码 %d，期望 %d: %s", tt.key, tt.model, rec.Code, tt.status, rec.Body)
+		}
+		if tt.status == http.StatusNotFound && !strings.Contains(rec.Body.String(), `"code":"model_not_found"`) {
+			t.Errorf("%s 使用 %s: 错误码不是 model_not_found: %s", tt.key, tt.model, rec.Body)
+		}
+	}
+
+	// 模型列表只包含调用方可用的配置
+	req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	o.requireKey(o.handleModels)(rec, req)
+	var resp struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 2 || resp.Data[1].ID != "writer" {
+		t.Fatalf("模型列表 %+v，期望默认模型和 writer", resp.Data)
+	}
+}
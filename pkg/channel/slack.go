@@ -0,0 +1,643 @@
+package channel
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/gateway"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	slackAPIBase      = "https://slack.com/api"
+	slackMessageLimit = 4000
+
+	// 请求时间戳允许的最大偏差，防重放
+	slackMaxClockSkew = 5 * time.Minute
+
+	// 机器人回复过的线程保持"已提及"状态的时长
+	slackThreadTTL = 24 * time.Hour
+)
+
+// slackEventCallback Events API 回调体（Socket Mode 的 events_api payload 相同）
+type slackEventCallback struct {
+	Type      string     `json:"type"`
+	Challenge string     `json:"challenge"`
+	TeamID    string     `json:"team_id"`
+	Event     slackEvent `json:"event"`
+}
+
+// slackEvent 消息事件
+type slackEvent struct {
+	Type        string `json:"type"`
+	Subtype     string `json:"subtype"`
+	User        string `json:"user"`
+	BotID       string `json:"bot_id"`
+	Text        string `json:"text"`
+	Channel     string `json:"channel"`
+	ChannelType string `json:"channel_type"`
+	TS          string `json:"ts"`
+	ThreadTS    string `json:"thread_ts"`
+	Team        string `json:"team"`
+	// message_changed 事件中编辑后的消息，message_deleted 事件中被删除消息的 ts
+	Message   *slackEvent `json:"message"`
+	DeletedTS string      `json:"deleted_ts"`
+	Edited    *struct {
+		TS string `json:"ts"`
+	} `json:"edited"`
+	Files []struct {
+		Name       string `json:"name"`
+		Mimetype   string `json:"mimetype"`
+		Size       int64  `json:"size"`
+		URLPrivate string `json:"url_private"`
+	} `json:"files"`
+}
+
+// slackEnvelope Socket Mode 帧
+type slackEnvelope struct {
+	EnvelopeID string          `json:"envelope_id"`
+	Type       string          `json:"type"`
+	Reason     string          `json:"reason"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// SlackAdapter Slack 频道适配器
+//
+// 支持两种接收模式：
+//   - socket: 通过 Socket Mode websocket 接收事件，无需公网地址
+//   - events: 提供 Events API HTTP 回调，校验 signing secret
+//
+// 回复统一通过 chat.postMessage 以 mrkdwn 发送，线程（thread_ts）作为会话键。
+type SlackAdapter struct {
+	name          string
+	token         string
+	appToken      string
+	signingSecret string
+	mode          string
+	listen        string
+	path          string
+	apiBase       string
+	gateway       *gateway.Gateway
+	httpClient    *http.Client
+
+	mu      sync.Mutex
+	botID   string
+	threads map[string]time.Time // 机器人回复过的线程 → 最近回复时间
+	conn    *websocket.Conn
+	server  *http.Server
+	stopped bool
+}
+
+// NewSlackAdapter 创建 Slack 适配器
+func NewSlackAdapter(cfg config.ChannelConfig, gw *gateway.Gateway) (*SlackAdapter, error) {
+	mode := cfg.Mode
+	if mode == "" {
+		mode = "socket"
+	}
+
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("频道 %s: 缺少 token", cfg.Name)
+	}
+	switch mode {
+	case "socket":
+		if cfg.AppToken == "" {
+			return nil, fmt.Errorf("频道 %s: socket 模式需要 app_token", cfg.Name)
+		}
+	case "events":
+		if cfg.SigningSecret == "" || cfg.Listen == "" {
+			return nil, fmt.Errorf("频道 %s: events 模式需要 signing_secret 和 listen", cfg.Name)
+		}
+	default:
+		return nil, fmt.Errorf("频道 %s: 不支持的 Slack 模式 %q", cfg.Name, mode)
+	}
+
+	apiBase := cfg.APIBaseURL
+	if apiBase == "" {
+		apiBase = slackAPIBase
+	}
+	path := cfg.Path
+	if path == "" {
+		path = "/slack/events"
+	}
+
+	return &SlackAdapter{
+		name:          cfg.Name,
+		token:         cfg.Token,
+		appToken:      cfg.AppToken,
+		signingSecret: cfg.SigningSecret,
+		mode:          mode,
+		listen:        cfg.Listen,
+		path:          path,
+		apiBase:       strings.TrimRight(apiBase, "/"),
+		gateway:       gw,
+		httpClient:    &http.Client{Timeout: 30 * time.Second},
+		threads:       make(map[string]time.Time),
+	}, nil
+}
+
+// Name 适配器名称
+func (s *SlackAdapter) Name() string {
+	return s.name
+}
+
+// Start 校验 token 后按配置模式接收事件
+func (s *SlackAdapter) Start() error {
+	var auth struct {
+		UserID string `json:"user_id"`
+		User   string `json:"user"`
+		Team   string `json:"team"`
+	}
+	if err := s.api("auth.test", s.token, nil, &auth); err != nil {
+		return fmt.Errorf("Slack 鉴权失败: %w", err)
+	}
+	s.mu.Lock()
+	s.botID = auth.UserID
+	s.mu.Unlock()
+	log.Printf("[%s] 已授权 Slack Bot: %s (%s)", s.name, auth.User, auth.Team)
+
+	if s.mode == "events" {
+		return s.serveEvents()
+	}
+
+	for {
+		err := s.socketSession()
+		if s.isStopped() {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// 服务端要求刷新连接，立即重连
+		log.Printf("[%s] Socket Mode 连接刷新", s.name)
+	}
+}
+
+// Stop 停止接收事件
+func (s *SlackAdapter) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stopped = true
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	if s.server != nil {
+		s.server.Close()
+	}
+}
+
+// socketSession 运行一次 Socket Mode 连接
+//
+// 收到 disconnect 帧时返回 nil 表示需要重连，连接异常时返回错误。
+func (s *SlackAdapter) socketSession() error {
+	var open struct {
+		URL string `json:"url"`
+	}
+	if err := s.api("apps.connections.open", s.appToken, nil, &open); err != nil {
+		return fmt.Errorf("打开 Socket Mode 连接: %w", err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(open.URL, nil)
+	if err != nil {
+		return fmt.Errorf("连接 Socket Mode: %w", err)
+	}
+	defer conn.Close()
+
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return nil
+	}
+	s.conn = conn
+	s.mu.Unlock()
+
+	for {
+		var env slackEnvelope
+		if err := conn.ReadJSON(&env); err != nil {
+			return fmt.Errorf("读取 Socket Mode 帧: %w", err)
+		}
+
+		// 带 envelope_id 的帧必须在 3 秒内确认
+		if env.EnvelopeID != "" {
+			ack := map[string]string{"envelope_id": env.EnvelopeID}
+			if err := conn.WriteJSON(ack); err != nil {
+				return fmt.Errorf("确认事件: %w", err)
+			}
+		}
+
+		switch env.Type {
+		case "hello":
+			log.Printf("[%s] Socket Mode 已连接", s.name)
+		case "disconnect":
+			log.Printf("[%s] 服务端断开 Socket Mode: %s", s.name, env.Reason)
+			return nil
+		case "events_api":
+			var cb slackEventCallback
+			if err := json.Unmarshal(env.Payload, &cb); err != nil {
+				log.Printf("[%s] 解析事件失败: %v", s.name, err)
+				continue
+			}
+			s.handleEvent(cb)
+		}
+	}
+}
+
+// serveEvents 提供 Events API HTTP 回调
+func (s *SlackAdapter) serveEvents() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(s.path, s.handleHTTP)
+
+	server := &http.Server{Addr: s.listen, Handler: mux}
+
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return nil
+	}
+	s.server = server
+	s.mu.Unlock()
+
+	log.Printf("[%s] Events API 监听 %s%s", s.name, s.listen, s.path)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// handleHTTP 处理 Events API 回调
+func (s *SlackAdapter) handleHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "read body failed", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.verifySignature(r.Header, body); err != nil {
+		log.Printf("[%s] 拒绝请求: %v", s.name, err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var cb slackEventCallback
+	if err := json.Unmarshal(body, &cb); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	switch cb.Type {
+	case "url_verification":
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(cb.Challenge))
+		return
+	case "event_callback":
+		s.handleEvent(cb)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// verifySignature 校验 X-Slack-Signature（v0 HMAC-SHA256）
+func (s *SlackAdapter) verifySignature(h http.Header, body []byte) error {
+	ts := h.Get("X-Slack-Request-Timestamp")
+	sig := h.Get("X-Slack-Signature")
+	if ts == "" || sig == "" {
+		return fmt.Errorf("缺少签名头")
+	}
+
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("无效的时间戳: %s", ts)
+	}
+	if skew := time.Since(time.Unix(sec, 0)); skew > slackMaxClockSkew || skew < -slackMaxClockSkew {
+		return fmt.Errorf("时间戳超出允许范围: %s", ts)
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.signingSecret))
+	mac.Write([]byte("v0:" + ts + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return fmt.Errorf("签名不匹配")
+	}
+	return nil
+}
+
+// handleEvent 将 Slack 消息事件转换为网关消息
+func (s *SlackAdapter) handleEvent(cb slackEventCallback) {
+	ev := cb.Event
+	if ev.Type != "message" {
+		return
+	}
+
+	switch ev.Subtype {
+	case "message_deleted":
+		s.gateway.HandleDelete(s.name, ev.Channel, ev.DeletedTS)
+		return
+	case "message_changed":
+		// 展开链接预览等也会产生 message_changed，只处理用户的编辑
+		if ev.Message == nil || ev.Message.Edited == nil {
+			return
+		}
+		inner := *ev.Message
+		inner.Channel, inner.ChannelType = ev.Channel, ev.ChannelType
+		ev = inner
+	}
+
+	s.mu.Lock()
+	botID := s.botID
+	_, inBotThread := s.threads[ev.ThreadTS]
+	s.mu.Unlock()
+
+	// 忽略机器人消息和其他子类型事件，带文件的消息除外
+	if ev.BotID != "" || (ev.Subtype != "" && ev.Subtype != "file_share") || ev.User == "" || ev.User == botID {
+		return
+	}
+	if ev.Text == "" && len(ev.Files) == 0 {
+		return
+	}
+
+	// 频道内的顶层消息以自身 ts 开启新线程；私聊只在用户主动开线程时使用线程
+	threadID := ev.ThreadTS
+	if threadID == "" && ev.ChannelType != "im" {
+		threadID = ev.TS
+	}
+
+	team := cb.TeamID
+	if team == "" {
+		team = ev.Team
+	}
+
+	// 群聊中 @机器人 或在机器人回复过的线程里发言视为提及
+	text := ev.Text
+	mention := "<@" + botID + ">"
+	mentioned := botID != "" && strings.Contains(text, mention)
+	if mentioned {
+		text = strings.TrimSpace(strings.ReplaceAll(text, mention, ""))
+	}
+
+	msg := gateway.Message{
+		ID:        ev.TS,
+		UserID:    ev.User,
+		UserName:  ev.User,
+		ChatID:    ev.Channel,
+		GuildID:   team,
+		ThreadID:  threadID,
+		Text:      text,
+		Channel:   s.name,
+		Timestamp: time.Now(),
+		IsGroup:   ev.ChannelType != "im",
+		Mentioned: mentioned || (ev.ThreadTS != "" && inBotThread),
+	}
+	if ev.Edited != nil {
+		msg.Edited, msg.Timestamp = true, slackTime(ev.Edited.TS)
+	}
+	// 在机器人未参与过的线程里被 @ 时，附上线程的首条消息作为引用
+	if mentioned && ev.ThreadTS != "" && ev.ThreadTS != ev.TS && !inBotThread {
+		if parent, err := s.threadParent(ev.Channel, ev.ThreadTS); err != nil {
+			log.Printf("[%s] 获取线程首条消息失败: %v", s.name, err)
+		} else {
+			msg.ReplyToID, msg.ReplyToUser, msg.ReplyToText = ev.ThreadTS, parent.User, parent.Text
+		}
+	}
+	for _, f := range ev.Files {
+		// 私有文件地址需要 Bot Token 鉴权
+		msg.Attachments = append(msg.Attachments, gateway.Attachment{
+			Kind:     gateway.KindOf(f.Mimetype),
+			MIMEType: f.Mimetype,
+			Size:     f.Size,
+			FileName: f.Name,
+			Open:     httpOpener(f.URLPrivate, http.Header{"Authorization": {"Bearer " + s.token}}),
+		})
+	}
+
+	s.gateway.HandleMessage(msg)
+
+	kind := "消息"
+	if msg.Edited {
+		kind = "编辑的消息"
+	}
+	log.Printf("[%s] 收到%s from %s: %s（%d 个附件）", s.name, kind, ev.User, ev.Text, len(msg.Attachments))
+}
+
+// slackTime 解析 "秒.微秒" 形式的 Slack 时间戳，无法解析时返回当前时间
+func slackTime(ts string) time.Time {
+	sec, frac, _ := strings.Cut(ts, ".")
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Now()
+	}
+	us, _ := strconv.ParseInt(frac, 10, 64)
+	return time.Unix(s, us*1000)
+}
+
+// Send 实现 gateway.Channel，通过 chat.postMessage 发送 mrkdwn 回复
+func (s *SlackAdapter) Send(reply gateway.Reply) error {
+	var chunks []string
+	if reply.Text != "" {
+		chunks = splitMessage(markdownToMrkdwn(reply.Text), slackMessageLimit)
+	}
+	for _, chunk := range chunks {
+		body := map[string]interface{}{
+			"channel": reply.ChatID,
+			"text":    chunk,
+			"mrkdwn":  true,
+		}
+		if reply.ThreadID != "" {
+			body["thread_ts"] = reply.ThreadID
+		}
+		if err := s.api("chat.postMessage", s.token, body, nil); err != nil {
+			return err
+		}
+	}
+
+	for _, att := range reply.Attachments {
+		if err := s.uploadFile(reply.ChatID, reply.ThreadID, att); err != nil {
+			return fmt.Errorf("上传附件 %s 失败: %w", att.FileName, err)
+		}
+	}
+
+	if reply.ThreadID != "" {
+		s.markThread(reply.ThreadID)
+	}
+	return nil
+}
+
+// threadParent 通过 conversations.replies 获取线程的首条消息
+func (s *SlackAdapter) threadParent(channelID, ts string) (slackEvent, error) {
+	form := url.Values{"channel": {channelID}, "ts": {ts}, "limit": {"1"}}
+	var out struct {
+		Messages []slackEvent `json:"messages"`
+	}
+	if err := s.do("conversations.replies", s.token, "application/x-www-form-urlencoded", []byte(form.Encode()), &out); err != nil {
+		return slackEvent{}, err
+	}
+	if len(out.Messages) == 0 {
+		return slackEvent{}, fmt.Errorf("线程 %s 不存在", ts)
+	}
+	return out.Messages[0], nil
+}
+
+// markThread 记录机器人回复过的线程，线程内后续消息无需再 @机器人
+func (s *SlackAdapter) markThread(ts string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.threads[ts] = now
+	for k, t := range s.threads {
+		if now.Sub(t) > slackThreadTTL {
+			delete(s.threads, k)
+		}
+	}
+}
+
+// uploadFile 通过外部上传流程发送文件：获取上传地址 → 上传内容 → 完成并分享到频道
+func (s *SlackAdapter) uploadFile(channelID, threadTS string, att gateway.Attachment) error {
+	data, err := att.Read(context.Background())
+	if err != nil {
+		return err
+	}
+
+	var upload struct {
+		UploadURL string `json:"upload_url"`
+		FileID    string `json:"file_id"`
+	}
+	form := url.Values{
+		"filename": {att.FileName},
+		"length":   {strconv.Itoa(len(data))},
+	}
+	if err := s.do("files.getUploadURLExternal", s.token, "application/x-www-form-urlencoded",
+		[]byte(form.Encode()), &upload); err != nil {
+		return err
+	}
+
+	resp, err := s.httpClient.Post(upload.UploadURL, "application/octet-stream", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("upload file: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("upload file: HTTP %d", resp.StatusCode)
+	}
+
+	body := map[string]interface{}{
+		"files":      []map[string]string{{"id": upload.FileID, "title": att.FileName}},
+		"channel_id": channelID,
+	}
+	if threadTS != "" {
+		body["thread_ts"] = threadTS
+	}
+	return s.api("files.completeUploadExternal", s.token, body, nil)
+}
+
+// api 以 JSON 请求体调用 Slack Web API
+func (s *SlackAdapter) api(method, token string, body, out interface{}) error {
+	payload := []byte("{}")
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+	}
+	return s.do(method, token, "application/json; charset=utf-8", payload, out)
+}
+
+// do 发送 Web API 请求，遇到 429 时按 Retry-After 重试
+func (s *SlackAdapter) do(method, token, contentType string, payload []byte, out interface{}) error {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, s.apiBase+"/"+method, bytes.NewReader(payload))
+		if err != nil {
+			return fmt.Errorf("create request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", contentType)
+
+		resp, err := s.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("do request: %w", err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < 3 {
+			wait, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+			time.Sleep(time.Duration(wait+1) * time.Second)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("Slack API %s error %d: %s", method, resp.StatusCode, string(data))
+		}
+
+		var result struct {
+			OK    bool   `json:"ok"`
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+		if !result.OK {
+			return fmt.Errorf("Slack API %s: %s", method, result.Error)
+		}
+		if out != nil {
+			if err := json.Unmarshal(data, out); err != nil {
+				return fmt.Errorf("decode response: %w", err)
+			}
+		}
+		return nil
+	}
+}
+
+// isStopped 是否已停止
+func (s *SlackAdapter) isStopped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+var (
+	mdBold    = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	mdStrike  = regexp.MustCompile(`~~(.+?)~~`)
+	mdLink    = regexp.MustCompile(`\[([^\]]+)\]\((https?://[^)\s]+)\)`)
+	mdHeading = regexp.MustCompile(`(?m)^#{1,6}\s+(.+)$`)
+)
+
+// markdownToMrkdwn 将 LLM 输出的常见 Markdown 转换为 Slack mrkdwn
+//
+// 代码块内的内容保持原样。
+func markdownToMrkdwn(text string) string {
+	parts := strings.Split(text, "```")
+	for i := range parts {
+		if i%2 == 1 {
+			continue
+		}
+		p := parts[i]
+		p = mdHeading.ReplaceAllString(p, "*$1*")
+		p = mdBold.ReplaceAllString(p, "*$1*")
+		p = mdStrike.ReplaceAllString(p, "~$1~")
+		p = mdLink.ReplaceAllString(p, "<$2|$1>")
+		parts[i] = p
+	}
+	return strings.Join(parts, "```")
+}
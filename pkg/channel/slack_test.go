@@ -0,0 +1,182 @@
+package channel
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+	"github.com/gorilla/websocket"
+)
+
+// slackSign 按 Slack v0 规则签名
+func slackSign(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + ts + ":"))
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestSlackVerifySignature(t *testing.T) {
+	s := &SlackAdapter{signingSecret: "secret"}
+	body := []byte(`{"type":"event_callback"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(10*time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name    string
+		ts      string
+		sig     string
+		body    []byte
+		wantErr bool
+	}{
+		{"有效签名", now, slackSign("secret", now, body), body, false},
+		{"缺少时间戳", "", slackSign("secret", now, body), body, true},
+		{"缺少签名", now, "", body, true},
+		{"无效的时间戳", "abc", slackSign("secret", "abc", body), body, true},
+		{"过期的请求", old, slackSign("secret", old, body), body, true},
+		{"未来的请求", future, slackSign("secret", future, body), body, true},
+		{"错误的密钥", now, slackSign("other", now, body), body, true},
+		{"请求体被篡改", now, slackSign("secret", now, body), []byte(`{"type":"url_verification"}`), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			if tt.ts != "" {
+				h.Set("X-Slack-Request-Timestamp", tt.ts)
+			}
+			if tt.sig != "" {
+				h.Set("X-Slack-Signature", tt.sig)
+			}
+			if err := s.verifySignature(h, tt.body); (err != nil) != tt.wantErr {
+				t.Errorf("verifySignature() err = %v，期望出错 %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSlackEventsRejectUnsigned(t *testing.T) {
+	s := &SlackAdapter{signingSecret: "secret"}
+	body := `{"type":"url_verification","challenge":"c"}`
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+	tests := []struct {
+		name   string
+		sig    string
+		status int
+	}{
+		{"未签名", "", http.StatusUnauthorized},
+		{"已签名", slackSign("secret", ts, []byte(body)), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/slack/events", strings.NewReader(body))
+			req.Header.Set("X-Slack-Request-Timestamp", ts)
+			if tt.sig != "" {
+				req.Header.Set("X-Slack-Signature", tt.sig)
+			}
+			rec := httptest.NewRecorder()
+			s.handleHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("状态码 %d，期望 %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+// fakeSlack 假 Slack Web API 与 Socket Mode 服务
+type fakeSlack struct {
+	server *httptest.Server
+	events chan string                 // 通过 Socket Mode 推送的 events_api payload
+	acks   chan string                 // 客户端确认的 envelope_id
+	posts  chan map[string]interface{} // chat.postMessage 的请求体
+}
+
+func newFakeSlack(t *testing.T) *fakeSlack {
+	f := &fakeSlack{
+		events: make(chan string, 1),
+		acks:   make(chan string, 1),
+		posts:  make(chan map[string]interface{}, 1),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/auth.test", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "user_id": "UBOT", "user": "bot", "team": "T1"})
+	})
+	mux.HandleFunc("/api/apps.connections.open", func(w http.ResponseWriter, r *http.Request) {
+		url := "ws" + strings.TrimPrefix(f.server.URL, "http") + "/socket"
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "url": url})
+	})
+	mux.HandleFunc("/api/chat.postMessage", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.posts <- body
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "ts": "2.0"})
+	})
+	mux.HandleFunc("/socket", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteJSON(map[string]string{"type": "hello"})
+		go func() {
+			for {
+				var ack struct {
+					EnvelopeID string `json:"envelope_id"`
+				}
+				if err := conn.ReadJSON(&ack); err != nil {
+					return
+				}
+				f.acks <- ack.EnvelopeID
+			}
+		}()
+		for payload := range f.events {
+			conn.WriteJSON(map[string]interface{}{"envelope_id": "env-1", "type": "events_api", "payload": json.RawMessage(payload)})
+		}
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(func() {
+		close(f.events)
+		f.server.Close()
+	})
+	return f
+}
+
+func TestSlackSocketRoundTrip(t *testing.T) {
+	api := newFakeSlack(t)
+	g := newTestGateway(t)
+	s, err := NewSlackAdapter(config.ChannelConfig{Name: "slack", Token: "xoxb", AppToken: "xapp", APIBaseURL: api.server.URL + "/api"}, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.RegisterChannel(s)
+	g.StartChannels()
+
+	api.events <- `{"type":"event_callback","team_id":"T1","event":{"type":"message","user":"U1","text":"你好","channel":"D1","channel_type":"im","ts":"1.0"}}`
+	if id := receive(t, api.acks); id != "env-1" {
+		t.Fatalf("确认的 envelope_id 为 %q", id)
+	}
+	post := receive(t, api.posts)
+	if post["channel"] != "D1" || post["text"] != "echo: 你好" {
+		t.Fatalf("回复 %v，期望在 D1 回复 echo: 你好", post)
+	}
+	if _, ok := post["thread_ts"]; ok {
+		t.Fatalf("私聊顶层消息不应在线程内回复: %v", post)
+	}
+
+	// 频道内 @机器人 的顶层消息在以该消息开启的线程内回复
+	api.events <- `{"type":"event_callback","team_id":"T1","event":{"type":"message","user":"U1","text":"<@UBOT> 早","channel":"C1","channel_type":"channel","ts":"3.0"}}`
+	receive(t, api.acks)
+	post = receive(t, api.posts)
+	if post["channel"] != "C1" || post["thread_ts"] != "3.0" || !strings.HasSuffix(post["text"].(string), "早") {
+		t.Fatalf("回复 %v，期望在 C1 的线程 3.0 内回复", post)
+	}
+}
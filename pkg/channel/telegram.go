@@ -1,79 +1,652 @@
 package channel
 
 import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
 	"github.com/0xagentlabs/mini-agent-gateway/pkg/gateway"
+	"github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 // TelegramAdapter Telegram 频道适配器
+//
+// 支持两种接收模式：
+//   - polling: 长轮询 getUpdates（默认）
+//   - webhook: 注册 webhook 并提供 HTTP 回调，校验 X-Telegram-Bot-Api-Secret-Token
 type TelegramAdapter struct {
-	bot     *tgbotapi.BotAPI
+	name    string
+	token   string
+	mode    string
+	apiBase string
 	gateway *gateway.Gateway
-	updates tgbotapi.UpdatesChannel
+
+	webhookURL  string
+	secretToken string
+	listen      string
+	path        string
+
+	mu      sync.Mutex
+	bot     *tgbotapi.BotAPI
+	handle  *regexp.Regexp // 匹配 @机器人，Bot 授权后编译一次
+	server  *http.Server
+	stopped bool
+
+	// 最近回复的消息 ID，用户编辑消息后原地修改回复
+	replies    map[string][]int // "chatID:回复的消息 ID" → 回复各分段的消息 ID
+	replyOrder []string
 }
 
+// telegramMaxReplies 记录回复消息 ID 的上限，超出后丢弃最早的
+const telegramMaxReplies = 1000
+
 // NewTelegramAdapter 创建 Telegram 适配器
-func NewTelegramAdapter(token string, gw *gateway.Gateway) *TelegramAdapter {
-	bot, err := tgbotapi.NewBotAPI(token)
+//
+// Bot 鉴权延迟到 Start 中进行，失败时由网关监管重试。
+func NewTelegramAdapter(cfg config.ChannelConfig, gw *gateway.Gateway) (*TelegramAdapter, error) {
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("频道 %s: 缺少 token", cfg.Name)
+	}
+
+	mode := cfg.Mode
+	if mode == "" {
+		mode = "polling"
+	}
+	switch mode {
+	case "polling":
+	case "webhook":
+		if cfg.WebhookURL == "" || cfg.Listen == "" || cfg.SecretToken == "" {
+			return nil, fmt.Errorf("频道 %s: webhook 模式需要 webhook_url、listen 和 secret_token", cfg.Name)
+		}
+	default:
+		return nil, fmt.Errorf("频道 %s: 不支持的 Telegram 模式 %q", cfg.Name, mode)
+	}
+
+	path := cfg.Path
+	if path == "" {
+		path = "/telegram/" + cfg.Name
+	}
+
+	return &TelegramAdapter{
+		name:        cfg.Name,
+		token:       cfg.Token,
+		mode:        mode,
+		apiBase:     strings.TrimRight(cfg.APIBaseURL, "/"),
+		gateway:     gw,
+		webhookURL:  cfg.WebhookURL,
+		secretToken: cfg.SecretToken,
+		listen:      cfg.Listen,
+		path:        path,
+		replies:     make(map[string][]int),
+	}, nil
+}
+
+// Name 适配器名称
+func (t *TelegramAdapter) Name() string {
+	return t.name
+}
+
+// connect 创建并授权 Bot（仅首次）
+func (t *TelegramAdapter) connect() (*tgbotapi.BotAPI, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.bot != nil {
+		return t.bot, nil
+	}
+
+	// 自定义 API 地址用于本地假 Bot API 服务或自建 Bot API Server
+	endpoint := tgbotapi.APIEndpoint
+	if t.apiBase != "" {
+		endpoint = t.apiBase + "/bot%s/%s"
+	}
+
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint(t.token, endpoint)
 	if err != nil {
-		log.Fatalf("创建 Telegram Bot 失败: %v", err)
+		return nil, fmt.Errorf("创建 Telegram Bot 失败: %w", err)
 	}
 
 	bot.Debug = false
-	log.Printf("已授权 Telegram Bot: %s", bot.Self.UserName)
+	log.Printf("[%s] 已授权 Telegram Bot: %s", t.name, bot.Self.UserName)
 
-	return &TelegramAdapter{
-		bot:     bot,
-		gateway: gw,
+	if bot.Self.UserName != "" {
+		t.handle = regexp.MustCompile(`(?i)@` + regexp.QuoteMeta(bot.Self.UserName) + `\b`)
 	}
+	t.bot = bot
+	return bot, nil
 }
 
 // Start 开始接收消息
 func (t *TelegramAdapter) Start() error {
+	bot, err := t.connect()
+	if err != nil {
+		return err
+	}
+
+	if t.mode == "webhook" {
+		return t.serveWebhook(bot)
+	}
+	return t.poll(bot)
+}
+
+// poll 长轮询接收更新
+func (t *TelegramAdapter) poll(bot *tgbotapi.BotAPI) error {
+	// 已设置 webhook 时 getUpdates 会返回 409，先清除
+	if _, err := bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return fmt.Errorf("清除 webhook 失败: %w", err)
+	}
+
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 
-	t.updates = t.bot.GetUpdatesChan(u)
+	t.mu.Lock()
+	if t.stopped {
+		t.mu.Unlock()
+		return nil
+	}
+	updates := bot.GetUpdatesChan(u)
+	t.mu.Unlock()
 
-	for update := range t.updates {
-		if update.Message == nil {
-			continue
+	for update := range updates {
+		t.handleUpdate(update)
+	}
+
+	return nil
+}
+
+// serveWebhook 注册 webhook 并提供 HTTP 回调
+func (t *TelegramAdapter) serveWebhook(bot *tgbotapi.BotAPI) error {
+	_, err := bot.MakeRequest("setWebhook", tgbotapi.Params{
+		"url":          t.webhookURL,
+		"secret_token": t.secretToken,
+	})
+	if err != nil {
+		return fmt.Errorf("注册 webhook 失败: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(t.path, t.handleWebhook)
+	server := &http.Server{Addr: t.listen, Handler: mux}
+
+	t.mu.Lock()
+	if t.stopped {
+		t.mu.Unlock()
+		return nil
+	}
+	t.server = server
+	t.mu.Unlock()
+
+	log.Printf("[%s] Telegram webhook 监听 %s%s → %s", t.name, t.listen, t.path, t.webhookURL)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// handleWebhook 处理 Telegram 推送的更新
+func (t *TelegramAdapter) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	secret := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(t.secretToken)) != 1 {
+		http.Error(w, "invalid secret token", http.StatusUnauthorized)
+		return
+	}
+
+	var update tgbotapi.Update
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&update); err != nil {
+		http.Error(w, "invalid update", http.StatusBadRequest)
+		return
+	}
+
+	t.handleUpdate(update)
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleUpdate 将 Telegram 更新转换为网关消息
+func (t *TelegramAdapter) handleUpdate(update tgbotapi.Update) {
+	if update.CallbackQuery != nil {
+		t.handleCallback(update.CallbackQuery)
+		return
+	}
+	// Bot API 不推送消息删除事件，只处理编辑
+	m, edited := update.Message, false
+	if m == nil {
+		m, edited = update.EditedMessage, true
+	}
+	if m == nil || m.From == nil {
+		return
+	}
+
+	text := m.Text
+	if text == "" {
+		text = m.Caption
+	}
+	attachments := t.attachments(m)
+	if text == "" && len(attachments) == 0 {
+		return
+	}
+
+	msg := gateway.Message{
+		ID:          strconv.Itoa(m.MessageID),
+		UserID:      strconv.FormatInt(m.From.ID, 10),
+		UserName:    telegramName(m.From),
+		ChatID:      strconv.FormatInt(m.Chat.ID, 10),
+		Text:        text,
+		Channel:     t.Name(),
+		Timestamp:   time.Now(),
+		Attachments: attachments,
+		IsGroup:     m.Chat.IsGroup() || m.Chat.IsSuperGroup(),
+		Edited:      edited,
+	}
+	if edited {
+		msg.Timestamp = time.Unix(int64(m.EditDate), 0)
+	}
+	if r := m.ReplyToMessage; r != nil {
+		msg.ReplyToID = strconv.Itoa(r.MessageID)
+		msg.ReplyToText = r.Text
+		if msg.ReplyToText == "" {
+			msg.ReplyToText = r.Caption
+		}
+		if r.From != nil {
+			msg.ReplyToUser = telegramName(r.From)
+		}
+	}
+	if msg.IsGroup {
+		msg.Text, msg.Mentioned = t.mention(m, text)
+	}
+
+	// 发送到网关处理
+	t.gateway.HandleMessage(msg)
+
+	// 立即回复处理中（可选）
+	kind := "消息"
+	if edited {
+		kind = "编辑的消息"
+	}
+	log.Printf("[%s] 收到%s from @%s: %s（%d 个附件）",
+		t.name, kind, m.From.UserName, text, len(attachments))
+}
+
+// mention 判断群聊消息是否指向机器人：@机器人、回复机器人的消息，
+// 并去掉文本中的 @机器人（包括 /command@bot 形式）
+func (t *TelegramAdapter) mention(m *tgbotapi.Message, text string) (string, bool) {
+	t.mu.Lock()
+	bot, handle := t.bot, t.handle
+	t.mu.Unlock()
+	if bot == nil {
+		return text, false
+	}
+
+	mentioned := m.ReplyToMessage != nil && m.ReplyToMessage.From != nil &&
+		m.ReplyToMessage.From.ID == bot.Self.ID
+
+	if handle != nil && handle.MatchString(text) {
+		mentioned = true
+		text = strings.TrimSpace(handle.ReplaceAllString(text, ""))
+	}
+	return text, mentioned
+}
+
+// telegramName 用户显示名称
+func telegramName(u *tgbotapi.User) string {
+	name := strings.TrimSpace(u.FirstName + " " + u.LastName)
+	if name == "" {
+		name = u.UserName
+	}
+	return name
+}
+
+// attachments 提取消息中的图片、文件、语音、音频和视频
+func (t *TelegramAdapter) attachments(m *tgbotapi.Message) []gateway.Attachment {
+	var atts []gateway.Attachment
+	add := func(kind gateway.AttachmentKind, fileID, name, mimeType string, size int) {
+		atts = append(atts, gateway.Attachment{
+			Kind:     kind,
+			MIMEType: mimeType,
+			Size:     int64(size),
+			FileName: name,
+			Open:     t.fileOpener(fileID),
+		})
+	}
+
+	if len(m.Photo) > 0 {
+		// 同一图片有多种尺寸，取最大的一张
+		p := m.Photo[len(m.Photo)-1]
+		add(gateway.AttachmentImage, p.FileID, "photo.jpg", "image/jpeg", p.FileSize)
+	}
+	if d := m.Document; d != nil {
+		mimeType := d.MimeType
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+		add(gateway.KindOf(mimeType), d.FileID, d.FileName, mimeType, d.FileSize)
+	}
+	if v := m.Voice; v != nil {
+		mimeType := v.MimeType
+		if mimeType == "" {
+			mimeType = "audio/ogg"
 		}
+		add(gateway.AttachmentAudio, v.FileID, "voice.ogg", mimeType, v.FileSize)
+	}
+	if a := m.Audio; a != nil {
+		add(gateway.AttachmentAudio, a.FileID, a.FileName, a.MimeType, a.FileSize)
+	}
+	if v := m.Video; v != nil {
+		add(gateway.AttachmentVideo, v.FileID, v.FileName, v.MimeType, v.FileSize)
+	}
+	return atts
+}
 
-		msg := gateway.Message{
-			ID:        string(rune(update.Message.MessageID)),
-			UserID:    string(rune(update.Message.From.ID)),
-			ChatID:    string(rune(update.Message.Chat.ID)),
-			Text:      update.Message.Text,
-			Channel:   "telegram",
-			Timestamp: time.Now(),
+// fileOpener 返回按 file_id 下载 Telegram 文件的函数
+func (t *TelegramAdapter) fileOpener(fileID string) func(ctx context.Context) (io.ReadCloser, error) {
+	return func(ctx context.Context) (io.ReadCloser, error) {
+		bot, err := t.connect()
+		if err != nil {
+			return nil, err
+		}
+		file, err := bot.GetFile(tgbotapi.FileConfig{FileID: fileID})
+		if err != nil {
+			return nil, fmt.Errorf("获取 Telegram 文件失败: %w", err)
 		}
 
-		// 发送到网关处理
-		go t.gateway.HandleMessage(msg)
-		
-		// 立即回复处理中（可选）
-		if update.Message.Text != "" {
-			log.Printf("[Telegram] 收到消息 from @%s: %s", 
-				update.Message.From.UserName, update.Message.Text)
+		endpoint := tgbotapi.FileEndpoint
+		if t.apiBase != "" {
+			endpoint = t.apiBase + "/file/bot%s/%s"
 		}
+		return httpOpener(fmt.Sprintf(endpoint, t.token, file.FilePath), nil)(ctx)
+	}
+}
+
+// Send 实现 gateway.Channel，发送回复到 Telegram
+func (t *TelegramAdapter) Send(reply gateway.Reply) error {
+	chatID, err := strconv.ParseInt(reply.ChatID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("无效的 Telegram chat ID %q: %w", reply.ChatID, err)
 	}
 
+	// 群聊（chat ID 为负数）中第一段回复引用原消息，便于看出回复的是谁
+	replyTo := 0
+	if chatID < 0 {
+		replyTo, _ = strconv.Atoi(reply.ReplyToID)
+	}
+
+	// Telegram 单条消息上限 4096 字符
+	if reply.Text != "" {
+		var ids []int
+		for i, chunk := range splitMessage(reply.Text, 4096) {
+			if i > 0 {
+				replyTo = 0
+			}
+			id, err := t.sendText(chatID, chunk, replyTo)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		t.rememberReply(reply, ids)
+	}
+
+	return t.sendAttachments(chatID, reply.Attachments)
+}
+
+// sendAttachments 依次发送回复的附件
+func (t *TelegramAdapter) sendAttachments(chatID int64, attachments []gateway.Attachment) error {
+	for _, att := range attachments {
+		if err := t.sendAttachment(chatID, att); err != nil {
+			return fmt.Errorf("发送附件 %s 失败: %w", att.FileName, err)
+		}
+	}
 	return nil
 }
 
+// EditReply 实现 gateway.ReplyEditor，修改之前对同一条消息的回复
+//
+// 新回复的分段依次替换原分段，多出的分段作为新消息发送，原回复多出的分段被删除。
+// 附件无法替换，作为新消息发送。
+func (t *TelegramAdapter) EditReply(reply gateway.Reply) (bool, error) {
+	chatID, err := strconv.ParseInt(reply.ChatID, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("无效的 Telegram chat ID %q: %w", reply.ChatID, err)
+	}
+	key := reply.ChatID + ":" + reply.ReplyToID
+
+	t.mu.Lock()
+	bot := t.bot
+	old := t.replies[key]
+	t.mu.Unlock()
+	if bot == nil || len(old) == 0 || reply.Text == "" {
+		return false, nil
+	}
+
+	var ids []int
+	for i, chunk := range splitMessage(reply.Text, 4096) {
+		if i < len(old) {
+			if err := t.editText(bot, chatID, old[i], chunk); err != nil {
+				return false, err
+			}
+			ids = append(ids, old[i])
+			continue
+		}
+		id, err := t.sendText(chatID, chunk, 0)
+		if err != nil {
+			return true, err
+		}
+		ids = append(ids, id)
+	}
+	for _, id := range old[min(len(ids), len(old)):] {
+		if _, err := bot.Request(tgbotapi.NewDeleteMessage(chatID, id)); err != nil {
+			log.Printf("[%s] 删除多余的回复分段失败: %v", t.name, err)
+		}
+	}
+	t.rememberReply(reply, ids)
+
+	return true, t.sendAttachments(chatID, reply.Attachments)
+}
+
+// editText 修改已发送的消息，Markdown 解析失败时退回纯文本
+func (t *TelegramAdapter) editText(bot *tgbotapi.BotAPI, chatID int64, messageID int, text string) error {
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	edit.ParseMode = tgbotapi.ModeMarkdown
+	_, err := bot.Send(edit)
+	if err == nil || strings.Contains(err.Error(), "message is not modified") {
+		return nil
+	}
+	if !telegramParseError(err) {
+		return err
+	}
+
+	edit.ParseMode = ""
+	_, err = bot.Send(edit)
+	if err != nil && strings.Contains(err.Error(), "message is not modified") {
+		return nil
+	}
+	return err
+}
+
+// rememberReply 记录回复各分段的消息 ID，超出上限时丢弃最早的记录
+func (t *TelegramAdapter) rememberReply(reply gateway.Reply, ids []int) {
+	if reply.ReplyToID == "" || len(ids) == 0 {
+		return
+	}
+	key := reply.ChatID + ":" + reply.ReplyToID
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.replies[key]; !ok {
+		t.replyOrder = append(t.replyOrder, key)
+	}
+	t.replies[key] = ids
+	for len(t.replyOrder) > telegramMaxReplies {
+		delete(t.replies, t.replyOrder[0])
+		t.replyOrder = t.replyOrder[1:]
+	}
+}
+
+// sendAttachment 图片以照片发送，其他附件以文件发送
+func (t *TelegramAdapter) sendAttachment(chatID int64, att gateway.Attachment) error {
+	t.mu.Lock()
+	bot := t.bot
+	t.mu.Unlock()
+	if bot == nil {
+		return fmt.Errorf("Telegram Bot 尚未连接")
+	}
+
+	data, err := att.Read(context.Background())
+	if err != nil {
+		return err
+	}
+	file := tgbotapi.FileBytes{Name: att.FileName, Bytes: data}
+
+	var c tgbotapi.Chattable = tgbotapi.NewDocument(chatID, file)
+	if att.Kind == gateway.AttachmentImage {
+		c = tgbotapi.NewPhoto(chatID, file)
+	}
+	_, err = bot.Send(c)
+	return err
+}
+
 // SendMessage 发送消息到 Telegram
 func (t *TelegramAdapter) SendMessage(chatID int64, text string) error {
+	_, err := t.sendText(chatID, text, 0)
+	return err
+}
+
+// sendText 发送一条文本消息，replyTo 非 0 时引用该消息，返回消息 ID
+func (t *TelegramAdapter) sendText(chatID int64, text string, replyTo int) (int, error) {
+	t.mu.Lock()
+	bot := t.bot
+	t.mu.Unlock()
+	if bot == nil {
+		return 0, fmt.Errorf("Telegram Bot 尚未连接")
+	}
+
 	msg := tgbotapi.NewMessage(chatID, text)
+	if replyTo != 0 {
+		// 原消息已被删除时仍然发送
+		msg.ReplyToMessageID, msg.AllowSendingWithoutReply = replyTo, true
+	}
 	msg.ParseMode = tgbotapi.ModeMarkdown
-	_, err := t.bot.Send(msg)
+	sent, err := bot.Send(msg)
+	if !telegramParseError(err) {
+		return sent.MessageID, err
+	}
+
+	// LLM 输出的 Markdown 不一定合法，解析失败时退回纯文本；
+	// 其他错误（限流、网络等）重发也无济于事，直接返回
+	msg.ParseMode = ""
+	sent, err = bot.Send(msg)
+	return sent.MessageID, err
+}
+
+// telegramParseError 判断是否为 Markdown 解析失败
+func telegramParseError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "can't parse entities")
+}
+
+// telegramApprovalPrefix 审批按钮的 callback_data 前缀，格式为 approval:<ID>:<决定>
+const telegramApprovalPrefix = "approval:"
+
+// SendApproval 实现 gateway.ApprovalSender，以内联键盘按钮请求审批
+func (t *TelegramAdapter) SendApproval(msg gateway.Message, req gateway.ApprovalRequest) error {
+	chatID, err := strconv.ParseInt(msg.ChatID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("无效的 Telegram chat ID %q: %w", msg.ChatID, err)
+	}
+	t.mu.Lock()
+	bot := t.bot
+	t.mu.Unlock()
+	if bot == nil {
+		return fmt.Errorf("Telegram Bot 尚未连接")
+	}
+
+	button := func(label string, d gateway.Decision) tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardButtonData(label, telegramApprovalPrefix+req.ID+":"+string(d))
+	}
+
+	// 参数由模型生成，不使用 Markdown 以免解析失败
+	m := tgbotapi.NewMessage(chatID, fmt.Sprintf("⚠️ 需要你的确认才能执行高风险工具 %s\n参数: %s\n\n%s 内未确认将自动拒绝",
+		req.Tool, preview(req.Args, 500), time.Until(req.Expires).Round(time.Second)))
+	m.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		button("✅ 允许", gateway.DecisionApprove),
+		button("❌ 拒绝", gateway.DecisionDeny),
+		button("♾️ 始终允许", gateway.DecisionAlways),
+	))
+	_, err = bot.Send(m)
 	return err
 }
 
+// handleCallback 处理审批按钮回调：提交决定，并在原消息上标注结果、移除按钮
+func (t *TelegramAdapter) handleCallback(q *tgbotapi.CallbackQuery) {
+	rest, ok := strings.CutPrefix(q.Data, telegramApprovalPrefix)
+	if !ok || q.From == nil {
+		return
+	}
+	id, value, _ := strings.Cut(rest, ":")
+	d, ok := gateway.ParseDecision(value)
+	if !ok {
+		return
+	}
+
+	t.mu.Lock()
+	bot := t.bot
+	t.mu.Unlock()
+	if bot == nil {
+		return
+	}
+
+	result := map[gateway.Decision]string{
+		gateway.DecisionApprove: "✅ 已允许",
+		gateway.DecisionDeny:    "❌ 已拒绝",
+		gateway.DecisionAlways:  "♾️ 已允许，本会话中不再询问该工具",
+	}[d]
+	err := t.gateway.ResolveApproval(t.name, strconv.FormatInt(q.From.ID, 10), id, d)
+	if err != nil {
+		result = err.Error()
+	}
+	bot.Request(tgbotapi.NewCallback(q.ID, result))
+	if err != nil {
+		return
+	}
+	log.Printf("[%s] %s 审批 %s: %s", t.name, q.From.UserName, id, d)
+
+	if q.Message != nil {
+		edit := tgbotapi.NewEditMessageText(q.Message.Chat.ID, q.Message.MessageID,
+			q.Message.Text+"\n\n"+result+"（"+telegramName(q.From)+"）")
+		if _, err := bot.Send(edit); err != nil {
+			log.Printf("[%s] 更新审批消息失败: %v", t.name, err)
+		}
+	}
+}
+
 // Stop 停止接收
 func (t *TelegramAdapter) Stop() {
-	t.bot.StopReceivingUpdates()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stopped {
+		return
+	}
+	t.stopped = true
+	if t.server != nil {
+		t.server.Close()
+	}
+	if t.bot != nil && t.mode == "polling" {
+		t.bot.StopReceivingUpdates()
+	}
 }
@@ -0,0 +1,169 @@
+package channel
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/gateway"
+	"github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeTelegram 假 Bot API 服务，sendMessage 依次返回 errors 中的错误，用完后成功
+type fakeTelegram struct {
+	mu     sync.Mutex
+	errors []string
+	modes  []string    // 每次 sendMessage 的 parse_mode
+	texts  chan string // 成功发送的文本（可选）
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	switch method {
+	case "getMe":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":     true,
+			"result": map[string]interface{}{"id": 1, "is_bot": true, "first_name": "bot", "username": "test_bot"},
+		})
+	case "sendMessage":
+		f.mu.Lock()
+		f.modes = append(f.modes, r.Form.Get("parse_mode"))
+		var desc string
+		if len(f.errors) > 0 {
+			desc, f.errors = f.errors[0], f.errors[1:]
+		}
+		f.mu.Unlock()
+		if desc != "" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error_code": 400, "description": desc})
+			return
+		}
+		if f.texts != nil {
+			f.texts <- r.Form.Get("text")
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":     true,
+			"result": map[string]interface{}{"message_id": 42, "date": 0, "chat": map[string]interface{}{"id": 100, "type": "private"}},
+		})
+	default:
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": true})
+	}
+}
+
+func newTestTelegram(t *testing.T, cfg config.ChannelConfig, api http.Handler, gw *gateway.Gateway) *TelegramAdapter {
+	t.Helper()
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+
+	cfg.Name, cfg.Token, cfg.APIBaseURL = "telegram", "token", srv.URL
+	tg, err := NewTelegramAdapter(cfg, gw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tg.connect(); err != nil {
+		t.Fatal(err)
+	}
+	return tg
+}
+
+func TestTelegramSendTextFallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		errors  []string
+		modes   []string
+		wantErr bool
+	}{
+		{"成功", nil, []string{"Markdown"}, false},
+		{"Markdown 解析失败退回纯文本", []string{"Bad Request: can't parse entities: Can't find end of the entity"}, []string{"Markdown", ""}, false},
+		{"其他错误不重发", []string{"Too Many Requests: retry after 5"}, []string{"Markdown"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeTelegram{errors: tt.errors}
+			tg := newTestTelegram(t, config.ChannelConfig{}, api, newTestGateway(t))
+
+			id, err := tg.sendText(100, "*hi", 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v，期望出错 %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && id != 42 {
+				t.Fatalf("消息 ID %d，期望 42", id)
+			}
+			if strings.Join(api.modes, ",") != strings.Join(tt.modes, ",") {
+				t.Fatalf("parse_mode 依次为 %q，期望 %q", api.modes, tt.modes)
+			}
+		})
+	}
+}
+
+func TestTelegramMention(t *testing.T) {
+	tg := newTestTelegram(t, config.ChannelConfig{}, &fakeTelegram{}, newTestGateway(t))
+
+	tests := []struct {
+		text      string
+		want      string
+		mentioned bool
+	}{
+		{"@test_bot 你好", "你好", true},
+		{"/help@Test_Bot", "/help", true},
+		{"@test_bot_fan 你好", "@test_bot_fan 你好", false},
+		{"你好", "你好", false},
+	}
+	for _, tt := range tests {
+		text, mentioned := tg.mention(&tgbotapi.Message{}, tt.text)
+		if text != tt.want || mentioned != tt.mentioned {
+			t.Errorf("mention(%q) = %q, %v，期望 %q, %v", tt.text, text, mentioned, tt.want, tt.mentioned)
+		}
+	}
+}
+
+func TestTelegramWebhookSecret(t *testing.T) {
+	api := &fakeTelegram{texts: make(chan string, 1)}
+	g := newTestGateway(t)
+	tg := newTestTelegram(t, config.ChannelConfig{
+		Mode: "webhook", WebhookURL: "https://example.com/hook", Listen: ":0", SecretToken: "s3cret",
+	}, api, g)
+	g.RegisterChannel(tg)
+
+	update := `{"update_id":1,"message":{"message_id":5,"date":0,"text":"你好","from":{"id":7,"first_name":"u"},"chat":{"id":7,"type":"private"}}}`
+	tests := []struct {
+		name   string
+		method string
+		secret string
+		status int
+	}{
+		{"缺少密钥", http.MethodPost, "", http.StatusUnauthorized},
+		{"错误的密钥", http.MethodPost, "wrong", http.StatusUnauthorized},
+		{"密钥前缀", http.MethodPost, "s3cre", http.StatusUnauthorized},
+		{"不支持的方法", http.MethodGet, "s3cret", http.StatusMethodNotAllowed},
+		{"正确的密钥", http.MethodPost, "s3cret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/telegram/telegram", strings.NewReader(update))
+			if tt.secret != "" {
+				req.Header.Set("X-Telegram-Bot-Api-Secret-Token", tt.secret)
+			}
+			rec := httptest.NewRecorder()
+			tg.handleWebhook(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("状态码 %d，期望 %d", rec.Code, tt.status)
+			}
+		})
+	}
+
+	// 只有通过校验的更新会交给网关处理
+	if text := receive(t, api.texts); text != "echo: 你好" {
+		t.Fatalf("回复 %q，期望 echo: 你好", text)
+	}
+	select {
+	case text := <-api.texts:
+		t.Fatalf("被拒绝的更新不应产生回复: %q", text)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
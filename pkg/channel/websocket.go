@@ -0,0 +1,442 @@
+package channel
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/agent"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/gateway"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// 每个会话保留的最近事件数，用于断线重连后补发
+	wsEventBuffer = 256
+	// 工具结果预览长度
+	wsResultPreview = 500
+	// 断开连接的会话状态保留时长
+	wsConversationTTL = time.Hour
+	// 浏览器通过子协议 ["api-key", key] 携带密钥，握手响应选中该子协议
+	wsKeyProtocol = "api-key"
+)
+
+// wsEvent 推送给客户端的事件
+type wsEvent struct {
+	Type           string          `json:"type"`
+	Seq            int64           `json:"seq,omitempty"`
+	ConversationID string          `json:"conversation_id,omitempty"`
+	RunID          string          `json:"run_id,omitempty"`
+	Text           string          `json:"text,omitempty"`
+	Tool           string          `json:"tool,omitempty"`
+	ToolCallID     string          `json:"tool_call_id,omitempty"`
+	Args           string          `json:"args,omitempty"`
+	Result         string          `json:"result,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	History        []wsHistoryItem `json:"history,omitempty"`
+	Attachments    []apiAttachment `json:"attachments,omitempty"`
+}
+
+// wsHistoryItem 会话历史条目
+type wsHistoryItem struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// wsClientFrame 客户端发来的帧
+type wsClientFrame struct {
+	Type        string          `json:"type"` // message / ping
+	Text        string          `json:"text"`
+	Attachments []apiAttachment `json:"attachments"`
+}
+
+// wsConn 串行写入的 websocket 连接
+type wsConn struct {
+	ws *websocket.Conn
+	mu sync.Mutex
+}
+
+func (c *wsConn) write(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return c.ws.WriteJSON(v)
+}
+
+// wsConversation 会话的连接与事件缓冲
+type wsConversation struct {
+	caller   string // 会话所属的调用方，由 API Key 派生
+	conn     *wsConn
+	seq      int64
+	events   []wsEvent
+	detached time.Time
+}
+
+// WebSocketAdapter WebSocket 频道适配器，面向 Web 聊天界面
+//
+// 连接 GET {path}?conversation_id=X&last_seq=N 后：
+//   - 服务端首先推送 session 事件（包含会话历史），conversation_id 为空时自动分配
+//   - 客户端发送 {"type":"message","text":"...","attachments":[...]}
+//   - 服务端推送 delta / tool_started / tool_finished / reply / error 事件
+//
+// 每个事件带有会话内递增的 seq，断线重连时携带 last_seq 可补发错过的事件。
+// 消息未被网关接受（繁忙、限流、无权访问等）时推送带 run_id 的 error 事件。
+//
+// 鉴权使用 Authorization / X-API-Key 头；浏览器无法设置这些头，改为在子协议中携带：
+// new WebSocket(url, ["api-key", key])。密钥不接受查询参数，避免写入访问日志。
+// 用户身份按密钥区分（与 HTTP 频道相同），会话归属于首次连接它的密钥，其他密钥无法连接。
+// 浏览器来源受 allowed_origins 限制，默认只允许同源页面。
+type WebSocketAdapter struct {
+	name     string
+	listen   string
+	path     string
+	apiKeys  []string
+	gateway  *gateway.Gateway
+	upgrader websocket.Upgrader
+
+	mu     sync.Mutex
+	convs  map[string]*wsConversation
+	server *http.Server
+}
+
+// NewWebSocketAdapter 创建 WebSocket 适配器
+func NewWebSocketAdapter(cfg config.ChannelConfig, gw *gateway.Gateway) (*WebSocketAdapter, error) {
+	if cfg.Listen == "" {
+		return nil, fmt.Errorf("频道 %s: 缺少 listen", cfg.Name)
+	}
+	if len(cfg.APIKeys) == 0 {
+		return nil, fmt.Errorf("频道 %s: 至少需要配置一个 api_keys", cfg.Name)
+	}
+	path := cfg.Path
+	if path == "" {
+		path = "/v1/ws"
+	}
+
+	return &WebSocketAdapter{
+		name:    cfg.Name,
+		listen:  cfg.Listen,
+		path:    path,
+		apiKeys: cfg.APIKeys,
+		gateway: gw,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: originChecker(cfg.AllowedOrigins),
+		},
+		convs: make(map[string]*wsConversation),
+	}, nil
+}
+
+// Name 适配器名称
+func (s *WebSocketAdapter) Name() string {
+	return s.name
+}
+
+// Start 启动 WebSocket 服务
+func (s *WebSocketAdapter) Start() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(s.path, s.handleConnect)
+
+	server := &http.Server{Addr: s.listen, Handler: mux}
+
+	s.mu.Lock()
+	s.server = server
+	s.mu.Unlock()
+
+	log.Printf("[%s] WebSocket 监听 %s%s", s.name, s.listen, s.path)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Stop 关闭服务和所有连接
+func (s *WebSocketAdapter) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.server != nil {
+		s.server.Close()
+	}
+	for _, conv := range s.convs {
+		if conv.conn != nil {
+			conv.conn.ws.Close()
+		}
+	}
+}
+
+// Send 实现 gateway.Channel，推送最终回复
+func (s *WebSocketAdapter) Send(reply gateway.Reply) error {
+	s.emit(reply.ChatID, wsEvent{
+		Type:        "reply",
+		RunID:       reply.ReplyToID,
+		Text:        reply.Text,
+		Attachments: encodeAttachments(reply.Attachments),
+	})
+	return nil
+}
+
+// SendEvent 实现 gateway.EventSender，推送运行过程事件
+func (s *WebSocketAdapter) SendEvent(msg gateway.Message, ev agent.Event) error {
+	// 文件随最终回复推送
+	if ev.Type == agent.EventFile {
+		return nil
+	}
+
+	e := wsEvent{
+		Type:       string(ev.Type),
+		RunID:      msg.ID,
+		Tool:       ev.ToolName,
+		ToolCallID: ev.ToolCallID,
+		Error:      ev.Error,
+	}
+	switch ev.Type {
+	case agent.EventDelta:
+		e.Text = ev.Delta
+	case agent.EventToolStarted:
+		e.Args = ev.ToolArgs
+	case agent.EventToolFinished:
+		e.Result = preview(ev.ToolResult, wsResultPreview)
+	}
+
+	s.emit(msg.ChatID, e)
+	return nil
+}
+
+// handleConnect 处理 WebSocket 握手与客户端消息
+func (s *WebSocketAdapter) handleConnect(w http.ResponseWriter, r *http.Request) {
+	// 浏览器无法设置自定义头，允许通过子协议携带密钥，握手响应需选中该子协议
+	var header http.Header
+	key := requestKey(r)
+	if !checkAPIKey(r, s.apiKeys) {
+		if !checkProtocolKey(r, s.apiKeys) {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "缺少或无效的 API Key")
+			return
+		}
+		key = protocolKey(r)
+		header = http.Header{"Sec-WebSocket-Protocol": {wsKeyProtocol}}
+	}
+
+	// 用户身份取自鉴权的密钥，会话 ID 由客户端自选，不能用来冒充其他用户或接管其他密钥的会话
+	caller := keyCaller(key)
+	conversationID := r.URL.Query().Get("conversation_id")
+	if conversationID == "" {
+		conversationID = newID()
+	}
+	if !s.claim(conversationID, caller) {
+		writeError(w, http.StatusForbidden, "forbidden", "会话属于其他 API Key")
+		return
+	}
+
+	ws, err := s.upgrader.Upgrade(w, r, header)
+	if err != nil {
+		return
+	}
+	conn := &wsConn{ws: ws}
+	defer ws.Close()
+
+	lastSeq, _ := strconv.ParseInt(r.URL.Query().Get("last_seq"), 10, 64)
+
+	s.attach(caller, conversationID, conn, lastSeq)
+	defer s.detach(conversationID, conn)
+
+	for {
+		var frame wsClientFrame
+		if err := ws.ReadJSON(&frame); err != nil {
+			return
+		}
+
+		switch frame.Type {
+		case "ping":
+			conn.write(wsEvent{Type: "pong"})
+		case "message":
+			if frame.Text == "" && len(frame.Attachments) == 0 {
+				conn.write(wsEvent{Type: "error", Error: "text 和 attachments 不能同时为空"})
+				continue
+			}
+			attachments, err := decodeAttachments(frame.Attachments)
+			if err != nil {
+				conn.write(wsEvent{Type: "error", Error: err.Error()})
+				continue
+			}
+			msg := gateway.Message{
+				ID:          newID(),
+				UserID:      caller,
+				ChatID:      conversationID,
+				ClientChat:  true,
+				Text:        frame.Text,
+				Channel:     s.name,
+				Timestamp:   time.Now(),
+				Attachments: attachments,
+			}
+			conn.write(wsEvent{Type: "accepted", RunID: msg.ID})
+			if err := s.gateway.HandleMessage(msg); err != nil {
+				// 未进入队列的消息不会有回复，告知客户端原因
+				s.emit(conversationID, wsEvent{Type: "error", RunID: msg.ID, Error: err.Error()})
+			}
+		default:
+			conn.write(wsEvent{Type: "error", Error: "未知的帧类型: " + frame.Type})
+		}
+	}
+}
+
+// claim 将会话归属到调用方；会话已属于其他调用方时返回 false
+func (s *WebSocketAdapter) claim(conversationID, caller string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cleanupLocked()
+
+	conv, ok := s.convs[conversationID]
+	if !ok {
+		conv = &wsConversation{detached: time.Now()}
+		s.convs[conversationID] = conv
+	}
+	if conv.caller == "" {
+		conv.caller = caller
+	}
+	return conv.caller == caller
+}
+
+// attach 将连接绑定到会话：推送会话历史并补发 lastSeq 之后的事件
+func (s *WebSocketAdapter) attach(caller, conversationID string, conn *wsConn, lastSeq int64) {
+	s.mu.Lock()
+	s.cleanupLocked()
+
+	conv, ok := s.convs[conversationID]
+	if !ok {
+		conv = &wsConversation{caller: caller}
+		s.convs[conversationID] = conv
+	}
+	// 同一会话只保留最新的连接
+	if conv.conn != nil && conv.conn != conn {
+		conv.conn.ws.Close()
+	}
+	conv.conn = conn
+
+	hello := wsEvent{
+		Type:           "session",
+		Seq:            conv.seq,
+		ConversationID: conversationID,
+	}
+	var missed []wsEvent
+	if lastSeq > 0 {
+		for _, e := range conv.events {
+			if e.Seq > lastSeq {
+				missed = append(missed, e)
+			}
+		}
+	}
+
+	// 先占住连接写锁再释放会话锁，保证补发的事件排在新事件之前
+	conn.mu.Lock()
+	s.mu.Unlock()
+	defer conn.mu.Unlock()
+
+	if sess := s.gateway.SessionOf(gateway.Message{Channel: s.name, UserID: caller, ChatID: conversationID, ClientChat: true}); sess != nil {
+		for _, m := range sess.GetMessages() {
+			hello.History = append(hello.History, wsHistoryItem{Role: m.Role, Content: m.Content})
+		}
+	}
+
+	conn.ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	conn.ws.WriteJSON(hello)
+	for _, e := range missed {
+		conn.ws.WriteJSON(e)
+	}
+}
+
+// detach 连接断开后保留会话状态，等待重连
+func (s *WebSocketAdapter) detach(conversationID string, conn *wsConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if conv, ok := s.convs[conversationID]; ok && conv.conn == conn {
+		conv.conn = nil
+		conv.detached = time.Now()
+	}
+}
+
+// emit 记录事件并推送到会话当前连接（无连接时仅缓冲）
+func (s *WebSocketAdapter) emit(conversationID string, e wsEvent) {
+	s.mu.Lock()
+	conv, ok := s.convs[conversationID]
+	if !ok {
+		conv = &wsConversation{detached: time.Now()}
+		s.convs[conversationID] = conv
+	}
+	conv.seq++
+	e.Seq = conv.seq
+	conv.events = append(conv.events, e)
+	if len(conv.events) > wsEventBuffer {
+		conv.events = conv.events[len(conv.events)-wsEventBuffer:]
+	}
+	conn := conv.conn
+	s.mu.Unlock()
+
+	if conn != nil {
+		conn.write(e)
+	}
+}
+
+// cleanupLocked 清理长时间未重连的会话状态，调用方需持有锁
+func (s *WebSocketAdapter) cleanupLocked() {
+	now := time.Now()
+	for id, conv := range s.convs {
+		if conv.conn == nil && now.Sub(conv.detached) > wsConversationTTL {
+			delete(s.convs, id)
+		}
+	}
+}
+
+// protocolKey 子协议 ["api-key", key] 中携带的密钥，格式不符时返回空
+func protocolKey(r *http.Request) string {
+	protocols := websocket.Subprotocols(r)
+	if len(protocols) != 2 || protocols[0] != wsKeyProtocol {
+		return ""
+	}
+	return protocols[1]
+}
+
+// checkProtocolKey 校验子协议 ["api-key", key] 中携带的密钥
+func checkProtocolKey(r *http.Request, keys []string) bool {
+	key := protocolKey(r)
+	if key == "" {
+		return false
+	}
+	r2 := r.Clone(r.Context())
+	r2.Header.Set("X-API-Key", key)
+	r2.Header.Del("Authorization")
+	return checkAPIKey(r2, keys)
+}
+
+// originChecker 按 allowed_origins 校验浏览器来源，未配置时只允许同源；
+// 不带 Origin 头的非浏览器客户端不受限制
+func originChecker(allowed []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		for _, o := range allowed {
+			if o == "*" || strings.EqualFold(o, origin) {
+				return true
+			}
+		}
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+}
+
+// preview 截断过长的文本
+func preview(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit]) + "…"
+}
@@ -0,0 +1,81 @@
+package channel
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/gateway"
+	"github.com/gorilla/websocket"
+)
+
+func TestWebSocketCaller(t *testing.T) {
+	g := newTestGateway(t)
+	cfg := config.ChannelConfig{
+		Name:    "ws",
+		Listen:  ":0",
+		APIKeys: []string{"alice", "bob"},
+		Access:  config.AccessConfig{AllowUsers: []string{keyCaller("alice")}},
+	}
+	g.Configure(&config.Config{Channels: []config.ChannelConfig{cfg}})
+	s, err := NewWebSocketAdapter(cfg, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.RegisterChannel(s)
+	srv := httptest.NewServer(http.HandlerFunc(s.handleConnect))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	dial := func(header http.Header, conversation string) (*websocket.Conn, *http.Response, error) {
+		var d websocket.Dialer
+		if p := header.Get("Sec-WebSocket-Protocol"); p != "" {
+			d.Subprotocols = strings.Split(p, ", ")
+			header.Del("Sec-WebSocket-Protocol")
+		}
+		return d.Dial(url+"?conversation_id="+conversation, header)
+	}
+	next := func(ws *websocket.Conn, typ string) wsEvent {
+		t.Helper()
+		for {
+			var e wsEvent
+			if err := ws.ReadJSON(&e); err != nil {
+				t.Fatal(err)
+			}
+			if e.Type == typ {
+				return e
+			}
+		}
+	}
+
+	// 浏览器客户端在子协议中携带密钥
+	alice, _, err := dial(http.Header{"Sec-WebSocket-Protocol": {"api-key, alice"}}, "demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alice.Close()
+	next(alice, "session")
+	alice.WriteJSON(wsClientFrame{Type: "message", Text: "hi"})
+	if e := next(alice, "reply"); e.RunID == "" {
+		t.Fatalf("回复缺少 run_id: %+v", e)
+	}
+
+	// 其他密钥不能接管已有会话
+	if _, resp, err := dial(http.Header{"X-API-Key": {"bob"}}, "demo"); err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("bob 连接 alice 的会话: %v", err)
+	}
+
+	// 会话 ID 与被允许的调用方相同也不能冒充
+	bob, _, err := dial(http.Header{"X-API-Key": {"bob"}}, keyCaller("alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bob.Close()
+	next(bob, "session")
+	bob.WriteJSON(wsClientFrame{Type: "message", Text: "hi"})
+	if e := next(bob, "error"); !strings.Contains(e.Error, gateway.ErrForbidden.Error()) {
+		t.Fatalf("bob 的消息应被拒绝: %q", e.Error)
+	}
+}
@@ -0,0 +1,516 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/cron"
+	"gopkg.in/yaml.v3"
+)
+
+// Config 网关配置
+type Config struct {
+	Gateway  GatewayConfig   `yaml:"gateway"`
+	Channels []ChannelConfig `yaml:"channels"`
+	// Agents 命名的 Agent 配置，名为 default 的配置用于未命中路由的消息
+	Agents map[string]AgentConfig `yaml:"agents,omitempty"`
+	// Routes 按顺序匹配的路由规则，第一条命中的规则决定使用哪个 Agent 配置
+	Routes []RouteConfig `yaml:"routes,omitempty"`
+	// Jobs 管理员定义的定时任务，每次启动时从配置加载，用户无法取消
+	Jobs []JobConfig `yaml:"jobs,omitempty"`
+}
+
+// JobConfig 按 cron 表达式定时运行 Agent，并将结果发送到指定会话
+type JobConfig struct {
+	// Name 任务名称，在 /jobs 中显示
+	Name string `yaml:"name"`
+	// Cron 5 字段 cron 表达式或 @daily 等预定义表达式，按 gateway.jobs.timezone 计算
+	Cron string `yaml:"cron"`
+	// Channel 频道名称
+	Channel string `yaml:"channel"`
+	// Chat 发送结果的会话 ID
+	Chat string `yaml:"chat"`
+	// User 私聊会话的用户 ID，此时使用该用户的私聊会话；不填视为群聊
+	User string `yaml:"user,omitempty"`
+	// Thread 在该线程内发送（可选），如 Slack thread_ts
+	Thread string `yaml:"thread,omitempty"`
+	// Prompt 到时交给 Agent 的指令
+	Prompt string `yaml:"prompt"`
+	// Role 运行时使用的角色，决定可用的工具与技能，默认 member
+	Role string `yaml:"role,omitempty"`
+}
+
+// AgentConfig Agent 配置：模型、API 地址、系统提示词、可用工具与运行限制
+//
+// 未设置的字段沿用环境变量中的默认配置。工具与技能规则的语法同 RoleConfig，
+// 但允许列表为空表示不额外限制；最终可用的工具是角色与 Agent 配置的交集。
+type AgentConfig struct {
+	// Description 说明，显示在 /whoami 中
+	Description string `yaml:"description,omitempty"`
+	// Model 模型名
+	Model string `yaml:"model,omitempty"`
+	// BaseURL OpenAI 兼容 API 地址
+	BaseURL string `yaml:"base_url,omitempty"`
+	// APIKey API 密钥，支持 ${ENV} 引用
+	APIKey string `yaml:"api_key,omitempty"`
+	// SystemPrompt 替换默认的系统提示词，技能说明仍追加在后面
+	SystemPrompt string `yaml:"system_prompt,omitempty"`
+
+	Tools      []string `yaml:"tools,omitempty"`
+	DenyTools  []string `yaml:"deny_tools,omitempty"`
+	Skills     []string `yaml:"skills,omitempty"`
+	DenySkills []string `yaml:"deny_skills,omitempty"`
+
+	// MaxToolRounds 单次运行最多的工具调用轮数，默认 10
+	MaxToolRounds int `yaml:"max_tool_rounds,omitempty"`
+	// Timeout 单次运行的时间上限，默认不限制
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// RouteConfig 路由规则，设置的条件需全部满足，未设置的条件不限制
+type RouteConfig struct {
+	// Agent 命中时使用的 Agent 配置名
+	Agent string `yaml:"agent"`
+	// Channel 频道名称
+	Channel string `yaml:"channel,omitempty"`
+	// Chats 会话 ID 列表（命中其一）
+	Chats []string `yaml:"chats,omitempty"`
+	// Users 用户 ID 列表（命中其一）
+	Users []string `yaml:"users,omitempty"`
+	// Prefix 消息以该前缀开头（如 "@ops"、"!ops"），命中后从消息中去掉前缀
+	Prefix string `yaml:"prefix,omitempty"`
+}
+
+// GatewayConfig 网关消息处理配置
+type GatewayConfig struct {
+	// Workers 并行处理的会话数上限（同一会话内始终按顺序处理），默认 8
+	Workers int `yaml:"workers,omitempty"`
+	// QueueSize 全局排队消息上限，默认 100，-1 表示不限制
+	QueueSize int `yaml:"queue_size,omitempty"`
+	// ConversationQueueSize 单个会话排队消息上限，默认 10，-1 表示不限制
+	ConversationQueueSize int `yaml:"conversation_queue_size,omitempty"`
+	// Overload 队列满时的策略：reject（默认）/ drop_oldest / coalesce
+	Overload string `yaml:"overload,omitempty"`
+	// BusyMessage reject 时回复给用户的提示
+	BusyMessage string `yaml:"busy_message,omitempty"`
+	// ShutdownTimeout 关闭时等待进行中请求完成的时间，超时后取消，默认 30s
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout,omitempty"`
+	// DataDir 需要跨重启保存的网关状态（如消息去重记录）所在目录，默认 data
+	DataDir string `yaml:"data_dir,omitempty"`
+	// Dedup 入站消息去重
+	Dedup DedupConfig `yaml:"dedup,omitempty"`
+	// Edits 用户编辑消息的处理方式
+	Edits EditConfig `yaml:"edits,omitempty"`
+	// RateLimit 限流默认值，频道可单独覆盖
+	RateLimit RateLimitConfig `yaml:"rate_limit,omitempty"`
+	// Approval 高风险工具的人工审批
+	Approval ApprovalConfig `yaml:"approval,omitempty"`
+	// Roles 各角色可使用的工具与技能，覆盖同名内置角色（admin / member / guest），也可定义新角色
+	Roles map[string]RoleConfig `yaml:"roles,omitempty"`
+	// Jobs 用户创建的定时任务（schedule 工具、/remind 命令）
+	Jobs JobsConfig `yaml:"jobs,omitempty"`
+}
+
+// JobsConfig 定时任务配置
+//
+// 用户创建的任务保存在 data_dir/jobs.json，重启后继续执行。
+type JobsConfig struct {
+	// Disabled 关闭用户创建定时任务，配置中定义的任务仍会执行
+	Disabled bool `yaml:"disabled,omitempty"`
+	// MaxPerUser 每个用户最多的定时任务数，默认 20
+	MaxPerUser int `yaml:"max_per_user,omitempty"`
+	// Timezone 解析时间与 cron 表达式使用的时区，如 Asia/Shanghai，默认本地时区
+	Timezone string `yaml:"timezone,omitempty"`
+}
+
+// DedupConfig 入站消息去重配置
+type DedupConfig struct {
+	// Disabled 关闭去重
+	Disabled bool `yaml:"disabled,omitempty"`
+	// TTL 已处理消息 ID 的保留时长，默认 24h
+	TTL time.Duration `yaml:"ttl,omitempty"`
+}
+
+// EditConfig 用户编辑已发送消息时的处理方式
+//
+// 被编辑的消息总是替换会话历史中的原内容；被删除的消息从历史中移除。
+type EditConfig struct {
+	// Rerun 编辑的是会话中最后一轮时，丢弃原回复并按新内容重新运行，
+	// 支持的频道（Telegram）会原地修改之前的回复
+	Rerun bool `yaml:"rerun,omitempty"`
+}
+
+// ApprovalConfig 高风险工具调用的人工审批配置
+type ApprovalConfig struct {
+	// Enabled 启用审批，默认关闭，所有工具直接执行
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Timeout 等待用户决定的时间，超时视为拒绝，默认 2m
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Risk 按工具名通配覆盖风险等级（low / high），工具技能以 "skill:tool" 匹配
+	Risk map[string]string `yaml:"risk,omitempty"`
+}
+
+// 内置角色
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+	RoleGuest  = "guest"
+)
+
+// RoleConfig 角色权限规则
+//
+// 名称支持 * 通配（path.Match 语法）。工具技能的工具以 "skill:tool" 匹配 Tools；
+// 技能规则同时作用于 SKILL.md 技能和工具技能。先匹配 Deny*，再匹配允许列表，
+// 允许列表为空表示不允许任何工具 / 技能。
+type RoleConfig struct {
+	Tools      []string `yaml:"tools,omitempty"`
+	DenyTools  []string `yaml:"deny_tools,omitempty"`
+	Skills     []string `yaml:"skills,omitempty"`
+	DenySkills []string `yaml:"deny_skills,omitempty"`
+}
+
+// AccessConfig 频道访问控制
+//
+// 拒绝列表优先于允许列表；允许列表为空表示不限制。
+type AccessConfig struct {
+	// AllowUsers / DenyUsers 用户 ID 允许 / 拒绝列表
+	AllowUsers []string `yaml:"allow_users,omitempty"`
+	DenyUsers  []string `yaml:"deny_users,omitempty"`
+	// AllowChats / DenyChats 会话（群组、频道、私聊）ID 允许 / 拒绝列表
+	AllowChats []string `yaml:"allow_chats,omitempty"`
+	DenyChats  []string `yaml:"deny_chats,omitempty"`
+	// Users 用户 ID → 角色
+	Users map[string]string `yaml:"users,omitempty"`
+	// DefaultRole 未在 Users 中列出的用户的角色，默认 member
+	DefaultRole string `yaml:"default_role,omitempty"`
+	// Message 拒绝访问时回复给用户的提示
+	Message string `yaml:"message,omitempty"`
+}
+
+// RateLimitConfig 令牌桶限流配置
+//
+// 在网关级配置时 User / Chat / Channel 作为所有频道的默认值，Global 为全部频道共享的总量；
+// 在频道级配置时覆盖网关默认值，不支持 Global。
+type RateLimitConfig struct {
+	// User 单个用户
+	User RateConfig `yaml:"user,omitempty"`
+	// Chat 单个会话（群组、频道或私聊）
+	Chat RateConfig `yaml:"chat,omitempty"`
+	// Channel 整个频道适配器
+	Channel RateConfig `yaml:"channel,omitempty"`
+	// Global 全部频道合计
+	Global RateConfig `yaml:"global,omitempty"`
+	// Message 限流时回复给用户的提示，{retry_after} 替换为建议等待时间
+	Message string `yaml:"message,omitempty"`
+}
+
+// RateConfig 单个令牌桶：每 Per 时间补充 Rate 个令牌，最多积累 Burst 个
+type RateConfig struct {
+	// Rate 每个周期允许的消息数，0 表示沿用上一级配置，-1 表示不限制
+	Rate int `yaml:"rate,omitempty"`
+	// Per 周期，默认 1m
+	Per time.Duration `yaml:"per,omitempty"`
+	// Burst 允许的突发消息数，默认等于 Rate
+	Burst int `yaml:"burst,omitempty"`
+}
+
+// ChannelConfig 单个频道适配器配置
+//
+// 同一类型可以声明多个实例（例如多个 Telegram Bot），通过 Name 区分，
+// Name 同时作为 gateway.Message.Channel 用于回复路由。
+type ChannelConfig struct {
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type"` // telegram / discord / slack / http / openai / websocket
+	Disabled bool   `yaml:"disabled,omitempty"`
+	Token    string `yaml:"token,omitempty"`
+
+	// APIBaseURL 覆盖平台 REST API 地址（测试时可指向本地假服务）
+	APIBaseURL string `yaml:"api_base_url,omitempty"`
+	// GatewayURL 覆盖 Discord Gateway websocket 地址
+	GatewayURL string `yaml:"gateway_url,omitempty"`
+
+	// Mode 接收模式：Telegram 为 polling / webhook，Slack 为 socket / events
+	Mode string `yaml:"mode,omitempty"`
+	// AppToken Slack Socket Mode 的 app-level token (xapp-...)
+	AppToken string `yaml:"app_token,omitempty"`
+	// SigningSecret Slack Events API 请求签名密钥
+	SigningSecret string `yaml:"signing_secret,omitempty"`
+	// Listen 需要对外提供 HTTP 服务的频道监听地址，如 ":8080"
+	Listen string `yaml:"listen,omitempty"`
+	// Path HTTP 回调路径
+	Path string `yaml:"path,omitempty"`
+	// WebhookURL 注册到平台的公网回调地址（Telegram webhook 模式）
+	WebhookURL string `yaml:"webhook_url,omitempty"`
+	// SecretToken 平台回调时携带的校验密钥（Telegram X-Telegram-Bot-Api-Secret-Token）
+	SecretToken string `yaml:"secret_token,omitempty"`
+	// APIKeys 对外 HTTP API 允许的访问密钥
+	APIKeys []string `yaml:"api_keys,omitempty"`
+	// AllowedOrigins WebSocket 频道允许的浏览器来源（Origin 头），"*" 表示任意来源；
+	// 为空时只允许同源页面和不带 Origin 的非浏览器客户端
+	AllowedOrigins []string `yaml:"allowed_origins,omitempty"`
+	// AdminKeys 允许调用 HTTP 频道管理接口（如 /v1/ratelimits）的密钥，为空时不开放这些接口
+	AdminKeys []string `yaml:"admin_keys,omitempty"`
+	// NotifyKeys 允许调用 HTTP 频道 /v1/notify 向其他频道推送消息的密钥，为空时不开放该接口
+	NotifyKeys []string `yaml:"notify_keys,omitempty"`
+
+	// QueueSize 该频道排队消息上限（0 表示只受全局上限约束）
+	QueueSize int `yaml:"queue_size,omitempty"`
+	// Overload 覆盖全局过载策略
+	Overload string `yaml:"overload,omitempty"`
+
+	// Group 群聊策略（Telegram 群组、Discord 服务器频道、Slack 频道）
+	Group GroupConfig `yaml:"group,omitempty"`
+
+	// RateLimit 覆盖网关级限流配置
+	RateLimit RateLimitConfig `yaml:"rate_limit,omitempty"`
+
+	// Access 用户与会话的访问控制和角色分配
+	Access AccessConfig `yaml:"access,omitempty"`
+}
+
+// GroupConfig 群聊策略，未设置的字段使用默认值
+type GroupConfig struct {
+	// Trigger 何时回复：mention（默认，被 @、回复机器人消息或 / 命令时）/ all（每条消息）
+	Trigger string `yaml:"trigger,omitempty"`
+	// Context 会话上下文：shared（默认，全群共享）/ user（群内每个成员独立）
+	Context string `yaml:"context,omitempty"`
+	// SpeakerNames 在发给模型的历史中标注发言人，默认开启
+	SpeakerNames *bool `yaml:"speaker_names,omitempty"`
+	// Passive 将未触发回复的消息记录到会话，作为后续对话的上下文
+	Passive *bool `yaml:"passive,omitempty"`
+	// Threads 线程（Slack thread、Discord 子区）的会话归属：session（默认，每个线程独立会话，
+	// 线程内成员共享）/ chat（并入所在群聊的会话，按 Context 归属）；回复总是发在线程内
+	Threads string `yaml:"threads,omitempty"`
+	// Chats 按 chat ID 覆盖以上策略
+	Chats map[string]GroupConfig `yaml:"chats,omitempty"`
+}
+
+// Load 加载配置文件
+//
+// 文件内容支持 ${ENV} 形式引用环境变量；文件不存在时退回到
+// 仅从环境变量构建的默认配置，兼容旧的 .env 用法。
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return FromEnv(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(os.ExpandEnv(string(data))), &cfg); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+
+	if err := cfg.normalize(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// FromEnv 从环境变量构建默认配置
+func FromEnv() *Config {
+	cfg := &Config{Gateway: GatewayConfig{DataDir: "data"}}
+	if token := os.Getenv("TELEGRAM_BOT_TOKEN"); token != "" {
+		cfg.Channels = append(cfg.Channels, ChannelConfig{
+			Name:  "telegram",
+			Type:  "telegram",
+			Token: token,
+		})
+	}
+	return cfg
+}
+
+// normalize 填充默认值并校验
+func (c *Config) normalize() error {
+	if !validOverload(c.Gateway.Overload) {
+		return fmt.Errorf("gateway: 不支持的过载策略 %q", c.Gateway.Overload)
+	}
+	if c.Gateway.DataDir == "" {
+		c.Gateway.DataDir = "data"
+	}
+	if c.Gateway.Dedup.TTL < 0 {
+		return fmt.Errorf("gateway.dedup: ttl 不能为负数")
+	}
+	if err := c.Gateway.RateLimit.validate(); err != nil {
+		return fmt.Errorf("gateway.rate_limit: %w", err)
+	}
+	for pattern, risk := range c.Gateway.Approval.Risk {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("gateway.approval.risk: 无效的模式 %q", pattern)
+		}
+		if risk != "low" && risk != "high" {
+			return fmt.Errorf("gateway.approval.risk.%s: 不支持的风险等级 %q", pattern, risk)
+		}
+	}
+	for name, role := range c.Gateway.Roles {
+		if err := role.validate(); err != nil {
+			return fmt.Errorf("gateway.roles.%s: %w", name, err)
+		}
+	}
+
+	for name, a := range c.Agents {
+		if err := validatePatterns(a.Tools, a.DenyTools, a.Skills, a.DenySkills); err != nil {
+			return fmt.Errorf("agents.%s: %w", name, err)
+		}
+		if a.MaxToolRounds < 0 || a.Timeout < 0 {
+			return fmt.Errorf("agents.%s: max_tool_rounds 和 timeout 不能为负数", name)
+		}
+	}
+	for i, r := range c.Routes {
+		if _, ok := c.Agents[r.Agent]; !ok {
+			return fmt.Errorf("routes[%d]: 未定义的 Agent 配置 %q", i, r.Agent)
+		}
+	}
+	if c.Gateway.Jobs.MaxPerUser < 0 {
+		return fmt.Errorf("gateway.jobs: max_per_user 不能为负数")
+	}
+	if _, err := time.LoadLocation(c.Gateway.Jobs.Timezone); err != nil {
+		return fmt.Errorf("gateway.jobs: 无效的时区 %q", c.Gateway.Jobs.Timezone)
+	}
+
+	seen := make(map[string]bool)
+	for i := range c.Channels {
+		ch := &c.Channels[i]
+		if ch.Type == "" {
+			return fmt.Errorf("channels[%d]: 缺少 type", i)
+		}
+		if ch.Name == "" {
+			ch.Name = ch.Type
+		}
+		if seen[ch.Name] {
+			return fmt.Errorf("channels[%d]: 频道名称重复: %s", i, ch.Name)
+		}
+		seen[ch.Name] = true
+		if !validOverload(ch.Overload) {
+			return fmt.Errorf("channels[%d]: 不支持的过载策略 %q", i, ch.Overload)
+		}
+		if err := ch.Group.validate(); err != nil {
+			return fmt.Errorf("channels[%d].group: %w", i, err)
+		}
+		if ch.RateLimit.Global.Rate != 0 {
+			return fmt.Errorf("channels[%d].rate_limit: global 只能在 gateway 中配置", i)
+		}
+		if err := ch.RateLimit.validate(); err != nil {
+			return fmt.Errorf("channels[%d].rate_limit: %w", i, err)
+		}
+		if err := ch.Access.validate(c.Gateway.Roles); err != nil {
+			return fmt.Errorf("channels[%d].access: %w", i, err)
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, j := range c.Jobs {
+		if j.Name == "" || names[j.Name] {
+			return fmt.Errorf("jobs[%d]: 任务名称为空或重复", i)
+		}
+		names[j.Name] = true
+		if _, err := cron.Parse(j.Cron); err != nil {
+			return fmt.Errorf("jobs[%d]: %w", i, err)
+		}
+		if !seen[j.Channel] {
+			return fmt.Errorf("jobs[%d]: 未定义的频道 %q", i, j.Channel)
+		}
+		if j.Chat == "" || j.Prompt == "" {
+			return fmt.Errorf("jobs[%d]: 缺少 chat 或 prompt", i)
+		}
+		if j.Role != "" && !knownRole(j.Role, c.Gateway.Roles) {
+			return fmt.Errorf("jobs[%d]: 未定义的角色 %q", i, j.Role)
+		}
+	}
+	return nil
+}
+
+// validate 校验群聊策略取值
+func (g GroupConfig) validate() error {
+	switch g.Trigger {
+	case "", "mention", "all":
+	default:
+		return fmt.Errorf("不支持的 trigger %q", g.Trigger)
+	}
+	switch g.Context {
+	case "", "shared", "user":
+	default:
+		return fmt.Errorf("不支持的 context %q", g.Context)
+	}
+	switch g.Threads {
+	case "", "session", "chat":
+	default:
+		return fmt.Errorf("不支持的 threads %q", g.Threads)
+	}
+	for chatID, c := range g.Chats {
+		if len(c.Chats) > 0 {
+			return fmt.Errorf("chats.%s: 不支持嵌套 chats", chatID)
+		}
+		if err := c.validate(); err != nil {
+			return fmt.Errorf("chats.%s: %w", chatID, err)
+		}
+	}
+	return nil
+}
+
+// validate 校验限流配置取值
+func (r RateLimitConfig) validate() error {
+	scopes := []struct {
+		name string
+		rc   RateConfig
+	}{{"user", r.User}, {"chat", r.Chat}, {"channel", r.Channel}, {"global", r.Global}}
+	for _, s := range scopes {
+		if s.rc.Rate < -1 || s.rc.Per < 0 || s.rc.Burst < 0 {
+			return fmt.Errorf("%s: rate 不能小于 -1，per 和 burst 不能为负数", s.name)
+		}
+	}
+	return nil
+}
+
+// validate 校验通配模式语法
+func (r RoleConfig) validate() error {
+	return validatePatterns(r.Tools, r.DenyTools, r.Skills, r.DenySkills)
+}
+
+// validatePatterns 校验通配模式语法
+func validatePatterns(lists ...[]string) error {
+	for _, list := range lists {
+		for _, pattern := range list {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("无效的模式 %q", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// validate 校验引用的角色均已定义
+func (a AccessConfig) validate(roles map[string]RoleConfig) error {
+	if a.DefaultRole != "" && !knownRole(a.DefaultRole, roles) {
+		return fmt.Errorf("未定义的角色 %q", a.DefaultRole)
+	}
+	for user, role := range a.Users {
+		if !knownRole(role, roles) {
+			return fmt.Errorf("users.%s: 未定义的角色 %q", user, role)
+		}
+	}
+	return nil
+}
+
+// knownRole 角色为内置角色或已在 roles 中定义
+func knownRole(role string, roles map[string]RoleConfig) bool {
+	switch role {
+	case RoleAdmin, RoleMember, RoleGuest:
+		return true
+	}
+	_, ok := roles[role]
+	return ok
+}
+
+// validOverload 过载策略为空或受支持
+func validOverload(policy string) bool {
+	switch policy {
+	case "", "reject", "drop_oldest", "coalesce":
+		return true
+	}
+	return false
+}
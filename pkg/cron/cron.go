@@ -0,0 +1,221 @@
+// Package cron 解析标准 5 字段 cron 表达式并计算下次执行时间
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearchYears 查找下次执行时间的范围，超出视为永不执行（如 2 月 30 日）
+const maxSearchYears = 5
+
+// macros 预定义的表达式
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// field 字段的取值范围与名称
+type field struct {
+	name     string
+	min, max int
+	names    []string // 从 min 开始的名称（可选），如 JAN、SUN
+}
+
+var fields = [5]field{
+	{name: "分钟", min: 0, max: 59},
+	{name: "小时", min: 0, max: 23},
+	{name: "日", min: 1, max: 31},
+	{name: "月", min: 1, max: 12, names: []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}},
+	{name: "星期", min: 0, max: 7, names: []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}},
+}
+
+// Schedule 解析后的 cron 表达式
+//
+// 字段依次为：分钟 小时 日 月 星期，支持 *、列表（1,2）、范围（1-5）、
+// 步长（*/15、1-30/5）以及月份和星期的英文缩写，星期中 0 和 7 都表示周日。
+// 日和星期都受限制时满足其一即可，与 Vixie cron 一致。
+type Schedule struct {
+	expr string
+	bits [5]uint64
+	// 日、星期字段以 * 开头时不受限制
+	domAny, dowAny bool
+	// 小时字段以 * 开头，夏令时结束重复的一小时内照常执行
+	hourAny bool
+}
+
+// Parse 解析 5 字段 cron 表达式或 @daily 等预定义表达式
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	spec := expr
+	if m, ok := macros[strings.ToLower(spec)]; ok {
+		spec = m
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("cron 表达式 %q 需要 5 个字段（分钟 小时 日 月 星期）", expr)
+	}
+
+	s := &Schedule{expr: expr}
+	for i, part := range parts {
+		bits, err := fields[i].parse(part)
+		if err != nil {
+			return nil, fmt.Errorf("cron 表达式 %q 的%s字段: %w", expr, fields[i].name, err)
+		}
+		s.bits[i] = bits
+	}
+	// 星期中 7 与 0 都表示周日
+	if s.bits[4]&(1<<7) != 0 {
+		s.bits[4] |= 1
+	}
+	s.hourAny = strings.HasPrefix(parts[1], "*")
+	s.domAny = strings.HasPrefix(parts[2], "*")
+	s.dowAny = strings.HasPrefix(parts[4], "*")
+	return s, nil
+}
+
+// parse 解析一个字段，返回取值的位集合
+func (f field) parse(spec string) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(spec, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("无效的步长 %q", stepStr)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(a); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(b); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("无效的范围 %q", rng)
+			}
+		default:
+			v, err := f.value(rng)
+			if err != nil {
+				return 0, err
+			}
+			// "5/10" 表示从 5 开始每 10 个
+			lo, hi = v, v
+			if hasStep {
+				hi = f.max
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// value 解析单个取值，支持名称
+func (f field) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("取值 %q 超出范围 %d-%d", s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// String 返回原始表达式
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// Next 返回 t 之后（不含 t）最近一次执行时间，使用 t 的时区；
+// 找不到时返回零值
+//
+// 夏令时开始时被跳过的本地时间当天不执行；夏令时结束时重复的本地时间
+// 只在第一次出现时执行，小时字段以 * 开头的表达式在重复的一小时内照常执行。
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	// 按绝对时间取下一分钟，夏令时结束重复的一小时内不会回到第一次出现的时刻
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxSearchYears, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case !s.has(3, int(t.Month())):
+			t = date(t.Year(), t.Month()+1, 1, 0, loc)
+		case !s.dayMatches(t):
+			t = date(t.Year(), t.Month(), t.Day()+1, 0, loc)
+		case !s.has(1, t.Hour()):
+			t = date(t.Year(), t.Month(), t.Day(), t.Hour()+1, loc)
+		case !s.has(0, t.Minute()), !s.hourAny && repeated(t) > 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// date 返回本地时间的整点：该时刻因夏令时开始而不存在时返回跳变之后的时刻，
+// 因夏令时结束出现两次时返回第一次
+//
+// time.Date 对这两种时刻的选择不固定，不存在的时刻可能返回跳变之前的时间
+// （如 2:00 → 1:00），向后查找时会原地打转。
+func date(year int, month time.Month, day, hour int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, hour, 0, 0, 0, loc)
+	want := time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+	t = t.Add(want.Sub(wall(t)))
+	return t.Add(-repeated(t))
+}
+
+// repeated 本地时间因夏令时结束而第二次出现时，返回与第一次出现相隔的时长，否则返回 0
+func repeated(t time.Time) time.Duration {
+	_, now := t.Zone()
+	_, before := t.Add(-3 * time.Hour).Zone()
+	back := time.Duration(before-now) * time.Second
+	if back > 0 && wall(t.Add(-back)).Equal(wall(t)) {
+		return back
+	}
+	return 0
+}
+
+// wall 以 UTC 表示的本地时间，用于比较墙上时钟
+func wall(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+// has 字段 i 是否包含取值 v
+func (s *Schedule) has(i, v int) bool {
+	return s.bits[i]&(1<<uint(v)) != 0
+}
+
+// dayMatches 日与星期的匹配：都受限制时满足其一，否则都需满足
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.has(2, t.Day())
+	dow := s.has(4, int(t.Weekday()))
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
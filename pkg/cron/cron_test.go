@@ -0,0 +1,144 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{"* * * * *", false},
+		{"*/15 9-18 * * MON-FRI", false},
+		{"0 0 1,15 jan,jul *", false},
+		{"5/10 * * * 7", false},
+		{"@daily", false},
+		{"@Hourly", false},
+		{"", true},
+		{"* * * *", true},
+		{"60 * * * *", true},
+		{"* 24 * * *", true},
+		{"* * 0 * *", true},
+		{"* * * 13 *", true},
+		{"* * * * 8", true},
+		{"5-1 * * * *", true},
+		{"*/0 * * * *", true},
+		{"@never", true},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) err = %v，期望出错 %v", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("缺少时区数据:", err)
+	}
+	at := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, shanghai)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		expr string
+		from string
+		want string // 空表示永不执行
+	}{
+		{"* * * * *", "2026-01-01 10:00", "2026-01-01 10:01"},
+		{"0 * * * *", "2026-01-01 10:00", "2026-01-01 11:00"},
+		{"30 9 * * *", "2026-01-01 09:30", "2026-01-02 09:30"},
+		{"*/15 * * * *", "2026-01-01 10:07", "2026-01-01 10:15"},
+		{"0 9 * * MON-FRI", "2026-01-02 10:00", "2026-01-05 09:00"}, // 周五之后是下周一
+		{"0 0 1 * *", "2026-01-31 12:00", "2026-02-01 00:00"},
+		{"0 0 29 2 *", "2026-03-01 00:00", "2028-02-29 00:00"},
+		{"0 0 1 * 0", "2026-01-02 00:00", "2026-01-04 00:00"}, // 日与星期满足其一
+		{"0 12 * * 7", "2026-01-01 00:00", "2026-01-04 12:00"},
+		{"@yearly", "2026-06-01 00:00", "2027-01-01 00:00"},
+		{"0 0 30 2 *", "2026-01-01 00:00", ""},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := s.Next(at(tt.from))
+		if tt.want == "" {
+			if !got.IsZero() {
+				t.Errorf("%q.Next(%s) = %s，期望永不执行", tt.expr, tt.from, got)
+			}
+			continue
+		}
+		if !got.Equal(at(tt.want)) {
+			t.Errorf("%q.Next(%s) = %s，期望 %s", tt.expr, tt.from, got.Format("2006-01-02 15:04"), tt.want)
+		}
+	}
+}
+
+func TestNextDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("缺少时区数据:", err)
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("缺少时区数据:", err)
+	}
+	santiago, err := time.LoadLocation("America/Santiago")
+	if err != nil {
+		t.Skip("缺少时区数据:", err)
+	}
+
+	// 纽约 2026-03-08 02:00 EST 跳到 03:00 EDT，2026-11-01 02:00 EDT 回到 01:00 EST
+	// 柏林 2026-10-25 03:00 CEST 回到 02:00 CET；圣地亚哥 2026-09-06 00:00 跳到 01:00
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want []string // 依次的执行时间（UTC）
+	}{
+		{"跳过的时刻当天不执行", "30 2 * * *", time.Date(2026, 3, 8, 0, 0, 0, 0, newYork),
+			[]string{"2026-03-09 06:30"}},
+		{"跳变后的整点", "0 * * * *", time.Date(2026, 3, 8, 0, 30, 0, 0, newYork),
+			[]string{"2026-03-08 06:00", "2026-03-08 07:00", "2026-03-08 08:00"}},
+		{"重复的时刻只执行一次", "30 1 * * *", time.Date(2026, 11, 1, 0, 0, 0, 0, newYork),
+			[]string{"2026-11-01 05:30", "2026-11-02 06:30"}},
+		{"小时通配在重复的一小时内照常执行", "30 * * * *", time.Date(2026, 11, 1, 0, 45, 0, 0, newYork),
+			[]string{"2026-11-01 05:30", "2026-11-01 06:30", "2026-11-01 07:30"}},
+		{"从第二次出现的时刻继续", "30 1 * * *", time.Date(2026, 11, 1, 6, 30, 0, 0, time.UTC).In(newYork),
+			[]string{"2026-11-02 06:30"}},
+		{"东半球的重复时刻只执行一次", "30 2 * * *", time.Date(2026, 10, 25, 0, 0, 0, 0, berlin),
+			[]string{"2026-10-25 00:30", "2026-10-26 01:30"}},
+		{"午夜不存在时跨日", "0 12 * * *", time.Date(2026, 9, 5, 13, 0, 0, 0, santiago),
+			[]string{"2026-09-06 15:00"}},
+		{"跳过的午夜", "0 0 * * *", time.Date(2026, 9, 5, 12, 0, 0, 0, santiago),
+			[]string{"2026-09-07 03:00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			next := tt.from
+			for _, want := range tt.want {
+				got := s.Next(next)
+				if !got.After(next) {
+					t.Fatalf("Next(%s) = %s，没有向后推进", next, got)
+				}
+				if g := got.UTC().Format("2006-01-02 15:04"); g != want {
+					t.Fatalf("Next(%s) = %s UTC，期望 %s UTC", next, g, want)
+				}
+				next = got
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package gateway
+
+import (
+	"errors"
+	"path"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/agent"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+)
+
+// ErrForbidden 用户或会话无权使用机器人
+var ErrForbidden = errors.New("无权访问")
+
+// defaultDeniedMessage 拒绝访问时的默认提示
+const defaultDeniedMessage = "抱歉，你没有使用这个机器人的权限，请联系管理员开通"
+
+// builtinRoles 内置角色：admin 不受限制；member 不能执行命令和写文件；guest 只能搜索网页
+var builtinRoles = map[string]config.RoleConfig{
+	config.RoleAdmin: {
+		Tools:  []string{"*"},
+		Skills: []string{"*"},
+	},
+	config.RoleMember: {
+		Tools:     []string{"*"},
+		DenyTools: []string{"exec_shell", "write_file", "*:exec", "*:write"},
+		Skills:    []string{"*"},
+	},
+	config.RoleGuest: {
+		Tools: []string{"web_search"},
+	},
+}
+
+// accessControl 按频道的允许 / 拒绝列表判断访问权限，并为用户分配角色
+type accessControl struct {
+	// enabled 经 Configure 配置后启用；终端对话模式下本地用户视为 admin
+	enabled  bool
+	roles    map[string]config.RoleConfig
+	channels map[string]config.AccessConfig
+}
+
+// newAccessControl 创建未启用的访问控制
+func newAccessControl() *accessControl {
+	return &accessControl{
+		roles:    make(map[string]config.RoleConfig),
+		channels: make(map[string]config.AccessConfig),
+	}
+}
+
+// configure 应用角色规则与各频道的访问控制
+func (a *accessControl) configure(cfg *config.Config) {
+	a.enabled = true
+	for name, role := range builtinRoles {
+		a.roles[name] = role
+	}
+	for name, role := range cfg.Gateway.Roles {
+		a.roles[name] = role
+	}
+	for _, ch := range cfg.Channels {
+		a.channels[ch.Name] = ch.Access
+	}
+}
+
+// authorize 返回用户的角色，无权访问时返回 false
+//
+// 拒绝列表优先；配置了允许列表时，用户、所在会话或已分配角色的用户命中其一即可。
+// 只看当前频道的身份，跨频道关联的身份不带来角色或允许列表资格。
+func (a *accessControl) authorize(channel, chatID, userID string) (string, bool) {
+	if !a.enabled {
+		return config.RoleAdmin, true
+	}
+
+	ac := a.channels[channel]
+	if contains(ac.DenyUsers, userID) || contains(ac.DenyChats, chatID) {
+		return "", false
+	}
+
+	role, assigned := ac.Users[userID]
+	if len(ac.AllowUsers)+len(ac.AllowChats) > 0 && !assigned &&
+		!contains(ac.AllowUsers, userID) && !contains(ac.AllowChats, chatID) {
+		return "", false
+	}
+
+	if !assigned {
+		role = ac.DefaultRole
+	}
+	if role == "" {
+		role = config.RoleMember
+	}
+	return role, true
+}
+
+// deniedMessage 拒绝访问的提示
+func (a *accessControl) deniedMessage(channel string) string {
+	if m := a.channels[channel].Message; m != "" {
+		return m
+	}
+	return defaultDeniedMessage
+}
+
+// runOptions 按角色规则限制本次运行可用的工具与技能
+func (a *accessControl) runOptions(role string) agent.RunOptions {
+	if !a.enabled {
+		return agent.RunOptions{}
+	}
+	rules := a.roles[role]
+	return agent.RunOptions{
+		AllowTool:  matcher(rules.Tools, rules.DenyTools),
+		AllowSkill: matcher(rules.Skills, rules.DenySkills),
+	}
+}
+
+// matcher 先匹配拒绝模式，再匹配允许模式
+func matcher(allow, deny []string) func(string) bool {
+	return func(name string) bool {
+		return !matchAny(deny, name) && matchAny(allow, name)
+	}
+}
+
+// matchAny 名称是否匹配任一通配模式
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// contains 列表中是否包含 s
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
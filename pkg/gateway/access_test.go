@@ -0,0 +1,49 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+)
+
+func TestAccessAuthorize(t *testing.T) {
+	a := newAccessControl()
+	a.configure(&config.Config{Channels: []config.ChannelConfig{
+		{Name: "telegram", Access: config.AccessConfig{
+			Users:       map[string]string{"100": config.RoleAdmin},
+			DefaultRole: config.RoleGuest,
+		}},
+		{Name: "slack", Access: config.AccessConfig{
+			AllowUsers: []string{"U1"},
+			DenyUsers:  []string{"U9"},
+			Users:      map[string]string{"U2": config.RoleMember},
+		}},
+	}})
+
+	// telegram:100 是管理员，但关联到 slack:U3 后 U3 仍按 slack 自己的配置判断
+	d := newIdentities()
+	code := d.newCode("telegram", "100")
+	if _, err := d.redeem(code, "slack", "U3"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		channel, chat, user string
+		role                string
+		allowed             bool
+	}{
+		{"telegram", "1", "100", config.RoleAdmin, true},
+		{"telegram", "1", "200", config.RoleGuest, true},
+		{"slack", "C1", "U1", config.RoleMember, true},
+		{"slack", "C1", "U2", config.RoleMember, true},
+		{"slack", "C1", "U3", "", false},
+		{"slack", "C1", "U9", "", false},
+		{"discord", "c1", "u1", config.RoleMember, true},
+	}
+	for _, tt := range tests {
+		role, allowed := a.authorize(tt.channel, tt.chat, tt.user)
+		if role != tt.role || allowed != tt.allowed {
+			t.Errorf("authorize(%s, %s) = %q, %v, want %q, %v", tt.channel, tt.user, role, allowed, tt.role, tt.allowed)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/agent"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/tools"
+)
+
+// DefaultApprovalTimeout 默认等待用户审批的时间
+const DefaultApprovalTimeout = 2 * time.Minute
+
+// Decision 用户对工具调用的审批决定
+type Decision string
+
+const (
+	// DecisionApprove 允许本次调用
+	DecisionApprove Decision = "approve"
+	// DecisionDeny 拒绝本次调用
+	DecisionDeny Decision = "deny"
+	// DecisionAlways 允许本次调用，并在当前会话中不再询问该工具
+	DecisionAlways Decision = "always"
+)
+
+// ParseDecision 解析审批决定
+func ParseDecision(s string) (Decision, bool) {
+	switch d := Decision(s); d {
+	case DecisionApprove, DecisionDeny, DecisionAlways:
+		return d, true
+	}
+	return "", false
+}
+
+// 审批结果错误，作为工具结果反馈给模型
+var (
+	ErrApprovalDenied  = errors.New("用户拒绝执行该操作")
+	ErrApprovalTimeout = errors.New("等待用户审批超时，已默认拒绝")
+	// ErrApprovalNotFound 审批请求不存在或已结束
+	ErrApprovalNotFound = errors.New("审批请求不存在或已结束")
+	// ErrApprovalForbidden 只有发起请求的用户或管理员可以审批
+	ErrApprovalForbidden = errors.New("只有发起请求的用户或管理员可以审批")
+)
+
+// ApprovalRequest 等待用户审批的工具调用
+type ApprovalRequest struct {
+	ID      string    `json:"id"`
+	Tool    string    `json:"tool"`
+	Args    string    `json:"args"`
+	Risk    string    `json:"risk"`
+	Expires time.Time `json:"expires_at"`
+}
+
+// ApprovalSender 支持交互式审批的频道（按钮、终端确认、HTTP 回调等）
+//
+// 频道收到用户的决定后调用 Gateway.ResolveApproval。未实现该接口的频道
+// 以文本消息提示用户回复 /approve、/deny 或 /always 命令。
+type ApprovalSender interface {
+	SendApproval(msg Message, req ApprovalRequest) error
+}
+
+// pendingApproval 等待决定的审批
+type pendingApproval struct {
+	req      ApprovalRequest
+	msg      Message
+	decision chan Decision
+}
+
+// approvals 高风险工具调用的审批状态
+type approvals struct {
+	// 配置，需在 Start 之前设置
+	enabled bool
+	timeout time.Duration
+	risk    map[string]string // 工具名通配 → 风险等级
+
+	mu      sync.Mutex
+	pending map[string]*pendingApproval
+	always  map[string]map[string]bool // 会话键 → 始终允许的工具
+}
+
+// newApprovals 创建审批状态，默认关闭
+func newApprovals() *approvals {
+	return &approvals{
+		timeout: DefaultApprovalTimeout,
+		risk:    make(map[string]string),
+		pending: make(map[string]*pendingApproval),
+		always:  make(map[string]map[string]bool),
+	}
+}
+
+// configure 应用审批配置
+func (a *approvals) configure(cfg config.ApprovalConfig) {
+	a.enabled = cfg.Enabled
+	if cfg.Timeout > 0 {
+		a.timeout = cfg.Timeout
+	}
+	for pattern, risk := range cfg.Risk {
+		a.risk[pattern] = risk
+	}
+}
+
+// riskOf 按配置覆盖工具的风险等级：精确名称优先，其次按模式字典序匹配
+func (a *approvals) riskOf(name, builtin string) string {
+	if risk, ok := a.risk[name]; ok {
+		return risk
+	}
+	patterns := make([]string, 0, len(a.risk))
+	for p := range a.risk {
+		patterns = append(patterns, p)
+	}
+	sort.Strings(patterns)
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return a.risk[p]
+		}
+	}
+	return builtin
+}
+
+// approver 返回本次运行的审批回调，审批关闭时返回 nil
+func (g *Gateway) approver(msg Message) func(context.Context, agent.ToolApproval) error {
+	if !g.approvals.enabled {
+		return nil
+	}
+	return func(ctx context.Context, call agent.ToolApproval) error {
+		return g.requestApproval(ctx, msg, call)
+	}
+}
+
+// denyRisky 无法交互审批的运行直接拒绝高风险工具
+func (a *approvals) denyRisky(_ context.Context, call agent.ToolApproval) error {
+	if a.riskOf(call.ToolName, call.Risk) == tools.RiskHigh {
+		return errors.New("该工具需要人工审批，但当前频道不支持审批，已拒绝")
+	}
+	return nil
+}
+
+// requestApproval 高风险工具调用暂停运行，等待用户决定
+func (g *Gateway) requestApproval(ctx context.Context, msg Message, call agent.ToolApproval) error {
+	a := g.approvals
+	risk := a.riskOf(call.ToolName, call.Risk)
+	if risk != tools.RiskHigh {
+		return nil
+	}
+
+	key := msg.SessionKey()
+	p := &pendingApproval{
+		req: ApprovalRequest{
+			ID:      newApprovalID(),
+			Tool:    call.ToolName,
+			Args:    call.Args,
+			Risk:    risk,
+			Expires: time.Now().Add(a.timeout),
+		},
+		msg:      msg,
+		decision: make(chan Decision, 1),
+	}
+
+	a.mu.Lock()
+	if a.always[key][call.ToolName] {
+		a.mu.Unlock()
+		return nil
+	}
+	a.pending[p.req.ID] = p
+	a.mu.Unlock()
+
+	defer func() {
+		a.mu.Lock()
+		delete(a.pending, p.req.ID)
+		a.mu.Unlock()
+	}()
+
+	log.Printf("[%s] 工具 %s 等待 %s 审批（%s）", msg.Channel, call.ToolName, msg.UserID, p.req.ID)
+	g.sendApproval(msg, p.req)
+
+	timer := time.NewTimer(a.timeout)
+	defer timer.Stop()
+
+	select {
+	case d := <-p.decision:
+		log.Printf("[%s] 审批 %s: %s", msg.Channel, p.req.ID, d)
+		switch d {
+		case DecisionAlways:
+			a.mu.Lock()
+			if a.always[key] == nil {
+				a.always[key] = make(map[string]bool)
+			}
+			a.always[key][call.ToolName] = true
+			a.mu.Unlock()
+			return nil
+		case DecisionApprove:
+			return nil
+		}
+		return ErrApprovalDenied
+	case <-timer.C:
+		log.Printf("[%s] 审批 %s 超时", msg.Channel, p.req.ID)
+		return ErrApprovalTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sendApproval 通过频道的交互方式发送审批请求，不支持时发送文本提示
+func (g *Gateway) sendApproval(msg Message, req ApprovalRequest) {
+	if ch, ok := g.Channel(msg.Channel); ok {
+		if as, ok := ch.(ApprovalSender); ok {
+			err := as.SendApproval(msg, req)
+			if err == nil {
+				return
+			}
+			log.Printf("[%s] 发送审批请求失败，改用文本提示: %v", msg.Channel, err)
+		}
+	}
+	g.sendReply(msg, approvalText(req), nil)
+}
+
+// approvalText 审批请求的文本提示
+func approvalText(req ApprovalRequest) string {
+	return fmt.Sprintf("⚠️ 需要你的确认才能执行高风险工具 %s\n参数: %s\n\n"+
+		"回复 /approve %s 允许，/deny %s 拒绝，/always %s 在本会话中始终允许该工具（%s 内未确认将自动拒绝）",
+		req.Tool, preview(req.Args, 500), req.ID, req.ID, req.ID, formatWait(time.Until(req.Expires)))
+}
+
+// ResolveApproval 提交用户对审批请求的决定
+//
+// 只有发起请求的用户或该频道的管理员可以审批。
+func (g *Gateway) ResolveApproval(channel, userID, id string, d Decision) error {
+	a := g.approvals
+
+	a.mu.Lock()
+	p, ok := a.pending[id]
+	a.mu.Unlock()
+	if !ok || p.msg.Channel != channel {
+		return ErrApprovalNotFound
+	}
+
+	if userID != p.msg.UserID {
+		role, _ := g.access.authorize(channel, p.msg.ChatID, userID)
+		if role != config.RoleAdmin {
+			return ErrApprovalForbidden
+		}
+	}
+
+	select {
+	case p.decision <- d:
+		return nil
+	default:
+		return ErrApprovalNotFound
+	}
+}
+
+// PendingApproval 返回等待中的审批请求
+func (g *Gateway) PendingApproval(id string) (ApprovalRequest, Message, bool) {
+	g.approvals.mu.Lock()
+	defer g.approvals.mu.Unlock()
+
+	p, ok := g.approvals.pending[id]
+	if !ok {
+		return ApprovalRequest{}, Message{}, false
+	}
+	return p.req, p.msg, true
+}
+
+// clearAlways 清除会话的始终允许记录
+func (a *approvals) clearAlways(key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.always, key)
+}
+
+// newApprovalID 生成简短的审批 ID，便于用户在命令中输入
+func newApprovalID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// preview 截断过长的文本
+func preview(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
@@ -0,0 +1,195 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/agent"
+)
+
+// MaxAttachmentSize 单个附件的大小上限
+const MaxAttachmentSize = 20 << 20
+
+// AttachmentKind 附件类型
+type AttachmentKind string
+
+const (
+	AttachmentImage    AttachmentKind = "image"
+	AttachmentAudio    AttachmentKind = "audio"
+	AttachmentVideo    AttachmentKind = "video"
+	AttachmentDocument AttachmentKind = "document"
+)
+
+// Attachment 消息附件
+//
+// 入站附件由适配器填充元数据和下载函数，内容在网关处理时才按需下载；
+// 出站附件通常由 FileAttachment 从本地文件创建。
+type Attachment struct {
+	Kind     AttachmentKind
+	MIMEType string
+	Size     int64 // 字节数，未知时为 0
+	FileName string
+	Path     string // 本地文件路径（仅出站文件附件）
+
+	// Open 打开附件内容
+	Open func(ctx context.Context) (io.ReadCloser, error)
+}
+
+// KindOf 根据 MIME 类型推断附件类型
+func KindOf(mimeType string) AttachmentKind {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return AttachmentImage
+	case strings.HasPrefix(mimeType, "audio/"):
+		return AttachmentAudio
+	case strings.HasPrefix(mimeType, "video/"):
+		return AttachmentVideo
+	default:
+		return AttachmentDocument
+	}
+}
+
+// FileAttachment 从本地文件创建附件
+func FileAttachment(path string) (Attachment, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Attachment{}, err
+	}
+	if info.IsDir() {
+		return Attachment{}, fmt.Errorf("%s 是目录", path)
+	}
+
+	mimeType := mime.TypeByExtension(filepath.Ext(path))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return Attachment{
+		Kind:     KindOf(mimeType),
+		MIMEType: mimeType,
+		Size:     info.Size(),
+		FileName: filepath.Base(path),
+		Path:     path,
+		Open: func(ctx context.Context) (io.ReadCloser, error) {
+			return os.Open(path)
+		},
+	}, nil
+}
+
+// Read 读取附件全部内容，超过 MaxAttachmentSize 时返回错误
+func (a Attachment) Read(ctx context.Context) ([]byte, error) {
+	if a.Open == nil {
+		return nil, fmt.Errorf("附件 %s 没有内容", a.FileName)
+	}
+	if a.Size > MaxAttachmentSize {
+		return nil, fmt.Errorf("附件 %s 过大: %d 字节", a.FileName, a.Size)
+	}
+
+	rc, err := a.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, MaxAttachmentSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxAttachmentSize {
+		return nil, fmt.Errorf("附件 %s 超过 %d 字节", a.FileName, MaxAttachmentSize)
+	}
+	return data, nil
+}
+
+// prepareInput 处理入站附件
+//
+// 图片作为多模态内容交给模型；其他文件保存到工作区 attachments 目录，
+// 并在文本中注明路径供工具读取。返回写入会话的文本和本轮的图片内容。
+func (g *Gateway) prepareInput(ctx context.Context, msg Message) (string, []agent.ContentPart) {
+	text := msg.Text
+	var images []agent.ContentPart
+
+	for i, att := range msg.Attachments {
+		name := att.FileName
+		if name == "" {
+			name = fmt.Sprintf("%s-%d", att.Kind, i+1)
+		}
+
+		data, err := att.Read(ctx)
+		if err != nil {
+			log.Printf("[%s] 下载附件 %s 失败: %v", msg.Channel, name, err)
+			text += fmt.Sprintf("\n[附件 %s 下载失败]", name)
+			continue
+		}
+
+		if att.Kind == AttachmentImage {
+			images = append(images, agent.ImagePart(att.MIMEType, data))
+			text += fmt.Sprintf("\n[图片: %s]", name)
+			continue
+		}
+
+		path, err := g.saveAttachment(msg, name, data)
+		if err != nil {
+			log.Printf("[%s] 保存附件 %s 失败: %v", msg.Channel, name, err)
+			text += fmt.Sprintf("\n[附件 %s 保存失败]", name)
+			continue
+		}
+		text += fmt.Sprintf("\n[用户上传了文件: %s（%s，%d 字节）]", path, att.MIMEType, len(data))
+	}
+
+	return strings.TrimSpace(text), images
+}
+
+// saveAttachment 将附件保存到 {workspace}/attachments/{channel}/{chat}/
+func (g *Gateway) saveAttachment(msg Message, name string, data []byte) (string, error) {
+	dir := filepath.Join(g.agent.Workspace(), "attachments", safeName(msg.Channel), safeName(msg.ChatID))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	// 加时间戳前缀避免同名文件互相覆盖
+	path := filepath.Join(dir, fmt.Sprintf("%d-%s", time.Now().UnixNano(), safeName(name)))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// replyAttachments 将 Agent 要求发送的文件转换为回复附件
+func replyAttachments(paths []string) []Attachment {
+	var atts []Attachment
+	for _, path := range paths {
+		att, err := FileAttachment(path)
+		if err != nil {
+			log.Printf("附加文件 %s 失败: %v", path, err)
+			continue
+		}
+		atts = append(atts, att)
+	}
+	return atts
+}
+
+// safeName 去除路径分隔符等不安全字符，用作文件或目录名
+func safeName(s string) string {
+	s = filepath.Base(s)
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		if r < 0x20 {
+			return '_'
+		}
+		return r
+	}, s)
+	if s == "" || s == "." || s == ".." {
+		return "_"
+	}
+	return s
+}
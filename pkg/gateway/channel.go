@@ -0,0 +1,89 @@
+package gateway
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/agent"
+)
+
+// Channel 频道适配器接口
+//
+// 适配器在 pkg/channel 中实现并通过 RegisterChannel 注册到网关，
+// 网关依赖此接口回发消息，因此无需反向引用 pkg/channel。
+type Channel interface {
+	// Name 适配器名称，与 Message.Channel 对应
+	Name() string
+	// Start 开始接收消息（阻塞直到停止或出错）
+	Start() error
+	// Stop 停止接收消息
+	Stop()
+	// Send 发送回复到频道
+	Send(reply Reply) error
+}
+
+// EventSender 支持流式事件的频道可选实现
+//
+// 实现该接口的频道会在 Agent 运行过程中收到文本增量和工具调用事件，
+// 最终回复仍通过 Send 发送。
+type EventSender interface {
+	SendEvent(msg Message, ev agent.Event) error
+}
+
+// ReplyEditor 支持修改已发送回复的频道可选实现
+//
+// 用户编辑消息后重新运行时，网关通过 EditReply 替换之前对 ReplyToID 的回复；
+// 返回 false 表示找不到原回复，网关改为发送新回复。
+type ReplyEditor interface {
+	EditReply(reply Reply) (bool, error)
+}
+
+// DropReporter 需要自行处理被丢弃消息的频道可选实现
+//
+// 排队中的消息被 drop_oldest 策略丢弃时，网关默认向会话回复繁忙提示；
+// 实现该接口的频道（如按 run 返回结果的 HTTP）改为收到 ReportDropped，notice 为繁忙提示。
+type DropReporter interface {
+	ReportDropped(msg Message, notice string) error
+}
+
+// Reply 发往频道的回复
+type Reply struct {
+	ChatID    string
+	ThreadID  string // 在该线程内回复（可选）
+	Text      string
+	ReplyToID string // 被回复的入站消息 ID（可选）
+
+	// CoalescedIDs 与 ReplyToID 合并为同一轮处理的较早入站消息 ID
+	CoalescedIDs []string
+
+	Attachments []Attachment // 随回复发送的文件（可选）
+}
+
+// RegisterChannel 注册频道适配器
+func (g *Gateway) RegisterChannel(ch Channel) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.channels[ch.Name()]; ok {
+		log.Printf("频道 %s 已注册，将被覆盖", ch.Name())
+	}
+	g.channels[ch.Name()] = ch
+}
+
+// Channel 按名称获取已注册的频道适配器
+func (g *Gateway) Channel(name string) (Channel, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	ch, ok := g.channels[name]
+	return ch, ok
+}
+
+// send 通过消息来源频道发送回复
+func (g *Gateway) send(channel string, reply Reply) error {
+	ch, ok := g.Channel(channel)
+	if !ok {
+		return fmt.Errorf("未注册的频道: %s", channel)
+	}
+	return ch.Send(reply)
+}
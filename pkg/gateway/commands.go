@@ -0,0 +1,394 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/skill"
+)
+
+// command 网关内置命令
+type command struct {
+	name  string // 不含 / 的命令名
+	usage string // 参数说明（可选）
+	desc  string
+	run   func(g *Gateway, msg Message, args string) string
+
+	// serial 修改会话状态，排在会话队列中执行，不与进行中的运行交错修改历史
+	serial bool
+	// stop 执行前停止会话中进行和排队中的请求
+	stop bool
+	// admin 在多人共享的会话中只有管理员可以执行
+	admin bool
+}
+
+// builtinCommands 网关内置命令，按帮助中的显示顺序排列
+func builtinCommands() []command {
+	return []command{
+		{name: "help", desc: "显示可用命令", run: (*Gateway).cmdHelp},
+		{name: "reset", desc: "清空当前会话的对话历史（多人共享的会话需要管理员）", run: (*Gateway).cmdReset, serial: true, stop: true, admin: true},
+		{name: "model", usage: "[模型名|default]", desc: "查看或切换当前会话使用的模型（切换需要管理员）", run: (*Gateway).cmdModel, serial: true},
+		{name: "skills", desc: "列出可以用命令调用的技能", run: (*Gateway).cmdSkills},
+		{name: "stop", desc: "停止当前会话正在进行和排队中的请求（多人共享的会话需要管理员）", run: (*Gateway).cmdStop, admin: true},
+		{name: "whoami", desc: "显示你的身份与角色", run: (*Gateway).cmdWhoami},
+		{name: "link", usage: "[关联码]", desc: "关联你在其他频道的身份，共享私聊对话和额度", run: (*Gateway).cmdLink},
+		{name: "unlink", desc: "解除当前频道身份的关联", run: (*Gateway).cmdUnlink},
+		{name: "remind", usage: "<时间> <内容>", desc: "定时让助手执行，如 /remind 30m 提醒我开会、/remind \"0 9 * * 1-5\" 汇总昨天的告警", run: (*Gateway).cmdRemind},
+		{name: "jobs", desc: "列出当前会话的定时任务", run: (*Gateway).cmdJobs},
+		{name: "cancel", usage: "<ID>", desc: "取消定时任务", run: (*Gateway).cmdCancel},
+		{name: "approve", usage: "<ID>", desc: "允许执行等待审批的工具", run: decide(DecisionApprove)},
+		{name: "deny", usage: "<ID>", desc: "拒绝执行等待审批的工具", run: decide(DecisionDeny)},
+		{name: "always", usage: "<ID>", desc: "允许执行，并在当前会话中不再询问该工具", run: decide(DecisionAlways)},
+	}
+}
+
+// parseCommand 解析 "/name args"，去掉 Telegram 群聊中的 @botname 后缀
+func parseCommand(text string) (name, args string, ok bool) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "/") {
+		return "", "", false
+	}
+	head, args, _ := strings.Cut(text[1:], " ")
+	head, _, _ = strings.Cut(head, "@")
+	if head == "" {
+		return "", "", false
+	}
+	return strings.ToLower(head), strings.TrimSpace(args), true
+}
+
+// dispatchCommand 处理以 / 开头的消息
+//
+// 内置命令由网关处理，返回 true：只读命令在入队前直接回复，修改会话状态的命令
+// 排在会话队列中与 Agent 运行依次执行，队列已满时返回 ErrBusy。用户可调用技能的命令将消息正文
+// 替换为技能说明与参数后返回 false，按普通消息交给 Agent；
+// 未知命令原样交给 Agent。
+func (g *Gateway) dispatchCommand(msg *Message) (bool, error) {
+	name, args, ok := parseCommand(msg.Text)
+	if !ok {
+		return false, nil
+	}
+
+	for _, c := range builtinCommands() {
+		if c.name != name {
+			continue
+		}
+		log.Printf("[%s] %s 执行命令 /%s %s", msg.Channel, msg.UserID, name, args)
+		if c.admin && msg.sharedSession() && msg.Role != config.RoleAdmin {
+			go g.sendReply(*msg, fmt.Sprintf("这是多人共享的会话，只有管理员可以使用 /%s", name), nil)
+			return true, nil
+		}
+		if !c.serial {
+			go g.sendReply(*msg, c.run(g, *msg, args), nil)
+			return true, nil
+		}
+
+		if c.stop {
+			g.stopSession(msg.SessionKey())
+		}
+		run := c.run
+		cmd := *msg
+		cmd.command = func(g *Gateway, m Message) string { return run(g, m, args) }
+		g.dedup.handoff(cmd.claims...)
+		if _, err := g.sched.enqueue(cmd, OverloadReject); err != nil {
+			log.Printf("[%s] 队列已满，拒绝 %s 的命令 /%s", msg.Channel, msg.UserID, name)
+			go g.sendReply(*msg, g.busyMessage, nil)
+			return true, err
+		}
+		return true, nil
+	}
+
+	sk := g.agent.Skills().GetBySlashCommand("/" + name)
+	if sk == nil || !sk.CanUserInvoke() {
+		return false, nil
+	}
+	if !g.skillAllowed(msg.Role, sk.Name) {
+		go g.sendReply(*msg, fmt.Sprintf("你的角色（%s）无权使用技能 /%s", msg.Role, sk.Name), nil)
+		return true, nil
+	}
+
+	prompt, _ := g.agent.Skills().TryInvokeByCommand(g.ctx, "/"+name, args)
+	text := fmt.Sprintf("用户调用了技能 /%s，请按以下说明执行：\n\n%s", sk.Name, prompt)
+	if args != "" {
+		text += "\n\n参数: " + args
+	}
+	log.Printf("[%s] %s 调用技能 /%s %s", msg.Channel, msg.UserID, sk.Name, args)
+	msg.Text = text
+	return false, nil
+}
+
+// skillAllowed 角色是否可以使用技能
+func (g *Gateway) skillAllowed(role, name string) bool {
+	allow := g.access.runOptions(role).AllowSkill
+	return allow == nil || allow(name)
+}
+
+// toolAllowed 角色是否可以使用工具
+func (g *Gateway) toolAllowed(role, name string) bool {
+	allow := g.access.runOptions(role).AllowTool
+	return allow == nil || allow(name)
+}
+
+// userSkills 角色可以用命令调用的技能，按名称排序
+func (g *Gateway) userSkills(role string) []*skill.Skill {
+	var out []*skill.Skill
+	for _, s := range g.agent.Skills().GetUserInvokable() {
+		if g.skillAllowed(role, s.Name) {
+			out = append(out, s)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// cmdHelp /help
+func (g *Gateway) cmdHelp(msg Message, _ string) string {
+	var b strings.Builder
+	b.WriteString("**命令**\n")
+	for _, c := range builtinCommands() {
+		usage := ""
+		if c.usage != "" {
+			usage = " " + c.usage
+		}
+		fmt.Fprintf(&b, "/%s%s - %s\n", c.name, usage, c.desc)
+	}
+
+	if skills := g.userSkills(msg.Role); len(skills) > 0 {
+		b.WriteString("\n**技能**\n")
+		for _, s := range skills {
+			fmt.Fprintf(&b, "%s [参数] - %s\n", s.GetSlashCommand(), s.Description)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// cmdReset /reset
+func (g *Gateway) cmdReset(msg Message, _ string) string {
+	if sess := g.session.Get(msg.SessionKey()); sess != nil {
+		sess.Clear()
+	}
+	g.approvals.clearAlways(msg.SessionKey())
+	return "已清空对话历史，我们重新开始吧"
+}
+
+// cmdModel /model [名称]
+func (g *Gateway) cmdModel(msg Message, args string) string {
+	sess := g.session.GetOrCreate(msg.SessionKey())
+	def := g.router.profile(msg.Agent).model(g.agent.Model())
+
+	if args == "" {
+		if m := sess.Model(); m != "" {
+			return fmt.Sprintf("当前模型: %s（默认 %s）", m, def)
+		}
+		return "当前模型: " + def
+	}
+
+	if msg.Role != config.RoleAdmin {
+		return "只有管理员可以切换模型"
+	}
+	if args == "default" || args == def {
+		sess.SetModel("")
+		return "已恢复默认模型: " + def
+	}
+	sess.SetModel(args)
+	return "当前会话已切换到模型: " + args
+}
+
+// cmdSkills /skills
+func (g *Gateway) cmdSkills(msg Message, _ string) string {
+	skills := g.userSkills(msg.Role)
+	if len(skills) == 0 {
+		return "暂无可用技能"
+	}
+
+	var b strings.Builder
+	for _, s := range skills {
+		fmt.Fprintf(&b, "**%s** - %s\n", s.GetSlashCommand(), s.Description)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// cmdStop /stop
+func (g *Gateway) cmdStop(msg Message, _ string) string {
+	stopped, dropped := g.stopSession(msg.SessionKey())
+
+	switch {
+	case stopped && len(dropped) > 0:
+		return fmt.Sprintf("已停止当前请求，并取消 %d 条排队中的消息", len(dropped))
+	case stopped:
+		return "已停止当前请求"
+	case len(dropped) > 0:
+		return fmt.Sprintf("已取消 %d 条排队中的消息", len(dropped))
+	}
+	return "当前没有正在进行的请求"
+}
+
+// decide /approve、/deny、/always <ID>
+func decide(d Decision) func(*Gateway, Message, string) string {
+	return func(g *Gateway, msg Message, args string) string {
+		if args == "" {
+			return fmt.Sprintf("用法: /%s <审批 ID>", d)
+		}
+		if err := g.ResolveApproval(msg.Channel, msg.UserID, args, d); err != nil {
+			return err.Error()
+		}
+		switch d {
+		case DecisionDeny:
+			return "已拒绝"
+		case DecisionAlways:
+			return "已允许，本会话中不再询问该工具"
+		}
+		return "已允许"
+	}
+}
+
+// cmdWhoami /whoami
+func (g *Gateway) cmdWhoami(msg Message, _ string) string {
+	name := msg.UserName
+	if name == "" {
+		name = msg.UserID
+	}
+	text := fmt.Sprintf("用户: %s（%s）\n频道: %s\n会话: %s\n角色: %s",
+		name, msg.UserID, msg.Channel, msg.ChatID, msg.Role)
+	if members := g.identities.members(msg.Identity); len(members) > 0 {
+		text += "\n关联身份: " + strings.Join(members, ", ")
+	}
+	if p := g.router.profile(msg.Agent); p != nil {
+		text += "\nAgent: " + p.name
+		if p.cfg.Description != "" {
+			text += "（" + p.cfg.Description + "）"
+		}
+	}
+	return text
+}
+
+// cmdLink /link [关联码]
+//
+// 不带参数时生成关联码。关联码等同于身份凭证，只在私聊中发放，避免群成员抢先使用。
+func (g *Gateway) cmdLink(msg Message, args string) string {
+	if args == "" {
+		if msg.IsGroup {
+			return "请在私聊中发送 /link 获取关联码"
+		}
+		code := g.identities.newCode(msg.Channel, msg.UserID)
+		log.Printf("[%s] %s 生成身份关联码", msg.Channel, msg.UserID)
+		return fmt.Sprintf("关联码: %s\n请在 %s 内用另一个频道的账号私聊发送 /link %s。"+
+			"关联后两个账号共享私聊对话和额度，请不要把关联码发给他人",
+			code, formatWait(linkCodeTTL), code)
+	}
+
+	id, err := g.identities.redeem(args, msg.Channel, msg.UserID)
+	if err != nil {
+		return err.Error()
+	}
+	members := g.identities.members(id)
+	log.Printf("[%s] %s 关联身份到 %s: %s", msg.Channel, msg.UserID, id, strings.Join(members, ", "))
+	return "关联成功，已关联的身份: " + strings.Join(members, ", ")
+}
+
+// cmdUnlink /unlink
+func (g *Gateway) cmdUnlink(msg Message, _ string) string {
+	if !g.identities.unlink(msg.Channel, msg.UserID) {
+		return "当前身份没有关联其他频道"
+	}
+	log.Printf("[%s] %s 解除身份关联", msg.Channel, msg.UserID)
+	return "已解除关联，当前频道的对话和额度不再与其他频道共享"
+}
+
+// cmdRemind /remind <时间> <内容>
+//
+// 时间为 30m、15:04、2006-01-02 15:04 等一次性时间，或带引号的 cron 表达式、@daily 等预定义表达式。
+func (g *Gateway) cmdRemind(msg Message, args string) string {
+	if !g.toolAllowed(msg.Role, ScheduleTool) {
+		return fmt.Sprintf("你的角色（%s）无权创建定时任务", msg.Role)
+	}
+	at, cronExpr, prompt, ok := splitRemind(args)
+	if !ok {
+		return "用法: /remind <时间> <内容>\n时间可以是 30m、2h、1d、15:04、2006-01-02 15:04，" +
+			"或带引号的 cron 表达式，如 /remind \"0 9 * * 1-5\" 汇总昨天的告警"
+	}
+	j, err := g.createJob(msg, prompt, at, cronExpr)
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("已创建定时任务 %s（%s），下次执行: %s。用 /cancel %s 取消",
+		j.ID, j.describe(), j.Next.In(g.jobs.loc).Format(jobTimeLayout), j.ID)
+}
+
+// splitRemind 拆分 /remind 的参数为时间与内容
+func splitRemind(args string) (at, cronExpr, prompt string, ok bool) {
+	args = strings.TrimSpace(args)
+	switch {
+	case strings.HasPrefix(args, "\""):
+		expr, rest, found := strings.Cut(args[1:], "\"")
+		if !found {
+			return "", "", "", false
+		}
+		cronExpr, prompt = expr, rest
+	case strings.HasPrefix(args, "@"):
+		cronExpr, prompt, _ = strings.Cut(args, " ")
+	default:
+		at, prompt, _ = strings.Cut(args, " ")
+		// "2006-01-02 15:04" 由两部分组成
+		if date, rest, found := strings.Cut(strings.TrimSpace(prompt), " "); found && len(at) == len("2006-01-02") && strings.Count(at, "-") == 2 {
+			at, prompt = at+" "+date, rest
+		}
+	}
+	prompt = strings.TrimSpace(prompt)
+	return at, cronExpr, prompt, prompt != ""
+}
+
+// cmdJobs /jobs
+func (g *Gateway) cmdJobs(msg Message, _ string) string {
+	return g.listJobs(msg)
+}
+
+// cmdCancel /cancel <ID>
+func (g *Gateway) cmdCancel(msg Message, args string) string {
+	if args == "" {
+		return "用法: /cancel <任务 ID>，用 /jobs 查看任务"
+	}
+	if err := g.cancelJob(msg, args); err != nil {
+		return err.Error()
+	}
+	return "已取消定时任务 " + args
+}
+
+// trackRun 记录会话正在进行的运行，供 /stop 取消
+func (g *Gateway) trackRun(key string, cancel context.CancelFunc) {
+	g.runMu.Lock()
+	defer g.runMu.Unlock()
+	g.runs[key] = cancel
+}
+
+// untrackRun 运行结束后移除记录
+func (g *Gateway) untrackRun(key string) {
+	g.runMu.Lock()
+	defer g.runMu.Unlock()
+	delete(g.runs, key)
+}
+
+// stopSession 取消会话排队中的消息和正在进行的运行，返回是否有运行被取消和被取消的消息
+func (g *Gateway) stopSession(key string) (bool, []Message) {
+	dropped := g.sched.dropSession(key)
+	for _, d := range dropped {
+		log.Printf("[%s] 取消 %s 的排队消息 %s", d.Channel, d.UserID, d.ID)
+	}
+	return g.cancelRun(key), dropped
+}
+
+// cancelRun 取消会话正在进行的运行，没有运行时返回 false
+func (g *Gateway) cancelRun(key string) bool {
+	g.runMu.Lock()
+	defer g.runMu.Unlock()
+
+	cancel, ok := g.runs[key]
+	if ok {
+		cancel()
+		delete(g.runs, key)
+	}
+	return ok
+}
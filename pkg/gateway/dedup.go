@@ -0,0 +1,297 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+)
+
+const (
+	// DefaultDedupTTL 已处理消息 ID 的保留时长，应大于平台重投递的时间窗口
+	DefaultDedupTTL = 24 * time.Hour
+	// dedupFile 数据目录下的去重记录文件
+	dedupFile = "dedup.jsonl"
+	// dedupPruneInterval 清理过期记录的间隔
+	dedupPruneInterval = time.Minute
+	// dedupCompactMin 记录文件至少积累这么多行才考虑压缩
+	dedupCompactMin = 1000
+)
+
+// dedupEntry 记录文件中的一行
+type dedupEntry struct {
+	Key     string `json:"key"`
+	Expires int64  `json:"expires"` // Unix 秒
+}
+
+// dedup 按频道、会话和消息 ID 去重，保证同一条入站消息只处理一次
+//
+// 收到消息时先在内存中占用消息 ID，挡住并发到达的重复投递；消息处理完成
+// （Agent 运行结束、执行了命令或按策略拒绝）后才追加写入数据目录下的 JSONL 文件，
+// 重启后重新加载，平台重投递的更新和超时重试的 webhook 因此不会再次触发 Agent 和工具。
+// 进入队列的消息在处理完成前只在内存中占用，进程崩溃时尚未处理的消息不会被记为已处理，
+// 重启后平台重投递时重新处理。因繁忙、限流或关闭被拒绝以及被过载策略丢弃的消息释放占用，
+// 平台重投递时正常处理。
+type dedup struct {
+	// 配置，需在 Start 之前设置
+	enabled bool
+	ttl     time.Duration
+
+	mu        sync.Mutex
+	seen      map[string]time.Time // 键 → 过期时间
+	pending   map[string]bool      // 已占用但尚未写入记录文件的键，值为 true 表示已进入队列
+	file      *os.File
+	path      string
+	lines     int // 文件中的记录行数，含已过期的
+	lastPrune time.Time
+}
+
+// newDedup 创建仅在内存中去重的实例
+func newDedup() *dedup {
+	return &dedup{
+		enabled: true,
+		ttl:     DefaultDedupTTL,
+		seen:    make(map[string]time.Time),
+		pending: make(map[string]bool),
+	}
+}
+
+// configure 应用去重配置，并从数据目录加载已处理的消息
+//
+// 记录文件无法打开时退回到仅在内存中去重。
+func (d *dedup) configure(cfg config.DedupConfig, dataDir string) {
+	d.enabled = !cfg.Disabled
+	if cfg.TTL > 0 {
+		d.ttl = cfg.TTL
+	}
+	if !d.enabled || dataDir == "" {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.path = filepath.Join(dataDir, dedupFile)
+	if err := d.loadLocked(); err != nil {
+		log.Printf("加载消息去重记录失败: %v", err)
+	}
+	if err := d.compactLocked(); err != nil {
+		log.Printf("打开消息去重记录失败，仅在内存中去重: %v", err)
+	}
+}
+
+// loadLocked 读取记录文件中未过期的条目
+func (d *dedup) loadLocked() error {
+	f, err := os.Open(d.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	now := time.Now()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e dedupEntry
+		// 进程崩溃时最后一行可能不完整，跳过即可
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		if exp := time.Unix(e.Expires, 0); exp.After(now) {
+			d.seen[e.Key] = exp
+		}
+	}
+	if len(d.seen) > 0 {
+		log.Printf("已加载 %d 条消息去重记录", len(d.seen))
+	}
+	return scanner.Err()
+}
+
+// compactLocked 只保留未过期的记录重写文件，并以追加模式重新打开
+func (d *dedup) compactLocked() error {
+	if err := os.MkdirAll(filepath.Dir(d.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := d.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for key, exp := range d.seen {
+		if _, ok := d.pending[key]; !ok {
+			enc.Encode(dedupEntry{Key: key, Expires: exp.Unix()})
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, d.path); err != nil {
+		return err
+	}
+
+	if d.file != nil {
+		d.file.Close()
+	}
+	d.file, err = os.OpenFile(d.path, os.O_APPEND|os.O_WRONLY, 0644)
+	d.lines = len(d.seen) - len(d.pending)
+	return err
+}
+
+// dedupKey 消息的去重键
+//
+// Telegram、Slack 的消息 ID 只在会话内唯一；同一条消息的每次编辑各处理一次。
+// Telegram 的编辑时间只精确到秒，编辑以时间加内容摘要区分，
+// 同一秒内的多次编辑不会被当作重投递丢弃。
+func dedupKey(msg Message) string {
+	key := turnKey(msg.Channel, msg.ChatID, msg.ID)
+	if msg.Edited {
+		h := fnv.New64a()
+		h.Write([]byte(editText(msg)))
+		key += ":" + strconv.FormatInt(msg.Timestamp.UnixNano(), 10) + ":" + strconv.FormatUint(h.Sum64(), 16)
+	}
+	return key
+}
+
+// duplicate 判断消息是否已处理或正在处理，首次出现时在内存中占用并返回 false
+//
+// 占用的消息需随后调用 commit 或 release。
+func (d *dedup) duplicate(msg Message) bool {
+	if !d.enabled || msg.ID == "" {
+		return false
+	}
+	key := dedupKey(msg)
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.pruneLocked(now)
+
+	if exp, ok := d.seen[key]; ok && exp.After(now) {
+		return true
+	}
+	d.seen[key] = now.Add(d.ttl)
+	d.pending[key] = false
+	return false
+}
+
+// commit 消息已处理完成且没有进入队列，将占用写入记录文件，重启后仍然有效
+func (d *dedup) commit(msg Message) {
+	if !d.enabled || msg.ID == "" {
+		return
+	}
+	key := dedupKey(msg)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if queued, ok := d.pending[key]; ok && !queued {
+		d.writeLocked(key)
+	}
+}
+
+// handoff 占用的消息即将进入队列，由 finish 在处理完成后写入记录文件；需在入队之前调用
+func (d *dedup) handoff(keys ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, key := range keys {
+		if _, ok := d.pending[key]; ok {
+			d.pending[key] = true
+		}
+	}
+}
+
+// finish 队列中的消息已处理完成，将占用写入记录文件
+func (d *dedup) finish(keys ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, key := range keys {
+		if _, ok := d.pending[key]; ok {
+			d.writeLocked(key)
+		}
+	}
+}
+
+// writeLocked 将占用的键写入记录文件，调用方需持有锁
+func (d *dedup) writeLocked(key string) {
+	delete(d.pending, key)
+	exp, ok := d.seen[key]
+	if !ok || d.file == nil {
+		return
+	}
+	line, _ := json.Marshal(dedupEntry{Key: key, Expires: exp.Unix()})
+	if _, err := d.file.Write(append(line, '\n')); err != nil {
+		log.Printf("写入消息去重记录失败: %v", err)
+	}
+	d.lines++
+}
+
+// release 消息未被接受，释放占用，重投递时重新处理
+func (d *dedup) release(msg Message) {
+	if !d.enabled || msg.ID == "" {
+		return
+	}
+	d.releaseKeys(dedupKey(msg))
+}
+
+// releaseKeys 释放尚未写入记录文件的占用
+func (d *dedup) releaseKeys(keys ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, key := range keys {
+		if _, ok := d.pending[key]; ok {
+			delete(d.pending, key)
+			delete(d.seen, key)
+		}
+	}
+}
+
+// pruneLocked 定期清理过期记录，文件中过期行过多时压缩
+func (d *dedup) pruneLocked(now time.Time) {
+	if now.Sub(d.lastPrune) < dedupPruneInterval {
+		return
+	}
+	d.lastPrune = now
+
+	for key, exp := range d.seen {
+		if !exp.After(now) {
+			delete(d.seen, key)
+			delete(d.pending, key)
+		}
+	}
+	if d.file != nil && d.lines > dedupCompactMin && d.lines > 2*len(d.seen) {
+		if err := d.compactLocked(); err != nil {
+			log.Printf("压缩消息去重记录失败: %v", err)
+		}
+	}
+}
+
+// close 关闭记录文件
+func (d *dedup) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.file != nil {
+		d.file.Close()
+		d.file = nil
+	}
+}
@@ -0,0 +1,116 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+)
+
+func TestDedup(t *testing.T) {
+	msg := Message{ID: "42", Channel: "telegram", ChatID: "c1"}
+	edit := func(sec int64, text string) Message {
+		m := msg
+		m.Edited = true
+		m.Timestamp = time.Unix(sec, 0)
+		m.Text = text
+		return m
+	}
+
+	tests := []struct {
+		name  string
+		steps func(d *dedup) bool // 返回最后一次 duplicate 的结果
+		want  bool
+	}{
+		{"首次出现", func(d *dedup) bool { return d.duplicate(msg) }, false},
+		{"处理中的重复投递", func(d *dedup) bool { d.duplicate(msg); return d.duplicate(msg) }, true},
+		{"已接受后重复", func(d *dedup) bool { d.duplicate(msg); d.commit(msg); return d.duplicate(msg) }, true},
+		{"被拒绝后重投递", func(d *dedup) bool { d.duplicate(msg); d.release(msg); return d.duplicate(msg) }, false},
+		{"已接受的消息不能被释放", func(d *dedup) bool { d.duplicate(msg); d.commit(msg); d.release(msg); return d.duplicate(msg) }, true},
+		{"排队中的重复投递", func(d *dedup) bool {
+			d.duplicate(msg)
+			d.handoff(dedupKey(msg))
+			d.commit(msg)
+			return d.duplicate(msg)
+		}, true},
+		{"排队后被丢弃", func(d *dedup) bool {
+			d.duplicate(msg)
+			d.handoff(dedupKey(msg))
+			d.releaseKeys(dedupKey(msg))
+			return d.duplicate(msg)
+		}, false},
+		{"其他会话的相同 ID", func(d *dedup) bool {
+			d.duplicate(msg)
+			other := msg
+			other.ChatID = "c2"
+			return d.duplicate(other)
+		}, false},
+		{"同一条消息的不同编辑", func(d *dedup) bool { d.duplicate(edit(1, "a")); return d.duplicate(edit(2, "b")) }, false},
+		{"同一秒内的两次编辑", func(d *dedup) bool { d.duplicate(edit(1, "a")); return d.duplicate(edit(1, "b")) }, false},
+		{"编辑的重复投递", func(d *dedup) bool { d.duplicate(edit(1, "a")); return d.duplicate(edit(1, "a")) }, true},
+		{"没有 ID 的消息不去重", func(d *dedup) bool { d.duplicate(Message{}); return d.duplicate(Message{}) }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.steps(newDedup()); got != tt.want {
+				t.Errorf("duplicate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDedupTTL(t *testing.T) {
+	d := newDedup()
+	d.ttl = 20 * time.Millisecond
+	msg := Message{ID: "1", Channel: "slack", ChatID: "C1"}
+	d.duplicate(msg)
+	d.commit(msg)
+	if !d.duplicate(msg) {
+		t.Fatal("保留期内应视为重复")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if d.duplicate(msg) {
+		t.Fatal("过期后应重新处理")
+	}
+}
+
+func TestDedupPersistence(t *testing.T) {
+	dir := t.TempDir()
+	accepted := Message{ID: "1", Channel: "telegram", ChatID: "c1"}
+	rejected := Message{ID: "2", Channel: "telegram", ChatID: "c1"}
+	pending := Message{ID: "3", Channel: "telegram", ChatID: "c1"}
+	queued := Message{ID: "4", Channel: "telegram", ChatID: "c1"}
+	finished := Message{ID: "5", Channel: "telegram", ChatID: "c1"}
+
+	d := newDedup()
+	d.configure(config.DedupConfig{}, dir)
+	for _, m := range []Message{accepted, rejected, pending, queued, finished} {
+		d.duplicate(m)
+	}
+	d.commit(accepted)
+	d.release(rejected)
+	d.handoff(dedupKey(queued), dedupKey(finished))
+	d.commit(queued)
+	d.finish(dedupKey(finished))
+	d.close()
+
+	// 重启后只有已接受和已处理完成的消息仍被视为重复，排队中未处理的消息可以重投递
+	d = newDedup()
+	d.configure(config.DedupConfig{}, dir)
+	defer d.close()
+	tests := []struct {
+		msg  Message
+		want bool
+	}{
+		{accepted, true},
+		{rejected, false},
+		{pending, false},
+		{queued, false},
+		{finished, true},
+	}
+	for _, tt := range tests {
+		if got := d.duplicate(tt.msg); got != tt.want {
+			t.Errorf("重启后 duplicate(%s) = %v, want %v", tt.msg.ID, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package gateway
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// turnKey 入站消息在会话历史中的轮次 ID，平台消息 ID 只在会话内唯一
+func turnKey(channel, chatID, id string) string {
+	return channel + ":" + chatID + ":" + id
+}
+
+// handleEdit 处理被编辑的消息
+//
+// 仍在排队的消息直接替换内容；已处理的消息替换会话历史中对应的用户消息。
+// 开启 rerun 且被编辑的是会话的最后一轮时，丢弃原回复并重新运行，
+// 支持 ReplyEditor 的频道会原地修改之前的回复。
+func (g *Gateway) handleEdit(msg Message, allowed bool) error {
+	if !allowed || msg.ID == "" {
+		return nil
+	}
+	// 群聊中同时设置会话归属
+	triggered := !msg.IsGroup || g.admitGroup(&msg, false)
+	if g.sched.editQueued(msg) {
+		log.Printf("[%s] 消息 %s 在排队中被编辑，已替换内容", msg.Channel, msg.ID)
+		return nil
+	}
+
+	turn := turnKey(msg.Channel, msg.ChatID, msg.ID)
+	sess := g.session.FindTurn(turn)
+	if sess == nil {
+		return nil
+	}
+	_, last := sess.EditTurn(turn, g.speakerText(msg, quoted(msg, editText(msg))))
+	log.Printf("[%s] %s 编辑了消息 %s: %s", msg.Channel, msg.UserID, msg.ID, msg.Text)
+
+	// 命令不重新运行；群聊中编辑后仍需满足触发条件
+	if !g.edits.rerun || !last || !triggered || g.draining.Load() || strings.HasPrefix(msg.Text, "/") {
+		return nil
+	}
+
+	if err := g.limiter.allow(msg.Channel, msg.ChatID, rateUser(msg.Channel, msg.UserID, msg.Identity)); err != nil {
+		log.Printf("[%s] %s 触发 %s 级限流，不重新运行编辑的消息 %s", msg.Channel, msg.UserID, err.Scope, msg.ID)
+		return err
+	}
+
+	msg.Agent, msg.Text = g.router.route(msg)
+	g.dedup.handoff(msg.claims...)
+	if _, err := g.sched.enqueue(msg, OverloadReject); err != nil {
+		log.Printf("[%s] 队列已满，不重新运行编辑的消息 %s", msg.Channel, msg.ID)
+		return err
+	}
+	return nil
+}
+
+// editText 编辑后写入历史的文本，附件只记录文件名
+func editText(msg Message) string {
+	text := msg.Text
+	for _, att := range msg.Attachments {
+		text += fmt.Sprintf("\n[附件: %s]", att.FileName)
+	}
+	return strings.TrimSpace(text)
+}
+
+// HandleDelete 处理平台上被删除的消息
+//
+// 仍在排队的消息不再处理；已处理的消息从会话历史中删除整轮（用户消息及其回复）。
+// 正在运行的消息不受影响，其结果仍会写入历史。
+func (g *Gateway) HandleDelete(channel, chatID, messageID string) {
+	if messageID == "" {
+		return
+	}
+	if g.sched.dropMessage(channel, chatID, messageID) {
+		log.Printf("[%s] 消息 %s 在排队中被删除，已取消", channel, messageID)
+		return
+	}
+
+	turn := turnKey(channel, chatID, messageID)
+	if sess := g.session.FindTurn(turn); sess != nil {
+		n := sess.RemoveTurn(turn)
+		log.Printf("[%s] 消息 %s 被删除，已从会话历史中移除 %d 条消息", channel, messageID, n)
+	}
+}
@@ -2,12 +2,16 @@ package gateway
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"log"
 	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/0xagentlabs/mini-agent-gateway/pkg/agent"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
 	"github.com/0xagentlabs/mini-agent-gateway/pkg/session"
 )
 
@@ -15,17 +19,151 @@ import (
 type Message struct {
 	ID        string
 	UserID    string
+	UserName  string // 发言人显示名称（可选），群聊中标注到历史
 	ChatID    string
-	Text      string
-	Channel   string // telegram / discord / slack
+	GuildID   string // 上层空间 ID：Discord guild / Slack team（可选）
+	ThreadID  string // 线程 ID，如 Slack thread_ts、Discord 子区 ID（可选），回复发在线程内
+	Text      string // 正文；附件消息为说明文字（caption）
+	Channel   string // 来源频道适配器名称：telegram / discord / slack
 	Timestamp time.Time
+
+	Attachments []Attachment // 图片、文件、语音等附件（可选）
+
+	// ReplyToID 用户回复（引用）的消息 ID，ReplyToUser、ReplyToText 为该消息的发言人与正文，
+	// 由适配器设置（可选）；正文会随本条消息一起交给 Agent
+	ReplyToID   string
+	ReplyToUser string
+	ReplyToText string
+
+	// CoalescedIDs 过载合并策略下并入本条的较早消息 ID
+	CoalescedIDs []string
+
+	// IsGroup 来自多人会话（群组、服务器频道），由适配器设置
+	IsGroup bool
+	// Mentioned 群聊中机器人被 @ 或用户回复了机器人的消息，由适配器设置
+	Mentioned bool
+	// Edited 用户编辑了已发送的消息 ID，Text 与 Attachments 为编辑后的内容，
+	// Timestamp 为编辑时间，由适配器设置
+	Edited bool
+	// SharedContext 群聊成员共享会话，由网关按群聊策略设置
+	SharedContext bool
+	// ThreadInChat 线程内的消息并入群聊会话而不是独立会话，由网关按群聊策略设置
+	ThreadInChat bool
+
+	// Role 发送者的角色，由网关按访问控制设置
+	Role string
+	// Agent 处理该消息的 Agent 配置名，由网关按路由规则设置，空表示默认 Agent
+	Agent string
+	// Identity 跨频道关联后的内部用户 ID，由网关设置，未关联时为空
+	Identity string
+	// ClientChat ChatID 是客户端自选的会话 ID（HTTP、WebSocket），UserID 为鉴权得到的调用方，
+	// 由适配器设置；会话按调用方和 ChatID 隔离，同一 API Key 可以维护多个会话
+	ClientChat bool
+
+	// command 排在会话队列中执行的内置命令，设置时不运行 Agent
+	command func(g *Gateway, msg Message) string
+	// task 由 Execute 排队的运行，设置时不读写会话历史
+	task *task
+	// job 触发本次运行的定时任务 ID，普通消息为空
+	job string
+	// notice 由 Notify 发起，与定时任务一样没有对应的入站消息
+	notice bool
+	// claims 消息（含被合并的消息）占用的去重键，进入队列后在处理完成时写入去重记录
+	claims []string
 }
 
+// SessionKey 会话键
+//
+// 线程内的消息默认共享一个会话；群聊按策略全群共享或按成员隔离；私聊按频道和用户隔离，
+// 不同频道的相同用户 ID 互不可见；关联了身份的用户在各频道的私聊共享一个会话。
+// HTTP、WebSocket 按调用方和客户端自选的会话 ID 隔离，其他 API Key 无法通过相同的会话 ID 读取。
+func (m Message) SessionKey() string {
+	switch {
+	case m.ThreadID != "" && !m.ThreadInChat:
+		return m.Channel + ":" + m.ChatID + ":" + m.ThreadID
+	case m.IsGroup && m.SharedContext:
+		return m.Channel + ":" + m.ChatID
+	case m.IsGroup:
+		return m.Channel + ":" + m.ChatID + ":" + m.UserID
+	case m.ClientChat:
+		return m.Channel + ":" + m.UserID + ":" + m.ChatID
+	case m.Identity != "":
+		return m.Identity
+	}
+	return m.Channel + ":" + m.UserID
+}
+
+// inbound 是否对应频道上真实的入站消息；定时任务和通知的 ID 由网关生成，
+// 回复不能引用它们
+func (m Message) inbound() bool {
+	return m.job == "" && !m.notice
+}
+
+// sharedSession 会话是否由多人共享（共享上下文的群聊、独立会话的线程）
+func (m Message) sharedSession() bool {
+	return m.IsGroup && (m.SharedContext || (m.ThreadID != "" && !m.ThreadInChat))
+}
+
+// shutdownGrace 截止时间到达并取消运行后，等待其结束的最长时间
+const shutdownGrace = 5 * time.Second
+
+// ErrShuttingDown 网关正在关闭，不再接收新消息
+var ErrShuttingDown = errors.New("网关正在关闭")
+
 // Gateway 是核心消息路由
 type Gateway struct {
 	agent   *agent.Agent
 	session *session.Manager
-	msgChan chan Message
+	sched   *scheduler
+	workers int
+
+	// ctx 所有 Agent 运行的根上下文，关闭超时后取消
+	ctx      context.Context
+	cancel   context.CancelFunc
+	draining atomic.Bool
+
+	// 过载策略：默认值与按频道覆盖
+	overload        string
+	channelOverload map[string]string
+	busyMessage     string
+
+	// 各频道的群聊策略
+	groups map[string]config.GroupConfig
+
+	// 用户、会话、频道和全局限流
+	limiter *rateLimiter
+
+	// 访问控制与角色
+	access *accessControl
+
+	// 高风险工具审批
+	approvals *approvals
+
+	// 入站消息去重
+	dedup *dedup
+
+	// Agent 配置与路由规则
+	router *router
+
+	// 跨频道身份关联
+	identities *identities
+
+	// 消息编辑的处理方式
+	edits struct{ rerun bool }
+
+	// 定时任务
+	jobs *jobs
+
+	// 各会话正在进行的运行，供 /stop 取消
+	runMu sync.Mutex
+	runs  map[string]context.CancelFunc
+
+	mu       sync.RWMutex
+	channels map[string]Channel
+
+	wg       sync.WaitGroup
+	stopCh   chan struct{}
+	stopOnce sync.Once
 }
 
 // New 创建网关实例
@@ -35,36 +173,428 @@ func New() *Gateway {
 		log.Fatal("请设置 OPENAI_API_KEY 环境变量")
 	}
 
-	return &Gateway{
+	g := &Gateway{
 		agent:   agent.New(openaiKey),
 		session: session.NewManager(),
-		msgChan: make(chan Message, 100),
+		workers: DefaultWorkers,
+
+		overload:        OverloadReject,
+		channelOverload: make(map[string]string),
+		busyMessage:     "当前消息较多，请稍后再试",
+		groups:          make(map[string]config.GroupConfig),
+		limiter:         newRateLimiter(),
+		access:          newAccessControl(),
+		runs:            make(map[string]context.CancelFunc),
+		approvals:       newApprovals(),
+		dedup:           newDedup(),
+		router:          newRouter(),
+		identities:      newIdentities(),
+		jobs:            newJobs(),
+
+		channels: make(map[string]Channel),
+		stopCh:   make(chan struct{}),
+	}
+	g.ctx, g.cancel = context.WithCancel(context.Background())
+	g.sched = newScheduler(g.processMessage)
+	return g
+}
+
+// Configure 应用网关与频道的队列配置，需在 Start 之前调用
+func (g *Gateway) Configure(cfg *config.Config) {
+	gc := cfg.Gateway
+	if gc.Workers > 0 {
+		g.workers = gc.Workers
+	}
+	if gc.QueueSize != 0 {
+		g.sched.queueSize = max(gc.QueueSize, 0)
+	}
+	if gc.ConversationQueueSize != 0 {
+		g.sched.convQueueSize = max(gc.ConversationQueueSize, 0)
+	}
+	if gc.Overload != "" {
+		g.overload = gc.Overload
+	}
+	if gc.BusyMessage != "" {
+		g.busyMessage = gc.BusyMessage
+	}
+
+	for _, ch := range cfg.Channels {
+		if ch.QueueSize > 0 {
+			g.sched.channelQueueSize[ch.Name] = ch.QueueSize
+		}
+		if ch.Overload != "" {
+			g.channelOverload[ch.Name] = ch.Overload
+		}
+		g.groups[ch.Name] = ch.Group
+	}
+	g.limiter.configure(cfg)
+	g.access.configure(cfg)
+	g.approvals.configure(gc.Approval)
+	g.dedup.configure(gc.Dedup, gc.DataDir)
+	g.router.configure(cfg, g.agent.Client())
+	g.identities.configure(gc.DataDir)
+	g.edits.rerun = gc.Edits.Rerun
+	g.jobs.configure(cfg)
+}
+
+// Agent 返回网关使用的 Agent
+func (g *Gateway) Agent() *agent.Agent {
+	return g.agent
+}
+
+// Sessions 返回会话管理器
+func (g *Gateway) Sessions() *session.Manager {
+	return g.session
+}
+
+// SessionOf 返回消息所属的会话，已关联身份的用户返回跨频道共享的会话；不存在时返回 nil
+func (g *Gateway) SessionOf(msg Message) *session.Session {
+	msg.Identity = g.identities.resolve(msg.Channel, msg.UserID)
+	return g.session.Get(msg.SessionKey())
+}
+
+// HandleMessage 接收来自各频道的消息，不会阻塞调用方
+//
+// 同一频道、会话中已处理过的消息 ID（在去重保留期内，跨重启）直接忽略并返回 nil；
+// 因繁忙、限流或关闭被拒绝、被过载策略丢弃的消息不计为已处理，平台重投递时重新处理；
+// 进入队列的消息在处理完成后才记为已处理，崩溃前尚未处理的消息在重启后可以重投递。
+//
+// 队列达到上限时按过载策略处理：reject 向用户回复繁忙提示并返回 ErrBusy，
+// drop_oldest 丢弃同一范围内最早的待处理消息，coalesce 将同一用户连续的
+// 待处理消息合并为一轮（无法合并时按 reject 处理）。
+//
+// 入队前先按访问控制检查用户与会话，无权访问时回复拒绝提示并返回 ErrForbidden，
+// 不消耗任何限流额度；再按限流配置检查用户、会话、频道和全局额度，超限时返回
+// *RateLimitError。两种情况下消息都不会进入队列，也不会调用 Agent。
+func (g *Gateway) HandleMessage(msg Message) error {
+	// 平台重投递或重试的消息直接忽略，不回复也不计入限流
+	if g.dedup.duplicate(msg) {
+		log.Printf("[%s] 忽略重复消息 %s", msg.Channel, msg.ID)
+		return nil
+	}
+	if msg.ID != "" {
+		msg.claims = []string{dedupKey(msg)}
+	}
+
+	err := g.handleMessage(msg)
+	var limited *RateLimitError
+	if errors.Is(err, ErrBusy) || errors.Is(err, ErrShuttingDown) || errors.As(err, &limited) {
+		g.dedup.release(msg)
+	} else {
+		g.dedup.commit(msg)
+	}
+	return err
+}
+
+// handleMessage 授权、限流并将消息加入队列
+func (g *Gateway) handleMessage(msg Message) error {
+	msg.Identity = g.identities.resolve(msg.Channel, msg.UserID)
+	role, allowed := g.access.authorize(msg.Channel, msg.ChatID, msg.UserID)
+	msg.Role = role
+
+	if msg.Edited {
+		return g.handleEdit(msg, allowed)
+	}
+
+	// 群聊中未触发回复的消息不进入队列，无权访问的消息也不被动记录
+	if msg.IsGroup && !g.admitGroup(&msg, allowed) {
+		return nil
+	}
+
+	// 无权访问的消息不消耗会话、频道和全局的共享额度，否则一个外部用户就能让
+	// 整个频道被限流；拒绝提示按用户限频，避免被拒绝的用户刷屏
+	user := rateUser(msg.Channel, msg.UserID, msg.Identity)
+	if !allowed {
+		log.Printf("[%s] %s 无权访问，拒绝消息 %s", msg.Channel, msg.UserID, msg.ID)
+		if g.limiter.notify("denied:"+user, deniedReplyInterval) {
+			go g.sendReply(msg, g.access.deniedMessage(msg.Channel), nil)
+		}
+		return ErrForbidden
+	}
+
+	if g.draining.Load() {
+		log.Printf("[%s] 网关正在关闭，拒绝 %s 的消息 %s", msg.Channel, msg.UserID, msg.ID)
+		go g.sendReply(msg, "服务正在重启，请稍后再试", nil)
+		return ErrShuttingDown
+	}
+
+	if err := g.limiter.allow(msg.Channel, msg.ChatID, user); err != nil {
+		log.Printf("[%s] %s 触发 %s 级限流，拒绝消息 %s", msg.Channel, msg.UserID, err.Scope, msg.ID)
+		if g.limiter.notify(user, err.RetryAfter) {
+			go g.sendReply(msg, g.limiter.replyText(msg.Channel, err.RetryAfter), nil)
+		}
+		return err
+	}
+
+	// 按路由规则选择 Agent 配置，前缀路由去掉消息中的前缀
+	msg.Agent, msg.Text = g.router.route(msg)
+
+	// 内置命令直接回复，技能命令展开为技能说明后按普通消息处理
+	if handled, err := g.dispatchCommand(&msg); handled {
+		return err
+	}
+
+	policy := g.overload
+	if p, ok := g.channelOverload[msg.Channel]; ok {
+		policy = p
+	}
+
+	g.dedup.handoff(msg.claims...)
+	dropped, err := g.sched.enqueue(msg, policy)
+	g.drop(dropped)
+	if err != nil {
+		log.Printf("[%s] 队列已满，拒绝 %s 的消息 %s", msg.Channel, msg.UserID, msg.ID)
+		go g.sendReply(msg, g.busyMessage, nil)
+		return err
 	}
+	return nil
 }
 
-// HandleMessage 接收来自各频道的消息
-func (g *Gateway) HandleMessage(msg Message) {
-	g.msgChan <- msg
+// task 由不经过会话历史的频道排队执行的运行
+type task struct {
+	ctx  context.Context
+	run  func(ctx context.Context)
+	done chan error // 执行完成时收到 nil，被过载策略丢弃时收到 ErrBusy
 }
 
-// Start 开始处理消息循环
+// Execute 为自带对话历史、不读写会话的频道（如 OpenAI 兼容接口）排队执行 run，阻塞到运行结束
+//
+// run 与普通消息一样受工作协程数、队列上限和关闭流程约束：网关关闭中返回 ErrShuttingDown，
+// 队列已满或排队时被丢弃返回 ErrBusy，此时 run 不会执行，也不会回复繁忙提示。
+// 传给 run 的 ctx 派生自网关的根上下文，ctx 取消或关闭超时时随之取消。
+// msg 只用于排队，会话键相同的运行按顺序执行。
+func (g *Gateway) Execute(ctx context.Context, msg Message, run func(ctx context.Context)) error {
+	if g.draining.Load() {
+		return ErrShuttingDown
+	}
+
+	msg.task = &task{ctx: ctx, run: run, done: make(chan error, 1)}
+	policy := g.overload
+	if p, ok := g.channelOverload[msg.Channel]; ok {
+		policy = p
+	}
+	dropped, err := g.sched.enqueue(msg, policy)
+	g.drop(dropped)
+	if err != nil {
+		log.Printf("[%s] 队列已满，拒绝 %s 的请求 %s", msg.Channel, msg.UserID, msg.ID)
+		return err
+	}
+	return <-msg.task.done
+}
+
+// drop 处理因 drop_oldest 被丢弃的消息：与拒绝时一样告知发送方，Execute 的等待方收到 ErrBusy
+func (g *Gateway) drop(dropped []Message) {
+	for _, d := range dropped {
+		log.Printf("[%s] 队列已满，丢弃 %s 的消息 %s", d.Channel, d.UserID, d.ID)
+		g.dedup.releaseKeys(d.claims...)
+		if d.task != nil {
+			d.task.done <- ErrBusy
+			continue
+		}
+		if ch, ok := g.Channel(d.Channel); ok {
+			if dr, ok := ch.(DropReporter); ok {
+				if err := dr.ReportDropped(d, g.busyMessage); err != nil {
+					log.Printf("[%s] 通知消息 %s 被丢弃失败: %v", d.Channel, d.ID, err)
+				}
+				continue
+			}
+		}
+		go g.sendReply(d, g.busyMessage, nil)
+	}
+}
+
+// runTask 执行排队的运行，ctx 同时受调用方和网关根上下文约束
+func (g *Gateway) runTask(t *task) {
+	ctx, cancel := context.WithCancel(g.ctx)
+	defer cancel()
+	stop := context.AfterFunc(t.ctx, cancel)
+	defer stop()
+
+	t.run(ctx)
+	t.done <- nil
+}
+
+// CheckRateLimit 为不读写会话历史、自行调用 Agent 的频道检查并消耗限流额度
+//
+// 超限时返回 *RateLimitError。
+func (g *Gateway) CheckRateLimit(channel, chatID, userID string) error {
+	identity := g.identities.resolve(channel, userID)
+	if err := g.limiter.allow(channel, chatID, rateUser(channel, userID, identity)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Authorize 为不读写会话历史、自行调用 Agent 的频道检查访问权限
+//
+// 返回用户的角色，无权访问时返回 ErrForbidden。
+func (g *Gateway) Authorize(channel, chatID, userID string) (string, error) {
+	role, ok := g.access.authorize(channel, chatID, userID)
+	if !ok {
+		return "", ErrForbidden
+	}
+	return role, nil
+}
+
+// RunOptions 返回按路由规则选择 Agent 配置、按角色限制工具与技能的运行选项，
+// 调用方可再设置事件回调
+//
+// 这类频道无法交互审批，启用审批时高风险工具一律拒绝。
+func (g *Gateway) RunOptions(channel, chatID, userID, role string) agent.RunOptions {
+	name, _ := g.router.route(Message{Channel: channel, ChatID: chatID, UserID: userID})
+	return g.profileRunOptions(name, role)
+}
+
+// AgentRunOptions 返回指定 Agent 配置的运行选项，配置不存在时返回 false
+func (g *Gateway) AgentRunOptions(name, role string) (agent.RunOptions, bool) {
+	if g.router.profile(name) == nil {
+		return agent.RunOptions{}, false
+	}
+	return g.profileRunOptions(name, role), true
+}
+
+// AgentAllowed 用户能否指定使用 Agent 配置 name：路由规则为其选择的配置，
+// 与 /model 一样，管理员可以使用所有配置
+func (g *Gateway) AgentAllowed(channel, chatID, userID, role, name string) bool {
+	if g.router.profile(name) == nil {
+		return false
+	}
+	routed, _ := g.router.route(Message{Channel: channel, ChatID: chatID, UserID: userID})
+	return name == routed || role == config.RoleAdmin
+}
+
+// AgentNames 返回所有 Agent 配置名，按名称排序
+func (g *Gateway) AgentNames() []string {
+	names := make([]string, 0, len(g.router.profiles))
+	for name := range g.router.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profileRunOptions 按角色规则与 Agent 配置生成运行选项
+func (g *Gateway) profileRunOptions(name, role string) agent.RunOptions {
+	opts := g.access.runOptions(role)
+	g.router.profile(name).apply(&opts)
+	if g.approvals.enabled {
+		opts.Approve = g.approvals.denyRisky
+	}
+	return opts
+}
+
+// RateLimitStats 返回限流状态
+func (g *Gateway) RateLimitStats() RateLimitStats {
+	return g.limiter.stats()
+}
+
+// QueueStats 返回消息队列状态
+func (g *Gateway) QueueStats() QueueStats {
+	return g.sched.stats()
+}
+
+// Start 启动消息处理协程和定时任务
+//
+// 同一会话的消息按顺序处理，不同会话最多由 workers 个协程并行处理。
+// 在 Start 之前收到的消息会排队等待。
 func (g *Gateway) Start() {
-	for msg := range g.msgChan {
-		go g.processMessage(msg)
+	g.sched.start(g.workers)
+	go g.runJobs()
+}
+
+// Shutdown 优雅关闭网关
+//
+// 先停止接收新消息，再等待排队和进行中的消息处理完成并发出回复；
+// ctx 到期后取消仍在运行的 Agent（包括工具和 MCP 调用），
+// 最后停止所有频道并关闭 MCP 子进程。
+func (g *Gateway) Shutdown(ctx context.Context) error {
+	g.draining.Store(true)
+
+	idle := make(chan struct{})
+	go func() {
+		g.sched.wait()
+		close(idle)
+	}()
+
+	var err error
+	select {
+	case <-idle:
+		g.sched.close()
+	case <-ctx.Done():
+		err = ctx.Err()
+		stats := g.sched.stats()
+		log.Printf("等待超时，取消 %d 个进行中和 %d 个排队的请求", stats.Running, stats.Queued)
+		g.cancel()
+
+		// 取消后运行会很快结束并回复中断提示；不响应取消的工具不再等待
+		select {
+		case <-idle:
+			g.sched.close()
+		case <-time.After(shutdownGrace):
+			log.Printf("仍有请求未结束，放弃等待")
+		}
 	}
+
+	g.StopChannels()
+	g.agent.Close()
+	g.dedup.close()
+	g.cancel()
+	return err
 }
 
 // processMessage 处理单条消息
 func (g *Gateway) processMessage(msg Message) {
-	ctx := context.Background()
-	
+	defer g.dedup.finish(msg.claims...)
+
+	if msg.command != nil {
+		g.sendReply(msg, msg.command(g, msg), nil)
+		return
+	}
+	if msg.task != nil {
+		g.runTask(msg.task)
+		return
+	}
+
+	// 每次运行可被 /stop 单独取消，关闭超时时随根上下文一起取消
+	ctx, cancel := context.WithCancel(g.ctx)
+	defer cancel()
+	key := msg.SessionKey()
+	g.trackRun(key, cancel)
+	defer g.untrackRun(key)
+
+	profile := g.router.profile(msg.Agent)
+	if t := profile.timeout(); t > 0 {
+		var stop context.CancelFunc
+		ctx, stop = context.WithTimeout(ctx, t)
+		defer stop()
+	}
+
 	// 获取或创建会话
-	sess := g.session.GetOrCreate(msg.UserID)
-	
-	// 记录用户消息
-	sess.AddMessage("user", msg.Text)
-	
-	log.Printf("[%s] %s: %s", msg.Channel, msg.UserID, msg.Text)
+	sess := g.session.GetOrCreate(key)
+
+	// 下载附件：图片随本轮消息发给模型，其他文件保存到工作区
+	text, images := g.prepareInput(ctx, msg)
+	text = quoted(msg, text)
+
+	// 记录用户消息，群聊中标注发言人；重新运行编辑的消息时替换原内容并丢弃原回复，
+	// 原消息已不在历史中（超出长度或被清空）时作为新的一轮追加
+	turn := turnKey(msg.Channel, msg.ChatID, msg.ID)
+	content := g.speakerText(msg, text)
+	found := false
+	if msg.Edited {
+		if found, _ = sess.EditTurn(turn, content); found {
+			sess.RemoveReplies(turn)
+		}
+	}
+	if !found {
+		sess.AddTurnMessage("user", content, turn)
+	}
+
+	if msg.Agent != "" {
+		log.Printf("[%s] %s → %s: %s", msg.Channel, msg.UserID, msg.Agent, text)
+	} else {
+		log.Printf("[%s] %s: %s", msg.Channel, msg.UserID, text)
+	}
 
 	// 转换消息格式
 	sessionMsgs := sess.GetMessages()
@@ -75,24 +605,89 @@ func (g *Gateway) processMessage(msg Message) {
 			Content: m.Content,
 		}
 	}
+	if len(images) > 0 {
+		last := &agentMsgs[len(agentMsgs)-1]
+		last.Parts = append([]agent.ContentPart{agent.TextPart(last.Content)}, images...)
+	}
+
+	// 按角色限制可用的工具与技能，高风险工具等待用户审批；
+	// 收集需要随回复发送的文件；支持流式事件的频道实时接收运行过程
+	var files []string
+	var es EventSender
+	if ch, ok := g.Channel(msg.Channel); ok {
+		es, _ = ch.(EventSender)
+	}
+	opts := g.access.runOptions(msg.Role)
+	opts.Model = sess.Model()
+	profile.apply(&opts)
+	if tool, ok := g.scheduleTool(msg); ok {
+		opts.Tools = append(opts.Tools, tool)
+	}
+	opts.Approve = g.approver(msg)
+	opts.Stream = es != nil
+	opts.OnEvent = func(ev agent.Event) {
+		if ev.Type == agent.EventFile {
+			files = append(files, ev.FilePath)
+		}
+		if es == nil {
+			return
+		}
+		if err := es.SendEvent(msg, ev); err != nil {
+			log.Printf("[%s] 发送事件失败: %v", msg.Channel, err)
+		}
+	}
 
 	// 调用 Agent 处理
-	reply, err := g.agent.Run(ctx, agentMsgs)
+	reply, err := g.agent.RunWithOptions(ctx, agentMsgs, opts)
 	if err != nil {
 		log.Printf("Agent 错误: %v", err)
 		reply = "抱歉，处理消息时出错了"
+		switch {
+		case g.ctx.Err() != nil:
+			reply = "服务正在重启，本次请求已中断，请稍后重试"
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			reply = "本次请求超时，已停止"
+		case ctx.Err() != nil:
+			reply = "本次请求已停止"
+		}
+		files = nil
 	}
 
 	// 记录助手回复
-	sess.AddMessage("assistant", reply)
+	sess.AddTurnMessage("assistant", reply, turn)
 
 	// 发送回复到对应频道
-	g.sendReply(msg, reply)
+	g.sendReply(msg, reply, replyAttachments(files))
 }
 
-// sendReply 发送回复到原频道
-func (g *Gateway) sendReply(msg Message, reply string) {
-	// 通过回调或直接调用 channel 的方法发送
-	// 这里简化处理，实际可以通过 channel 的接口发送
-	fmt.Printf("[回复 %s]: %s\n", msg.ChatID, reply)
+// sendReply 发送回复到原频道，编辑后重新运行的消息优先修改原回复
+func (g *Gateway) sendReply(msg Message, reply string, attachments []Attachment) {
+	r := Reply{
+		ChatID:       msg.ChatID,
+		ThreadID:     msg.ThreadID,
+		Text:         reply,
+		CoalescedIDs: msg.CoalescedIDs,
+		Attachments:  attachments,
+	}
+	if msg.inbound() {
+		r.ReplyToID = msg.ID
+	}
+	if msg.Edited {
+		if ch, ok := g.Channel(msg.Channel); ok {
+			if re, ok := ch.(ReplyEditor); ok {
+				edited, err := re.EditReply(r)
+				if edited {
+					return
+				}
+				if err != nil {
+					log.Printf("[%s] 修改原回复失败，改为发送新回复: %v", msg.Channel, err)
+				}
+			}
+		}
+	}
+
+	err := g.send(msg.Channel, r)
+	if err != nil {
+		log.Printf("[%s] 发送回复到 %s 失败: %v", msg.Channel, msg.ChatID, err)
+	}
 }
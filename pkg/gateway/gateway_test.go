@@ -0,0 +1,302 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+)
+
+func TestSessionKey(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+		want string
+	}{
+		{"私聊按频道隔离", Message{Channel: "telegram", UserID: "12345678", ChatID: "12345678"}, "telegram:12345678"},
+		{"HTTP 会话 ID 与 Telegram 用户 ID 相同", Message{Channel: "http", UserID: "key-abc", ChatID: "12345678", ClientChat: true}, "http:key-abc:12345678"},
+		{"HTTP 不同密钥的相同会话 ID", Message{Channel: "http", UserID: "key-def", ChatID: "12345678", ClientChat: true}, "http:key-def:12345678"},
+		{"HTTP 关联身份仍按会话 ID 隔离", Message{Channel: "http", UserID: "key-abc", ChatID: "demo", ClientChat: true, Identity: "user:abcd"}, "http:key-abc:demo"},
+		{"同类型的两个 Bot", Message{Channel: "telegram-ops", UserID: "12345678"}, "telegram-ops:12345678"},
+		{"关联身份共享私聊", Message{Channel: "slack", UserID: "U1", Identity: "user:abcd"}, "user:abcd"},
+		{"群聊共享上下文", Message{Channel: "discord", ChatID: "c1", UserID: "u1", IsGroup: true, SharedContext: true, Identity: "user:abcd"}, "discord:c1"},
+		{"群聊按成员隔离", Message{Channel: "discord", ChatID: "c1", UserID: "u1", IsGroup: true}, "discord:c1:u1"},
+		{"线程独立会话", Message{Channel: "slack", ChatID: "C1", ThreadID: "1.2", UserID: "U1", IsGroup: true}, "slack:C1:1.2"},
+		{"线程并入群聊", Message{Channel: "slack", ChatID: "C1", ThreadID: "1.2", UserID: "U1", IsGroup: true, SharedContext: true, ThreadInChat: true}, "slack:C1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.msg.SessionKey(); got != tt.want {
+				t.Errorf("SessionKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessEditedMessage(t *testing.T) {
+	llm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"新回复"},"finish_reason":"stop"}]}`)
+	}))
+	defer llm.Close()
+	t.Setenv("OPENAI_API_KEY", "test")
+	t.Setenv("OPENAI_BASE_URL", llm.URL)
+
+	msg := Message{ID: "7", Channel: "test", ChatID: "u1", UserID: "u1", Text: "改过的问题", Edited: true}
+	turn := turnKey(msg.Channel, msg.ChatID, msg.ID)
+
+	tests := []struct {
+		name    string
+		history func(g *Gateway)
+		want    []string
+	}{
+		{"替换原消息并丢弃原回复", func(g *Gateway) {
+			sess := g.session.GetOrCreate(msg.SessionKey())
+			sess.AddTurnMessage("user", "原问题", turn)
+			sess.AddTurnMessage("assistant", "原回复", turn)
+		}, []string{"user:改过的问题", "assistant:新回复"}},
+		{"原消息已不在历史中", func(g *Gateway) {
+			g.session.GetOrCreate(msg.SessionKey()).AddTurnMessage("user", "其他问题", "other")
+		}, []string{"user:其他问题", "user:改过的问题", "assistant:新回复"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New()
+			tt.history(g)
+			g.processMessage(msg)
+
+			var got []string
+			for _, m := range g.session.Get(msg.SessionKey()).GetMessages() {
+				got = append(got, m.Role+":"+m.Content)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("历史 %q，期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// recordChannel 记录发出回复的测试频道
+type recordChannel struct {
+	name    string
+	replies chan Reply
+}
+
+func (c *recordChannel) Name() string { return c.name }
+func (c *recordChannel) Start() error { return nil }
+func (c *recordChannel) Stop()        {}
+func (c *recordChannel) Send(reply Reply) error {
+	c.replies <- reply
+	return nil
+}
+
+func TestHandleMessageDeniedSkipsRateLimit(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "test")
+
+	g := New()
+	ch := &recordChannel{name: "slack", replies: make(chan Reply, 10)}
+	g.RegisterChannel(ch)
+	cfg := &config.Config{
+		Gateway: config.GatewayConfig{RateLimit: config.RateLimitConfig{
+			Channel: config.RateConfig{Rate: 1, Per: time.Hour},
+			Global:  config.RateConfig{Rate: 1, Per: time.Hour},
+		}},
+		Channels: []config.ChannelConfig{
+			{Name: "slack", Access: config.AccessConfig{AllowUsers: []string{"U1"}}},
+		},
+	}
+	g.access.configure(cfg)
+	g.limiter.configure(cfg)
+
+	// 外部用户反复发消息，只收到一次拒绝提示，也不消耗共享额度
+	for i := 0; i < 3; i++ {
+		msg := Message{ID: fmt.Sprint("x", i), Channel: "slack", ChatID: "D9", UserID: "U9", Text: "hi"}
+		if err := g.HandleMessage(msg); !errors.Is(err, ErrForbidden) {
+			t.Fatalf("第 %d 条消息 HandleMessage() = %v，应为 ErrForbidden", i, err)
+		}
+	}
+	msg := Message{ID: "1", Channel: "slack", ChatID: "D1", UserID: "U1", Text: "hi"}
+	if err := g.HandleMessage(msg); err != nil {
+		t.Fatalf("授权用户 HandleMessage() = %v，应放行", err)
+	}
+
+	select {
+	case r := <-ch.replies:
+		if r.Text != g.access.deniedMessage("slack") {
+			t.Errorf("拒绝提示 = %q", r.Text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("未收到拒绝提示")
+	}
+	select {
+	case r := <-ch.replies:
+		t.Errorf("拒绝提示应按用户限频，又收到 %q", r.Text)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestExecute(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "test")
+
+	g := New()
+	g.sched.queueSize = 1
+	execute := func(id string) chan error {
+		errc := make(chan error, 1)
+		go func() {
+			errc <- g.Execute(context.Background(), Message{ID: id, Channel: "openai", UserID: "k", ChatID: id, ClientChat: true}, func(ctx context.Context) {
+				<-ctx.Done()
+			})
+		}()
+		return errc
+	}
+	waitQueued := func() {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for g.QueueStats().Queued != 1 {
+			if time.Now().After(deadline) {
+				t.Fatal("等待排队超时")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// 未启动时运行在队列中等待，队列已满时拒绝
+	first := execute("a")
+	waitQueued()
+	if err := <-execute("b"); !errors.Is(err, ErrBusy) {
+		t.Fatalf("队列已满时 Execute() = %v，应为 ErrBusy", err)
+	}
+
+	// drop_oldest 丢弃排队的运行时，等待方收到 ErrBusy
+	g.overload = OverloadDropOldest
+	second := execute("c")
+	if err := receiveErr(t, first); !errors.Is(err, ErrBusy) {
+		t.Fatalf("被丢弃的运行 Execute() = %v，应为 ErrBusy", err)
+	}
+	waitQueued()
+
+	// 关闭超时后取消运行中的 run，之后不再接受新的运行
+	g.Start()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	g.Shutdown(ctx)
+	if err := receiveErr(t, second); err != nil {
+		t.Fatalf("运行结束后 Execute() = %v", err)
+	}
+	if err := <-execute("d"); !errors.Is(err, ErrShuttingDown) {
+		t.Fatalf("关闭后 Execute() = %v，应为 ErrShuttingDown", err)
+	}
+}
+
+// receiveErr 等待 Execute 返回
+func receiveErr(t *testing.T, errc chan error) error {
+	t.Helper()
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待 Execute 返回超时")
+	}
+	return nil
+}
+
+func TestSendReplyReference(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "test")
+
+	g := New()
+	ch := &recordChannel{name: "discord", replies: make(chan Reply, 1)}
+	g.RegisterChannel(ch)
+
+	tests := []struct {
+		name string
+		msg  Message
+		want string
+	}{
+		{"入站消息", Message{ID: "222", Channel: "discord", ChatID: "111"}, "222"},
+		{"定时任务", Message{ID: "job-ab12-20260101T000000", Channel: "discord", ChatID: "111", job: "ab12"}, ""},
+		{"通知", Message{ID: "notify-1", Channel: "discord", ChatID: "111", notice: true}, ""},
+	}
+	for _, tt := range tests {
+		g.sendReply(tt.msg, "hi", nil)
+		if r := <-ch.replies; r.ReplyToID != tt.want {
+			t.Errorf("%s: ReplyToID = %q, want %q", tt.name, r.ReplyToID, tt.want)
+		}
+	}
+}
+
+func TestDroppedMessageNotice(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "test")
+
+	// 未启动时消息留在队列中
+	g := New()
+	g.sched.queueSize = 1
+	g.overload = OverloadDropOldest
+	ch := &recordChannel{name: "telegram", replies: make(chan Reply, 1)}
+	g.RegisterChannel(ch)
+
+	for _, id := range []string{"1", "2"} {
+		if err := g.HandleMessage(Message{ID: id, Channel: "telegram", ChatID: "c" + id, UserID: "u" + id, Text: "hi"}); err != nil {
+			t.Fatalf("HandleMessage(%s) = %v", id, err)
+		}
+	}
+	select {
+	case r := <-ch.replies:
+		if r.ChatID != "c1" || r.ReplyToID != "1" || r.Text != g.busyMessage {
+			t.Errorf("丢弃提示 %+v，期望在 c1 回复 1 繁忙提示", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("被丢弃的消息未收到繁忙提示")
+	}
+}
+
+func TestHandleMessageDedupAfterProcessing(t *testing.T) {
+	llm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"好"},"finish_reason":"stop"}]}`)
+	}))
+	defer llm.Close()
+	t.Setenv("OPENAI_API_KEY", "test")
+	t.Setenv("OPENAI_BASE_URL", llm.URL)
+
+	dir := t.TempDir()
+	g := New()
+	g.Configure(&config.Config{Gateway: config.GatewayConfig{DataDir: dir}})
+	ch := &recordChannel{name: "telegram", replies: make(chan Reply, 1)}
+	g.RegisterChannel(ch)
+
+	// recorded 去重记录文件中是否有该消息，重启后按该文件判断重投递
+	recorded := func(msg Message) bool {
+		data, _ := os.ReadFile(filepath.Join(dir, dedupFile))
+		return strings.Contains(string(data), `"`+dedupKey(msg)+`"`)
+	}
+
+	msg := Message{ID: "1", Channel: "telegram", ChatID: "c1", UserID: "u1", Text: "hi"}
+	if err := g.HandleMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+	if recorded(msg) {
+		t.Fatal("排队中尚未处理的消息不应写入去重记录")
+	}
+
+	g.Start()
+	defer g.Shutdown(context.Background())
+	select {
+	case <-ch.replies:
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待回复超时")
+	}
+	// 回复发出后才写入记录
+	deadline := time.Now().Add(5 * time.Second)
+	for !recorded(msg) {
+		if time.Now().After(deadline) {
+			t.Fatal("处理完成的消息应写入去重记录")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
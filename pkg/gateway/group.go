@@ -0,0 +1,111 @@
+package gateway
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+)
+
+// groupPolicy 解析后的群聊策略
+type groupPolicy struct {
+	triggerAll    bool // 每条消息都回复
+	sharedContext bool // 全群共享会话
+	speakerNames  bool // 历史中标注发言人
+	passive       bool // 记录未触发回复的消息
+	threadInChat  bool // 线程消息并入群聊会话
+}
+
+// groupPolicy 返回消息所在群聊的策略：频道配置叠加 chat 级覆盖
+func (g *Gateway) groupPolicy(msg Message) groupPolicy {
+	p := groupPolicy{sharedContext: true, speakerNames: true}
+
+	cfg, ok := g.groups[msg.Channel]
+	if !ok {
+		return p
+	}
+	p.apply(cfg)
+	if chat, ok := cfg.Chats[msg.ChatID]; ok {
+		p.apply(chat)
+	}
+	return p
+}
+
+// apply 用配置中已设置的字段覆盖策略
+func (p *groupPolicy) apply(cfg config.GroupConfig) {
+	if cfg.Trigger != "" {
+		p.triggerAll = cfg.Trigger == "all"
+	}
+	if cfg.Context != "" {
+		p.sharedContext = cfg.Context == "shared"
+	}
+	if cfg.SpeakerNames != nil {
+		p.speakerNames = *cfg.SpeakerNames
+	}
+	if cfg.Passive != nil {
+		p.passive = *cfg.Passive
+	}
+	if cfg.Threads != "" {
+		p.threadInChat = cfg.Threads == "chat"
+	}
+}
+
+// admitGroup 处理群聊消息的触发规则
+//
+// 设置消息的会话归属；返回 false 表示无需回复，此时若 record 为 true
+// 则按策略将消息被动记录到会话。
+func (g *Gateway) admitGroup(msg *Message, record bool) bool {
+	p := g.groupPolicy(*msg)
+	msg.SharedContext = p.sharedContext
+	msg.ThreadInChat = p.threadInChat
+
+	if p.triggerAll || msg.Mentioned || strings.HasPrefix(msg.Text, "/") {
+		return true
+	}
+
+	if p.passive && record {
+		text := msg.Text
+		for _, att := range msg.Attachments {
+			text += fmt.Sprintf("\n[附件: %s]", att.FileName)
+		}
+		// 被动记录不经过调度队列，与进行中的运行并发时可能排在其回复之前
+		g.session.GetOrCreate(msg.SessionKey()).AddTurnMessage("user",
+			g.speakerText(*msg, quoted(*msg, strings.TrimSpace(text))), turnKey(msg.Channel, msg.ChatID, msg.ID))
+		log.Printf("[%s] 记录群聊消息 %s: %s", msg.Channel, msg.UserID, msg.Text)
+	}
+	return false
+}
+
+// quoteMaxRunes 引用内容写入历史的最大长度
+const quoteMaxRunes = 500
+
+// quoted 用户回复了某条消息时，在正文前附上被引用的内容，让 Agent 知道用户指的是什么
+func quoted(msg Message, text string) string {
+	quote := strings.TrimSpace(msg.ReplyToText)
+	if quote == "" {
+		return text
+	}
+	if r := []rune(quote); len(r) > quoteMaxRunes {
+		quote = string(r[:quoteMaxRunes]) + "…"
+	}
+	who := msg.ReplyToUser
+	if who == "" {
+		who = "一条消息"
+	} else {
+		who += " 的消息"
+	}
+	return fmt.Sprintf("[回复 %s: %s]\n%s", who, quote, text)
+}
+
+// speakerText 群聊中按策略为用户消息标注发言人
+func (g *Gateway) speakerText(msg Message, text string) string {
+	if !msg.IsGroup || !g.groupPolicy(msg).speakerNames {
+		return text
+	}
+	name := msg.UserName
+	if name == "" {
+		name = msg.UserID
+	}
+	return fmt.Sprintf("[%s]: %s", name, text)
+}
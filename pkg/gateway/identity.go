@@ -0,0 +1,301 @@
+package gateway
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// identityFile 数据目录下的身份关联记录
+	identityFile = "identities.json"
+	// linkCodeTTL 一次性关联码的有效期
+	linkCodeTTL = 10 * time.Minute
+	// linkCodeBytes 关联码的随机字节数，base32 编码后为 16 个字符
+	linkCodeBytes = 10
+	// linkHandleLen 关联码中用于查找发起者的前缀长度，其余部分为密钥
+	linkHandleLen = 4
+	// linkMaxFailures 每个身份在 linkFailureWindow 内允许输错关联码的次数
+	linkMaxFailures   = 5
+	linkFailureWindow = time.Hour
+)
+
+// 身份关联错误
+var (
+	ErrLinkCodeInvalid = errors.New("关联码无效或已过期，请在原频道重新发送 /link 获取")
+	ErrLinkSelf        = errors.New("不能关联到自己，请在另一个频道使用这个关联码")
+	ErrLinkLocked      = errors.New("关联码输错次数过多，请稍后再试")
+)
+
+// linkCode 等待使用的一次性关联码
+type linkCode struct {
+	identity string // 发起关联的身份 "channel:userID"
+	secret   string // 关联码去掉查找前缀后的部分
+	expires  time.Time
+}
+
+// linkFailures 身份输错关联码的次数，从第一次输错开始计算窗口
+type linkFailures struct {
+	count int
+	since time.Time
+}
+
+// identities 将各平台的身份关联到同一个内部用户
+//
+// 身份以 "频道名:平台用户 ID" 表示。用户在一个频道发送 /link 获取一次性关联码，
+// 在另一个频道发送 /link <关联码> 后两个身份（及其已关联的身份）归入同一个内部用户，
+// 私聊会话和限流额度随之跨频道共享；角色与访问控制仍只按各频道自己的身份判断，
+// 关联不会带来其他频道的权限。关联关系保存在数据目录，重启后保留。
+//
+// 关联码为 80 位随机数，前 4 位用于查找发起者：密钥部分输错一次即作废该关联码，
+// 同一身份输错次数过多时暂时禁止使用关联码，避免被暴力猜测。
+type identities struct {
+	mu       sync.Mutex
+	path     string                  // 为空时只保存在内存中
+	links    map[string]string       // 身份 → 内部用户 ID
+	codes    map[string]linkCode     // 关联码查找前缀 → 关联码
+	failures map[string]linkFailures // 使用关联码的身份 → 输错次数
+}
+
+// newIdentities 创建空的身份目录
+func newIdentities() *identities {
+	return &identities{
+		links:    make(map[string]string),
+		codes:    make(map[string]linkCode),
+		failures: make(map[string]linkFailures),
+	}
+}
+
+// configure 从数据目录加载关联关系
+func (d *identities) configure(dataDir string) {
+	if dataDir == "" {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.path = filepath.Join(dataDir, identityFile)
+	data, err := os.ReadFile(d.path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &d.links)
+	}
+	if err != nil {
+		log.Printf("加载身份关联记录失败: %v", err)
+		return
+	}
+	if len(d.links) > 0 {
+		log.Printf("已加载 %d 个关联身份", len(d.links))
+	}
+}
+
+// identityKey 平台身份的键
+func identityKey(channel, userID string) string {
+	return channel + ":" + userID
+}
+
+// resolve 返回身份关联的内部用户 ID，未关联时返回空字符串
+func (d *identities) resolve(channel, userID string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.links[identityKey(channel, userID)]
+}
+
+// members 返回内部用户关联的全部身份，按字典序排列
+func (d *identities) members(id string) []string {
+	if id == "" {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var out []string
+	for key, uid := range d.links {
+		if uid == id {
+			out = append(out, key)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// newCode 为身份生成一次性关联码，覆盖该身份之前未使用的关联码
+func (d *identities) newCode(channel, userID string) string {
+	identity := identityKey(channel, userID)
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for handle, lc := range d.codes {
+		if lc.identity == identity || now.After(lc.expires) {
+			delete(d.codes, handle)
+		}
+	}
+	code := newLinkCode()
+	for d.codes[code[:linkHandleLen]].identity != "" {
+		code = newLinkCode()
+	}
+	d.codes[code[:linkHandleLen]] = linkCode{identity: identity, secret: code[linkHandleLen:], expires: now.Add(linkCodeTTL)}
+	return formatLinkCode(code)
+}
+
+// redeem 使用关联码，将当前身份（及其已关联的身份）并入发起者的内部用户，返回内部用户 ID
+//
+// 查找前缀命中但密钥错误时作废该关联码；每次输错都计入当前身份的失败次数。
+func (d *identities) redeem(code, channel, userID string) (string, error) {
+	identity := identityKey(channel, userID)
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, f := range d.failures {
+		if now.Sub(f.since) > linkFailureWindow {
+			delete(d.failures, key)
+		}
+	}
+	if d.failures[identity].count >= linkMaxFailures {
+		return "", ErrLinkLocked
+	}
+
+	var lc linkCode
+	ok := len(code) > linkHandleLen
+	if ok {
+		handle := code[:linkHandleLen]
+		lc, ok = d.codes[handle]
+		if ok && (now.After(lc.expires) || subtle.ConstantTimeCompare([]byte(lc.secret), []byte(code[linkHandleLen:])) != 1) {
+			delete(d.codes, handle)
+			ok = false
+		}
+	}
+	if !ok {
+		f := d.failures[identity]
+		if f.count == 0 {
+			f.since = now
+		}
+		f.count++
+		d.failures[identity] = f
+		log.Printf("%s 输错关联码（%d/%d）", identity, f.count, linkMaxFailures)
+		return "", ErrLinkCodeInvalid
+	}
+	if lc.identity == identity {
+		return "", ErrLinkSelf
+	}
+	delete(d.codes, code[:linkHandleLen])
+	delete(d.failures, identity)
+
+	target := d.links[lc.identity]
+	if target == "" {
+		target = newUserID()
+		d.links[lc.identity] = target
+	}
+	if old := d.links[identity]; old != "" && old != target {
+		for key, uid := range d.links {
+			if uid == old {
+				d.links[key] = target
+			}
+		}
+	}
+	d.links[identity] = target
+
+	if err := d.saveLocked(); err != nil {
+		log.Printf("保存身份关联记录失败: %v", err)
+	}
+	return target, nil
+}
+
+// newLinkCode 生成关联码：linkCodeBytes 字节随机数的 base32 编码（大写字母和数字 2-7）
+func newLinkCode() string {
+	b := make([]byte, linkCodeBytes)
+	rand.Read(b)
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+}
+
+// formatLinkCode 每 4 个字符插入一个连字符，便于抄写；使用时忽略连字符
+func formatLinkCode(code string) string {
+	var parts []string
+	for len(code) > 4 {
+		parts = append(parts, code[:4])
+		code = code[4:]
+	}
+	return strings.Join(append(parts, code), "-")
+}
+
+// newUserID 生成内部用户 ID
+func newUserID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "user:" + hex.EncodeToString(b)
+}
+
+// unlink 解除身份的关联，内部用户只剩一个身份时一并移除；未关联时返回 false
+func (d *identities) unlink(channel, userID string) bool {
+	identity := identityKey(channel, userID)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	id, ok := d.links[identity]
+	if !ok {
+		return false
+	}
+	delete(d.links, identity)
+
+	var rest []string
+	for key, uid := range d.links {
+		if uid == id {
+			rest = append(rest, key)
+		}
+	}
+	if len(rest) == 1 {
+		delete(d.links, rest[0])
+	}
+
+	if err := d.saveLocked(); err != nil {
+		log.Printf("保存身份关联记录失败: %v", err)
+	}
+	return true
+}
+
+// saveLocked 写入临时文件后替换，避免写到一半时崩溃损坏记录
+func (d *identities) saveLocked() error {
+	if d.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(d.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(d.links, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := d.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.path)
+}
+
+// rateUser 限流使用的用户标识：已关联时按内部用户跨频道共享额度
+func rateUser(channel, userID, identity string) string {
+	if identity != "" {
+		return identity
+	}
+	return identityKey(channel, userID)
+}
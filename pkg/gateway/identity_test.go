@@ -0,0 +1,90 @@
+package gateway
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLinkCode(t *testing.T) {
+	code := newLinkCode()
+	if len(code) != 16 || formatLinkCode(code) != code[:4]+"-"+code[4:8]+"-"+code[8:12]+"-"+code[12:] {
+		t.Fatalf("newLinkCode() = %q", code)
+	}
+}
+
+func TestIdentitiesRedeem(t *testing.T) {
+	tests := []struct {
+		name  string
+		input func(code string) string
+		user  string
+		want  error
+	}{
+		{"原样输入", func(c string) string { return c }, "U1", nil},
+		{"小写且去掉连字符", func(c string) string { return strings.ToLower(strings.ReplaceAll(c, "-", "")) }, "U1", nil},
+		{"关联到自己", func(c string) string { return c }, "100", ErrLinkSelf},
+		{"密钥错误", func(c string) string { return c[:len(c)-1] + flip(c[len(c)-1]) }, "U1", ErrLinkCodeInvalid},
+		{"前缀不存在", func(c string) string { return flip(c[0]) + c[1:] }, "U1", ErrLinkCodeInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newIdentities()
+			code := d.newCode("telegram", "100")
+			channel := "slack"
+			if tt.user == "100" {
+				channel = "telegram"
+			}
+			id, err := d.redeem(tt.input(code), channel, tt.user)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("redeem() error = %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			if d.resolve("telegram", "100") != id || d.resolve("slack", tt.user) != id {
+				t.Errorf("两个身份未关联到 %s", id)
+			}
+			if _, err := d.redeem(code, "discord", "u1"); !errors.Is(err, ErrLinkCodeInvalid) {
+				t.Errorf("关联码被重复使用: %v", err)
+			}
+		})
+	}
+}
+
+func TestIdentitiesRedeemWrongGuessExpiresCode(t *testing.T) {
+	d := newIdentities()
+	code := d.newCode("telegram", "100")
+	wrong := code[:len(code)-1] + flip(code[len(code)-1])
+	if _, err := d.redeem(wrong, "slack", "attacker"); !errors.Is(err, ErrLinkCodeInvalid) {
+		t.Fatal(err)
+	}
+	// 发起者的关联码已作废，正确的关联码也不能再用
+	if _, err := d.redeem(code, "slack", "U1"); !errors.Is(err, ErrLinkCodeInvalid) {
+		t.Fatalf("猜错后关联码仍然有效: %v", err)
+	}
+}
+
+func TestIdentitiesRedeemLocksAfterFailures(t *testing.T) {
+	d := newIdentities()
+	for i := 0; i < linkMaxFailures; i++ {
+		if _, err := d.redeem("AAAA-BBBB-CCCC-DDDD", "slack", "attacker"); !errors.Is(err, ErrLinkCodeInvalid) {
+			t.Fatal(err)
+		}
+	}
+	code := d.newCode("telegram", "100")
+	if _, err := d.redeem(code, "slack", "attacker"); !errors.Is(err, ErrLinkLocked) {
+		t.Fatalf("超过失败次数后 redeem() error = %v, want ErrLinkLocked", err)
+	}
+	// 其他身份不受影响
+	if _, err := d.redeem(code, "slack", "U1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// flip 把 base32 字符换成另一个合法字符
+func flip(c byte) string {
+	if c == 'A' {
+		return "B"
+	}
+	return "A"
+}
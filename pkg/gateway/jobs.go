@@ -0,0 +1,635 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/cron"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/tools"
+)
+
+const (
+	// DefaultMaxJobsPerUser 每个用户最多的定时任务数
+	DefaultMaxJobsPerUser = 20
+	// jobsFile 数据目录下的定时任务记录
+	jobsFile = "jobs.json"
+	// jobIdleWait 没有任务时检查的间隔
+	jobIdleWait = time.Hour
+)
+
+// 定时任务错误
+var (
+	ErrJobNotFound  = errors.New("定时任务不存在")
+	ErrJobForbidden = errors.New("只能取消自己创建的定时任务")
+	ErrJobConfig    = errors.New("该任务由配置文件定义，请修改配置后重启")
+	ErrJobsDisabled = errors.New("定时任务未启用")
+)
+
+// job 定时任务：到时以 Prompt 运行 Agent，结果发送到创建任务的会话
+type job struct {
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"` // 配置中定义的任务名，用户任务为空
+	Prompt string `json:"prompt"`
+	// Cron 为空表示一次性任务，执行后删除
+	Cron string    `json:"cron,omitempty"`
+	Next time.Time `json:"next"`
+
+	Channel  string `json:"channel"`
+	ChatID   string `json:"chat_id"`
+	ThreadID string `json:"thread_id,omitempty"`
+	UserID   string `json:"user_id,omitempty"`
+	UserName string `json:"user_name,omitempty"`
+	IsGroup  bool   `json:"is_group,omitempty"`
+
+	Created time.Time `json:"created"`
+
+	role     string // 配置任务运行时的角色；用户任务运行时按访问控制重新授权
+	schedule *cron.Schedule
+}
+
+// fromConfig 是否由配置文件定义
+func (j *job) fromConfig() bool {
+	return j.Name != ""
+}
+
+// jobs 定时任务表
+//
+// 用户创建的任务保存在数据目录，重启后继续执行：错过的一次性任务在启动后立即执行，
+// 错过的周期任务不补跑，从下一个周期开始。配置中定义的任务每次启动时重新加载。
+type jobs struct {
+	// 配置，需在 Start 之前设置
+	enabled    bool
+	maxPerUser int
+	loc        *time.Location
+
+	mu   sync.Mutex
+	path string // 为空时只保存在内存中
+	list map[string]*job
+	wake chan struct{}
+}
+
+// newJobs 创建空的任务表
+func newJobs() *jobs {
+	return &jobs{
+		enabled:    true,
+		maxPerUser: DefaultMaxJobsPerUser,
+		loc:        time.Local,
+		list:       make(map[string]*job),
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// configure 应用配置，加载配置中定义的任务和数据目录中保存的任务
+func (s *jobs) configure(cfg *config.Config) {
+	jc := cfg.Gateway.Jobs
+	s.enabled = !jc.Disabled
+	if jc.MaxPerUser > 0 {
+		s.maxPerUser = jc.MaxPerUser
+	}
+	if jc.Timezone != "" {
+		if loc, err := time.LoadLocation(jc.Timezone); err == nil {
+			s.loc = loc
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().In(s.loc)
+	for _, jc := range cfg.Jobs {
+		sched, err := cron.Parse(jc.Cron)
+		if err != nil {
+			log.Printf("定时任务 %s: %v", jc.Name, err)
+			continue
+		}
+		j := &job{
+			ID:       jc.Name,
+			Name:     jc.Name,
+			Prompt:   jc.Prompt,
+			Cron:     jc.Cron,
+			Next:     sched.Next(now),
+			Channel:  jc.Channel,
+			ChatID:   jc.Chat,
+			ThreadID: jc.Thread,
+			UserID:   jc.User,
+			UserName: "定时任务",
+			IsGroup:  jc.User == "",
+			role:     jc.Role,
+			schedule: sched,
+		}
+		if j.role == "" {
+			j.role = config.RoleMember
+		}
+		s.list[j.ID] = j
+	}
+
+	if cfg.Gateway.DataDir != "" {
+		s.path = filepath.Join(cfg.Gateway.DataDir, jobsFile)
+		if err := s.loadLocked(now); err != nil {
+			log.Printf("加载定时任务失败: %v", err)
+		}
+	}
+}
+
+// loadLocked 读取保存的用户任务，周期任务跳过已错过的执行时间
+func (s *jobs) loadLocked(now time.Time) error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved []*job
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	for _, j := range saved {
+		if j.Cron != "" {
+			sched, err := cron.Parse(j.Cron)
+			if err != nil {
+				log.Printf("定时任务 %s: %v", j.ID, err)
+				continue
+			}
+			j.schedule = sched
+			if j.Next.Before(now) {
+				j.Next = sched.Next(now)
+			}
+		}
+		if _, ok := s.list[j.ID]; !ok {
+			s.list[j.ID] = j
+		}
+	}
+	if len(saved) > 0 {
+		log.Printf("已加载 %d 个定时任务", len(saved))
+	}
+	return nil
+}
+
+// saveLocked 写入临时文件后替换，只保存用户创建的任务
+func (s *jobs) saveLocked() {
+	if err := s.writeLocked(); err != nil {
+		log.Printf("保存定时任务失败: %v", err)
+	}
+}
+
+// writeLocked 写入临时文件后替换，避免写到一半时崩溃损坏记录
+func (s *jobs) writeLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	saved := []*job{}
+	for _, j := range s.list {
+		if !j.fromConfig() {
+			saved = append(saved, j)
+		}
+	}
+	sort.Slice(saved, func(a, b int) bool { return saved[a].Created.Before(saved[b].Created) })
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// add 添加用户任务，超过每个用户的上限时返回错误
+func (s *jobs) add(j *job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, other := range s.list {
+		if !other.fromConfig() && other.Channel == j.Channel && other.UserID == j.UserID {
+			n++
+		}
+	}
+	if n >= s.maxPerUser {
+		return fmt.Errorf("最多只能创建 %d 个定时任务，请先用 /cancel 取消不需要的任务", s.maxPerUser)
+	}
+
+	j.ID = s.newIDLocked()
+	j.Created = time.Now()
+	s.list[j.ID] = j
+	s.saveLocked()
+	s.notify()
+	return nil
+}
+
+// newIDLocked 生成未被占用的简短任务 ID，便于用户在 /cancel 中输入
+func (s *jobs) newIDLocked() string {
+	b := make([]byte, 4)
+	for {
+		rand.Read(b)
+		if id := hex.EncodeToString(b); s.list[id] == nil {
+			return id
+		}
+	}
+}
+
+// get 返回任务的副本
+func (s *jobs) get(id string) (job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.list[id]
+	if !ok {
+		return job{}, false
+	}
+	return *j, true
+}
+
+// remove 删除任务
+func (s *jobs) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.list, id)
+	s.saveLocked()
+	s.notify()
+}
+
+// inChat 返回发往会话的任务，按下次执行时间排列
+func (s *jobs) inChat(channel, chatID string) []job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []job
+	for _, j := range s.list {
+		if j.Channel == channel && j.ChatID == chatID {
+			out = append(out, *j)
+		}
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Next.Before(out[b].Next) })
+	return out
+}
+
+// due 取出到期的任务：周期任务计算下次执行时间，一次性任务删除
+func (s *jobs) due(now time.Time) []job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []job
+	changed := false
+	for id, j := range s.list {
+		if j.Next.After(now) {
+			continue
+		}
+		out = append(out, *j)
+		if j.schedule != nil {
+			j.Next = j.schedule.Next(now.In(s.loc))
+		}
+		if j.schedule == nil || j.Next.IsZero() {
+			delete(s.list, id)
+		}
+		changed = changed || !j.fromConfig()
+	}
+	if changed {
+		s.saveLocked()
+	}
+	return out
+}
+
+// next 最近一次执行时间，没有任务时返回零值
+func (s *jobs) next() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next time.Time
+	for _, j := range s.list {
+		if next.IsZero() || j.Next.Before(next) {
+			next = j.Next
+		}
+	}
+	return next
+}
+
+// notify 唤醒执行循环重新计算等待时间
+func (s *jobs) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// runJobs 等待并执行到期的定时任务，频道停止后退出
+func (g *Gateway) runJobs() {
+	for {
+		wait := jobIdleWait
+		if next := g.jobs.next(); !next.IsZero() {
+			wait = time.Until(next)
+		}
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-g.stopCh:
+			timer.Stop()
+			return
+		case <-g.jobs.wake:
+			timer.Stop()
+		case <-timer.C:
+			// 关闭期间不再执行，任务保持原状，重启后处理
+			if g.draining.Load() {
+				return
+			}
+			for _, j := range g.jobs.due(time.Now()) {
+				g.fireJob(j)
+			}
+		}
+	}
+}
+
+// fireJob 以任务的 Prompt 构造消息，按普通消息排队交给 Agent，回复发送到任务所在的会话
+func (g *Gateway) fireJob(j job) {
+	now := time.Now()
+	msg := Message{
+		// 每次执行使用独立的消息 ID，作为会话历史中的轮次；该 ID 不存在于频道上，回复不引用它
+		ID:        "job-" + j.ID + "-" + now.UTC().Format("20060102T150405"),
+		Channel:   j.Channel,
+		ChatID:    j.ChatID,
+		ThreadID:  j.ThreadID,
+		UserID:    j.UserID,
+		UserName:  j.UserName,
+		IsGroup:   j.IsGroup,
+		Text:      j.Prompt,
+		Timestamp: now,
+		Role:      j.role,
+		job:       j.ID,
+	}
+
+	// 用户任务按创建者当前的权限运行，失去访问权限后不再执行
+	if !j.fromConfig() {
+		msg.Identity = g.identities.resolve(msg.Channel, msg.UserID)
+		role, allowed := g.access.authorize(msg.Channel, msg.ChatID, msg.UserID)
+		if !allowed {
+			log.Printf("[%s] %s 已无权访问，跳过定时任务 %s", msg.Channel, msg.UserID, j.ID)
+			return
+		}
+		msg.Role = role
+	}
+	if msg.IsGroup {
+		g.admitGroup(&msg, false)
+	}
+	msg.Agent, msg.Text = g.router.route(msg)
+	msg.Text = fmt.Sprintf("[定时任务 %s] %s", j.ID, msg.Text)
+
+	log.Printf("[%s] 执行定时任务 %s: %s", msg.Channel, j.ID, j.Prompt)
+	if _, err := g.sched.enqueue(msg, OverloadReject); err != nil {
+		log.Printf("[%s] 队列已满，跳过定时任务 %s", msg.Channel, j.ID)
+	}
+}
+
+// createJob 为消息所在的会话创建定时任务，at 与 cronExpr 二选一
+func (g *Gateway) createJob(msg Message, prompt, at, cronExpr string) (job, error) {
+	if !g.jobs.enabled {
+		return job{}, ErrJobsDisabled
+	}
+	prompt = strings.TrimSpace(prompt)
+	if prompt == "" {
+		return job{}, errors.New("缺少任务内容")
+	}
+
+	j := &job{
+		Prompt:   prompt,
+		Channel:  msg.Channel,
+		ChatID:   msg.ChatID,
+		ThreadID: msg.ThreadID,
+		UserID:   msg.UserID,
+		UserName: msg.UserName,
+		IsGroup:  msg.IsGroup,
+	}
+	now := time.Now().In(g.jobs.loc)
+	switch {
+	case cronExpr != "" && at != "":
+		return job{}, errors.New("at 与 cron 只能设置一个")
+	case cronExpr != "":
+		sched, err := cron.Parse(cronExpr)
+		if err != nil {
+			return job{}, err
+		}
+		j.Cron, j.schedule, j.Next = sched.String(), sched, sched.Next(now)
+		if j.Next.IsZero() {
+			return job{}, fmt.Errorf("cron 表达式 %q 不会执行", cronExpr)
+		}
+	case at != "":
+		when, err := parseWhen(at, now)
+		if err != nil {
+			return job{}, err
+		}
+		j.Next = when
+	default:
+		return job{}, errors.New("需要设置执行时间 at 或 cron 表达式")
+	}
+
+	if err := g.jobs.add(j); err != nil {
+		return job{}, err
+	}
+	log.Printf("[%s] %s 创建定时任务 %s（%s）: %s", msg.Channel, msg.UserID, j.ID, j.describe(), prompt)
+	return *j, nil
+}
+
+// cancelJob 取消会话中的定时任务，只有创建者和管理员可以取消
+func (g *Gateway) cancelJob(msg Message, id string) error {
+	j, ok := g.jobs.get(strings.TrimSpace(id))
+	if !ok || j.Channel != msg.Channel || j.ChatID != msg.ChatID {
+		return ErrJobNotFound
+	}
+	if j.fromConfig() {
+		return ErrJobConfig
+	}
+	if j.UserID != msg.UserID && msg.Role != config.RoleAdmin {
+		return ErrJobForbidden
+	}
+	g.jobs.remove(j.ID)
+	log.Printf("[%s] %s 取消定时任务 %s", msg.Channel, msg.UserID, j.ID)
+	return nil
+}
+
+// listJobs 列出会话中的定时任务
+func (g *Gateway) listJobs(msg Message) string {
+	list := g.jobs.inChat(msg.Channel, msg.ChatID)
+	if len(list) == 0 {
+		return "当前会话没有定时任务"
+	}
+
+	var b strings.Builder
+	for _, j := range list {
+		owner := j.UserName
+		if j.fromConfig() {
+			owner = "配置文件"
+		} else if owner == "" {
+			owner = j.UserID
+		}
+		fmt.Fprintf(&b, "**%s** %s，下次 %s，创建者 %s\n  %s\n",
+			j.ID, j.describe(), j.Next.In(g.jobs.loc).Format(jobTimeLayout), owner, preview(j.Prompt, 80))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// jobTimeLayout 显示执行时间的格式
+const jobTimeLayout = "2006-01-02 15:04"
+
+// describe 任务的执行规则
+func (j job) describe() string {
+	if j.Cron != "" {
+		return "cron " + j.Cron
+	}
+	return "一次性"
+}
+
+// whenLayouts parseWhen 支持的绝对时间格式
+var whenLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+}
+
+// parseWhen 解析一次性任务的执行时间
+//
+// 支持相对时间（30m、2h、1d、1d12h）、当天或次日的时刻（15:04）
+// 以及日期时间（2006-01-02 15:04、RFC3339），结果须晚于 now。
+func parseWhen(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	invalid := fmt.Errorf("无法识别的时间 %q，可以使用 30m、2h、1d、15:04 或 2006-01-02 15:04", s)
+
+	if d, ok := parseRelative(s); ok {
+		if d <= 0 {
+			return time.Time{}, invalid
+		}
+		return now.Add(d), nil
+	}
+
+	if t, err := time.ParseInLocation("15:04", s, now.Location()); err == nil {
+		when := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+		if !when.After(now) {
+			when = when.AddDate(0, 0, 1)
+		}
+		return when, nil
+	}
+
+	for _, layout := range whenLayouts {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			if !t.After(now) {
+				return time.Time{}, fmt.Errorf("时间 %s 已经过去", s)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, invalid
+}
+
+// parseRelative 解析 Go 时长格式，额外支持以天为单位的 d 前缀部分（如 1d12h）
+func parseRelative(s string) (time.Duration, bool) {
+	var days time.Duration
+	if i := strings.IndexByte(s, 'd'); i > 0 {
+		n, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return 0, false
+		}
+		days = time.Duration(n) * 24 * time.Hour
+		s = s[i+1:]
+		if s == "" {
+			return days, true
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, false
+	}
+	return days + d, true
+}
+
+// ScheduleTool 创建和管理定时任务的工具名
+const ScheduleTool = "schedule"
+
+// scheduleTool 绑定到消息所在会话的定时任务工具，未启用定时任务时返回 false
+func (g *Gateway) scheduleTool(msg Message) (tools.Tool, bool) {
+	// 定时任务触发的运行不能再创建任务，避免任务无限繁殖
+	if !g.jobs.enabled || msg.UserID == "" || msg.job != "" {
+		return tools.Tool{}, false
+	}
+
+	now := time.Now().In(g.jobs.loc)
+	return tools.Tool{
+		Name: ScheduleTool,
+		Description: "管理当前会话的定时任务：到时以 prompt 作为指令运行助手，结果发送到当前会话。" +
+			"action 为 create（at 与 cron 二选一）、list 或 cancel（需要 id）。当前时间: " +
+			now.Format("2006-01-02 15:04 (Mon) MST"),
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"action": map[string]interface{}{
+					"type": "string",
+					"enum": []string{"create", "list", "cancel"},
+				},
+				"prompt": map[string]string{
+					"type":        "string",
+					"description": "到时交给助手执行的指令，需写清楚要做什么，如「提醒用户参加 15:00 的评审会」",
+				},
+				"at": map[string]string{
+					"type":        "string",
+					"description": "一次性执行时间：相对时间 30m、2h、1d，或 15:04、2006-01-02 15:04（当前时区）",
+				},
+				"cron": map[string]string{
+					"type":        "string",
+					"description": "周期执行的 5 字段 cron 表达式（分钟 小时 日 月 星期），如 0 9 * * 1-5",
+				},
+				"id": map[string]string{
+					"type":        "string",
+					"description": "要取消的任务 ID",
+				},
+			},
+			"required": []string{"action"},
+		},
+		Handler: func(ctx context.Context, args string) (string, error) {
+			var params struct {
+				Action string `json:"action"`
+				Prompt string `json:"prompt"`
+				At     string `json:"at"`
+				Cron   string `json:"cron"`
+				ID     string `json:"id"`
+			}
+			if err := json.Unmarshal([]byte(args), &params); err != nil {
+				return "", err
+			}
+			switch params.Action {
+			case "create":
+				j, err := g.createJob(msg, params.Prompt, params.At, params.Cron)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("已创建定时任务 %s（%s），下次执行: %s",
+					j.ID, j.describe(), j.Next.In(g.jobs.loc).Format(jobTimeLayout)), nil
+			case "list":
+				return g.listJobs(msg), nil
+			case "cancel":
+				if err := g.cancelJob(msg, params.ID); err != nil {
+					return "", err
+				}
+				return "已取消定时任务 " + params.ID, nil
+			}
+			return "", fmt.Errorf("不支持的 action %q", params.Action)
+		},
+	}, true
+}
@@ -0,0 +1,115 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// 主动通知错误
+var (
+	ErrChannelNotFound = errors.New("频道不存在")
+	ErrInvalidNotify   = errors.New("无效的通知")
+)
+
+// Notification 外部系统（CI、监控等）主动推送到某个会话的消息
+type Notification struct {
+	Channel  string `json:"channel"`
+	ChatID   string `json:"chat_id"`
+	ThreadID string `json:"thread_id,omitempty"`
+	// UserID 私聊的对方用户；群聊中可选，按成员独立上下文时写入该成员的会话
+	UserID  string `json:"user_id,omitempty"`
+	IsGroup bool   `json:"is_group,omitempty"`
+	// Source 来源名称，如 "ci"，群聊中作为发言人写入历史
+	Source string `json:"source,omitempty"`
+	// Text 通知内容
+	Text string `json:"text"`
+	// Prompt 非空时以通知内容和 Prompt 运行 Agent，将 Agent 的回复发送到会话
+	Prompt string `json:"prompt,omitempty"`
+}
+
+// Notify 向指定会话推送通知，并写入该会话的历史，用户可以直接追问
+//
+// 没有 Prompt 时原样发送 Text；有 Prompt 时与定时任务一样进入调度队列，
+// 由会话的角色权限运行 Agent。目标会话需通过该频道的访问控制。
+func (g *Gateway) Notify(n Notification) error {
+	n.Text, n.Prompt = strings.TrimSpace(n.Text), strings.TrimSpace(n.Prompt)
+	switch {
+	case n.Channel == "" || n.ChatID == "":
+		return fmt.Errorf("%w: 缺少 channel 或 chat_id", ErrInvalidNotify)
+	case n.Text == "" && n.Prompt == "":
+		return fmt.Errorf("%w: text 和 prompt 不能同时为空", ErrInvalidNotify)
+	case !n.IsGroup && n.UserID == "":
+		return fmt.Errorf("%w: 私聊通知需要 user_id", ErrInvalidNotify)
+	}
+	if _, ok := g.Channel(n.Channel); !ok {
+		return fmt.Errorf("%w: %s", ErrChannelNotFound, n.Channel)
+	}
+	if g.draining.Load() {
+		return ErrShuttingDown
+	}
+
+	source := n.Source
+	if source == "" {
+		source = "外部系统"
+	}
+	now := time.Now()
+	msg := Message{
+		// 每条通知使用独立的消息 ID，作为会话历史中的轮次；该 ID 不存在于频道上，回复不引用它
+		ID:        fmt.Sprintf("notify-%d", now.UnixNano()),
+		Channel:   n.Channel,
+		ChatID:    n.ChatID,
+		ThreadID:  n.ThreadID,
+		UserID:    n.UserID,
+		UserName:  source,
+		IsGroup:   n.IsGroup,
+		Timestamp: now,
+		notice:    true,
+	}
+	if msg.UserID != "" {
+		msg.Identity = g.identities.resolve(msg.Channel, msg.UserID)
+	}
+	role, allowed := g.access.authorize(msg.Channel, msg.ChatID, msg.UserID)
+	if !allowed {
+		log.Printf("[%s] 会话 %s 无权访问，拒绝来自 %s 的通知", msg.Channel, msg.ChatID, source)
+		return ErrForbidden
+	}
+	msg.Role = role
+	if msg.IsGroup {
+		g.admitGroup(&msg, false)
+	}
+
+	if n.Prompt == "" {
+		return g.deliverNotice(msg, n.Text)
+	}
+
+	msg.Text = n.Prompt
+	msg.Agent, msg.Text = g.router.route(msg)
+	if n.Text != "" {
+		msg.Text = fmt.Sprintf("%s\n\n[来自 %s 的通知]\n%s", msg.Text, source, n.Text)
+	}
+	log.Printf("[%s] 收到来自 %s 的通知，运行 Agent: %s", msg.Channel, source, preview(n.Prompt, 80))
+	if _, err := g.sched.enqueue(msg, OverloadReject); err != nil {
+		log.Printf("[%s] 队列已满，拒绝来自 %s 的通知", msg.Channel, source)
+		return err
+	}
+	return nil
+}
+
+// deliverNotice 原样发送通知，发送成功后作为机器人的发言写入会话历史
+//
+// 群聊按成员独立上下文且未指定成员时没有对应的会话，只发送不记录。
+func (g *Gateway) deliverNotice(msg Message, text string) error {
+	if err := g.send(msg.Channel, Reply{ChatID: msg.ChatID, ThreadID: msg.ThreadID, Text: text}); err != nil {
+		return err
+	}
+	log.Printf("[%s] 发送来自 %s 的通知到 %s: %s", msg.Channel, msg.UserName, msg.ChatID, preview(text, 80))
+
+	if msg.IsGroup && !msg.SharedContext && msg.UserID == "" && (msg.ThreadID == "" || msg.ThreadInChat) {
+		return nil
+	}
+	g.session.GetOrCreate(msg.SessionKey()).AddTurnMessage("assistant", text, turnKey(msg.Channel, msg.ChatID, msg.ID))
+	return nil
+}
@@ -0,0 +1,358 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+)
+
+// 限流范围
+const (
+	RateScopeUser    = "user"
+	RateScopeChat    = "chat"
+	RateScopeChannel = "channel"
+	RateScopeGlobal  = "global"
+)
+
+// 限流默认参数
+const (
+	// defaultRatePeriod 未设置 per 时的补充周期
+	defaultRatePeriod = time.Minute
+	// ratePruneInterval 清理已补满令牌桶的间隔
+	ratePruneInterval = time.Minute
+	// defaultRateLimitMessage 限流时回复给用户的默认提示
+	defaultRateLimitMessage = "消息发送太频繁啦，请 {retry_after}后再试"
+	// deniedReplyInterval 同一用户两次无权访问提示之间的最短间隔
+	deniedReplyInterval = time.Minute
+)
+
+// ErrRateLimited 消息因限流被拒绝，详细信息见 RateLimitError
+var ErrRateLimited = errors.New("请求过于频繁")
+
+// RateLimitError 限流拒绝的范围与建议等待时间
+type RateLimitError struct {
+	Scope      string        // 触发限流的范围：user / chat / channel / global
+	RetryAfter time.Duration // 令牌补充到可用所需的时间
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("请求过于频繁（%s 级限流），请 %s后重试", e.Scope, formatWait(e.RetryAfter))
+}
+
+// Is 使 errors.Is(err, ErrRateLimited) 成立
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// RateLimitStats 限流状态
+type RateLimitStats struct {
+	Allowed   int64                           `json:"allowed"`   // 放行的消息数
+	Throttled map[string]int64                `json:"throttled"` // 按范围统计的拒绝次数
+	Limits    map[string]map[string]RateLimit `json:"limits"`    // 各频道生效的限额，"*" 为默认值
+	Buckets   []BucketStats                   `json:"buckets"`   // 令牌未补满的桶
+}
+
+// RateLimit 单个令牌桶的限额
+type RateLimit struct {
+	Rate  int    `json:"rate"`
+	Per   string `json:"per"`
+	Burst int    `json:"burst"`
+}
+
+// BucketStats 令牌桶当前状态
+type BucketStats struct {
+	Key        string  `json:"key"`
+	Scope      string  `json:"scope"`
+	Tokens     float64 `json:"tokens"`
+	Burst      int     `json:"burst"`
+	RetryAfter float64 `json:"retry_after_seconds,omitempty"` // 令牌不足时距离下一个令牌的秒数
+}
+
+// rate 令牌桶参数，rate 为 0 表示不限制
+type rate struct {
+	rate  int
+	per   time.Duration
+	burst int
+}
+
+// perSecond 每秒补充的令牌数
+func (r rate) perSecond() float64 {
+	return float64(r.rate) / r.per.Seconds()
+}
+
+// limits 单个频道生效的限额
+type limits struct {
+	user, chat, channel rate
+}
+
+// merge 用配置覆盖已有限额：rate 为 0 沿用，-1 取消限制
+func (r rate) merge(rc config.RateConfig) rate {
+	switch {
+	case rc.Rate == 0:
+		return r
+	case rc.Rate < 0:
+		return rate{}
+	}
+	out := rate{rate: rc.Rate, per: rc.Per, burst: rc.Burst}
+	if out.per <= 0 {
+		out.per = defaultRatePeriod
+	}
+	if out.burst <= 0 {
+		out.burst = out.rate
+	}
+	return out
+}
+
+// bucket 令牌桶
+type bucket struct {
+	scope  string
+	r      rate
+	tokens float64
+	last   time.Time
+}
+
+// refill 按流逝时间补充令牌
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.r.burst), b.tokens+now.Sub(b.last).Seconds()*b.r.perSecond())
+	b.last = now
+}
+
+// rateLimiter 按用户、会话、频道和全局四级令牌桶限流
+//
+// 一条消息需要所有适用的桶都有令牌才会放行，放行时各扣一个；
+// 任一桶不足时整体拒绝且不扣令牌，避免被拒绝的消息继续消耗额度。
+type rateLimiter struct {
+	// 配置，需在 Start 之前设置
+	defaults        limits
+	channels        map[string]limits
+	global          rate
+	message         string
+	channelMessages map[string]string
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	notified  map[string]time.Time // 用户 → 该时间之前不再重复发送限流提示
+	allowed   int64
+	throttled map[string]int64
+	lastPrune time.Time
+}
+
+// newRateLimiter 创建不做任何限制的限流器
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		channels:        make(map[string]limits),
+		message:         defaultRateLimitMessage,
+		channelMessages: make(map[string]string),
+		buckets:         make(map[string]*bucket),
+		notified:        make(map[string]time.Time),
+		throttled:       make(map[string]int64),
+	}
+}
+
+// configure 应用网关级默认值与频道级覆盖
+func (l *rateLimiter) configure(cfg *config.Config) {
+	rl := cfg.Gateway.RateLimit
+	l.defaults = limits{
+		user:    rate{}.merge(rl.User),
+		chat:    rate{}.merge(rl.Chat),
+		channel: rate{}.merge(rl.Channel),
+	}
+	l.global = rate{}.merge(rl.Global)
+	if rl.Message != "" {
+		l.message = rl.Message
+	}
+
+	for _, ch := range cfg.Channels {
+		l.channels[ch.Name] = limits{
+			user:    l.defaults.user.merge(ch.RateLimit.User),
+			chat:    l.defaults.chat.merge(ch.RateLimit.Chat),
+			channel: l.defaults.channel.merge(ch.RateLimit.Channel),
+		}
+		if ch.RateLimit.Message != "" {
+			l.channelMessages[ch.Name] = ch.RateLimit.Message
+		}
+	}
+}
+
+// limitsFor 返回频道生效的限额
+func (l *rateLimiter) limitsFor(channel string) limits {
+	if lim, ok := l.channels[channel]; ok {
+		return lim
+	}
+	return l.defaults
+}
+
+// allow 检查并消耗令牌，被拒绝时返回触发限流的范围与等待时间
+//
+// user 为 rateUser 返回的用户标识，关联了身份的用户在各频道共享用户级额度。
+func (l *rateLimiter) allow(channel, chatID, user string) *RateLimitError {
+	lim := l.limitsFor(channel)
+	checks := []struct {
+		scope, key string
+		r          rate
+	}{
+		{RateScopeUser, "user:" + user, lim.user},
+		{RateScopeChat, "chat:" + channel + ":" + chatID, lim.chat},
+		{RateScopeChannel, "channel:" + channel, lim.channel},
+		{RateScopeGlobal, "global", l.global},
+	}
+
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.pruneLocked(now)
+
+	var denied *RateLimitError
+	var take []*bucket
+	for _, c := range checks {
+		if c.r.rate == 0 {
+			continue
+		}
+		b, ok := l.buckets[c.key]
+		if !ok {
+			b = &bucket{scope: c.scope, r: c.r, tokens: float64(c.r.burst), last: now}
+			l.buckets[c.key] = b
+		}
+		b.refill(now)
+		if b.tokens >= 1 {
+			take = append(take, b)
+			continue
+		}
+
+		// 多个范围同时不足时以等待最久的为准
+		wait := time.Duration((1 - b.tokens) / c.r.perSecond() * float64(time.Second))
+		if denied == nil || wait > denied.RetryAfter {
+			denied = &RateLimitError{Scope: c.scope, RetryAfter: wait}
+		}
+	}
+
+	if denied != nil {
+		l.throttled[denied.Scope]++
+		return denied
+	}
+	for _, b := range take {
+		b.tokens--
+	}
+	l.allowed++
+	return nil
+}
+
+// notify 判断是否需要向用户发送限流提示，同一用户在等待期内只提示一次
+func (l *rateLimiter) notify(user string, retryAfter time.Duration) bool {
+	key := user
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Before(l.notified[key]) {
+		return false
+	}
+	l.notified[key] = now.Add(retryAfter)
+	return true
+}
+
+// replyText 限流提示文本
+func (l *rateLimiter) replyText(channel string, retryAfter time.Duration) string {
+	tpl := l.message
+	if m, ok := l.channelMessages[channel]; ok {
+		tpl = m
+	}
+	return strings.ReplaceAll(tpl, "{retry_after}", formatWait(retryAfter))
+}
+
+// pruneLocked 定期清理已补满的令牌桶和过期的提示记录
+func (l *rateLimiter) pruneLocked(now time.Time) {
+	if now.Sub(l.lastPrune) < ratePruneInterval {
+		return
+	}
+	l.lastPrune = now
+
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.r.burst) {
+			delete(l.buckets, key)
+		}
+	}
+	for key, until := range l.notified {
+		if now.After(until) {
+			delete(l.notified, key)
+		}
+	}
+}
+
+// stats 返回限流状态
+func (l *rateLimiter) stats() RateLimitStats {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := RateLimitStats{
+		Allowed:   l.allowed,
+		Throttled: make(map[string]int64),
+		Limits:    map[string]map[string]RateLimit{"*": l.defaults.describe(l.global)},
+		Buckets:   []BucketStats{},
+	}
+	for scope, n := range l.throttled {
+		s.Throttled[scope] = n
+	}
+	for name, lim := range l.channels {
+		s.Limits[name] = lim.describe(rate{})
+	}
+
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.r.burst) {
+			continue
+		}
+		bs := BucketStats{
+			Key:    key,
+			Scope:  b.scope,
+			Tokens: math.Round(b.tokens*100) / 100,
+			Burst:  b.r.burst,
+		}
+		if b.tokens < 1 {
+			bs.RetryAfter = math.Ceil((1 - b.tokens) / b.r.perSecond())
+		}
+		s.Buckets = append(s.Buckets, bs)
+	}
+	sort.Slice(s.Buckets, func(i, j int) bool { return s.Buckets[i].Key < s.Buckets[j].Key })
+	return s
+}
+
+// describe 以范围为键列出生效的限额，未限制的范围省略
+func (lim limits) describe(global rate) map[string]RateLimit {
+	out := make(map[string]RateLimit)
+	for scope, r := range map[string]rate{
+		RateScopeUser:    lim.user,
+		RateScopeChat:    lim.chat,
+		RateScopeChannel: lim.channel,
+		RateScopeGlobal:  global,
+	} {
+		if r.rate > 0 {
+			out[scope] = RateLimit{Rate: r.rate, Per: r.per.String(), Burst: r.burst}
+		}
+	}
+	return out
+}
+
+// formatWait 将等待时间格式化为面向用户的文本，向上取整
+func formatWait(d time.Duration) string {
+	secs := int(math.Ceil(d.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	if secs < 60 {
+		return fmt.Sprintf("%d 秒", secs)
+	}
+	return fmt.Sprintf("%d 分钟", (secs+59)/60)
+}
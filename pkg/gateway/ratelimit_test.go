@@ -0,0 +1,105 @@
+package gateway
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+)
+
+func TestBucketRefill(t *testing.T) {
+	t0 := time.Unix(1700000000, 0)
+	perMinute := rate{rate: 60, per: time.Minute, burst: 5}
+	tests := []struct {
+		name    string
+		r       rate
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{"每秒补充一个", perMinute, 0, time.Second, 1},
+		{"补充不足一个", perMinute, 0, 500 * time.Millisecond, 0.5},
+		{"在已有令牌上累加", perMinute, 2.5, 2 * time.Second, 4.5},
+		{"不超过 burst", perMinute, 0, 10 * time.Second, 5},
+		{"已满保持不变", perMinute, 5, time.Hour, 5},
+		{"时间未流逝", perMinute, 1, 0, 1},
+		{"每小时 2 个", rate{rate: 2, per: time.Hour, burst: 2}, 0, 45 * time.Minute, 1.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bucket{r: tt.r, tokens: tt.tokens, last: t0}
+			b.refill(t0.Add(tt.elapsed))
+			if math.Abs(b.tokens-tt.want) > 1e-9 {
+				t.Errorf("tokens = %v, want %v", b.tokens, tt.want)
+			}
+			if !b.last.Equal(t0.Add(tt.elapsed)) {
+				t.Errorf("last = %v", b.last)
+			}
+		})
+	}
+}
+
+func TestRateMerge(t *testing.T) {
+	base := rate{rate: 10, per: time.Minute, burst: 10}
+	tests := []struct {
+		name string
+		rc   config.RateConfig
+		want rate
+	}{
+		{"0 沿用上一级", config.RateConfig{}, base},
+		{"-1 取消限制", config.RateConfig{Rate: -1}, rate{}},
+		{"默认周期与突发", config.RateConfig{Rate: 3}, rate{rate: 3, per: time.Minute, burst: 3}},
+		{"完整覆盖", config.RateConfig{Rate: 5, Per: time.Hour, Burst: 8}, rate{rate: 5, per: time.Hour, burst: 8}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := base.merge(tt.rc); got != tt.want {
+				t.Errorf("merge() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	l := newRateLimiter()
+	l.configure(&config.Config{
+		Gateway: config.GatewayConfig{RateLimit: config.RateLimitConfig{
+			User: config.RateConfig{Rate: 2, Per: time.Hour},
+			Chat: config.RateConfig{Rate: 3, Per: time.Hour},
+		}},
+		Channels: []config.ChannelConfig{
+			{Name: "http", RateLimit: config.RateLimitConfig{User: config.RateConfig{Rate: -1}, Chat: config.RateConfig{Rate: -1}}},
+		},
+	})
+
+	steps := []struct {
+		channel, chat, user string
+		scope               string // 为空表示放行
+	}{
+		{"telegram", "c1", "u1", ""},
+		{"telegram", "c1", "u1", ""},
+		{"telegram", "c1", "u1", RateScopeUser},
+		{"telegram", "c1", "u2", ""},
+		{"telegram", "c1", "u3", RateScopeChat},
+		// 被拒绝的消息不消耗其他桶的令牌，u3 在 c2 仍有用户额度
+		{"telegram", "c2", "u3", ""},
+		{"http", "c1", "u1", ""},
+		{"http", "c1", "u1", ""},
+		{"http", "c1", "u1", ""},
+	}
+	for i, s := range steps {
+		err := l.allow(s.channel, s.chat, s.user)
+		switch {
+		case s.scope == "" && err != nil:
+			t.Fatalf("第 %d 步 allow(%s, %s, %s) = %v，应放行", i, s.channel, s.chat, s.user, err)
+		case s.scope != "" && (err == nil || err.Scope != s.scope):
+			t.Fatalf("第 %d 步 allow(%s, %s, %s) = %v，应触发 %s 级限流", i, s.channel, s.chat, s.user, err, s.scope)
+		case err != nil:
+			if !errors.Is(err, ErrRateLimited) || err.RetryAfter <= 0 || err.RetryAfter > time.Hour {
+				t.Errorf("第 %d 步 RetryAfter = %v", i, err.RetryAfter)
+			}
+		}
+	}
+}
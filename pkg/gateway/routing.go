@@ -0,0 +1,150 @@
+package gateway
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/agent"
+	"github.com/0xagentlabs/mini-agent-gateway/pkg/config"
+)
+
+// defaultProfile 未命中路由时使用的 Agent 配置名
+const defaultProfile = "default"
+
+// agentProfile 命名的 Agent 配置
+type agentProfile struct {
+	name   string
+	cfg    config.AgentConfig
+	client *agent.LLMClient // 配置了 API 地址或密钥时使用，否则为 nil
+}
+
+// router 按路由规则为消息选择 Agent 配置
+type router struct {
+	// 配置，需在 Start 之前设置
+	profiles map[string]*agentProfile
+	routes   []config.RouteConfig
+}
+
+// newRouter 创建没有任何规则的路由，所有消息使用默认配置
+func newRouter() *router {
+	return &router{profiles: make(map[string]*agentProfile)}
+}
+
+// configure 应用 Agent 配置与路由规则，base 为默认的 LLM 客户端
+func (r *router) configure(cfg *config.Config, base *agent.LLMClient) {
+	for name, ac := range cfg.Agents {
+		p := &agentProfile{name: name, cfg: ac}
+		if ac.BaseURL != "" || ac.APIKey != "" {
+			p.client = base.WithEndpoint(ac.BaseURL, ac.APIKey)
+		}
+		r.profiles[name] = p
+	}
+	r.routes = cfg.Routes
+}
+
+// route 返回消息命中的 Agent 配置名与去掉路由前缀后的正文
+//
+// 规则按顺序匹配，第一条命中的生效；都未命中时使用名为 default 的配置
+// （如果定义了），否则返回空字符串表示使用默认 Agent。
+func (r *router) route(msg Message) (string, string) {
+	for _, rc := range r.routes {
+		if rc.Channel != "" && rc.Channel != msg.Channel {
+			continue
+		}
+		if len(rc.Chats) > 0 && !contains(rc.Chats, msg.ChatID) {
+			continue
+		}
+		if len(rc.Users) > 0 && !contains(rc.Users, msg.UserID) {
+			continue
+		}
+		if rc.Prefix == "" {
+			return rc.Agent, msg.Text
+		}
+		if rest, ok := cutRoutePrefix(msg.Text, rc.Prefix); ok {
+			return rc.Agent, rest
+		}
+	}
+	if _, ok := r.profiles[defaultProfile]; ok {
+		return defaultProfile, msg.Text
+	}
+	return "", msg.Text
+}
+
+// cutRoutePrefix 不区分大小写地匹配前缀，前缀后须为空白、标点或正文结束
+func cutRoutePrefix(text, prefix string) (string, bool) {
+	text = strings.TrimSpace(text)
+	if len(text) < len(prefix) || !strings.EqualFold(text[:len(prefix)], prefix) {
+		return "", false
+	}
+	rest := text[len(prefix):]
+	if rest != "" {
+		r := []rune(rest)[0]
+		if !unicode.IsSpace(r) && !unicode.IsPunct(r) {
+			return "", false
+		}
+	}
+	return strings.TrimSpace(strings.TrimLeft(rest, ":：,，")), true
+}
+
+// profile 返回 Agent 配置，默认 Agent 返回 nil
+func (r *router) profile(name string) *agentProfile {
+	return r.profiles[name]
+}
+
+// apply 将 Agent 配置叠加到运行选项：会话中用 /model 切换的模型优先，
+// 工具与技能取角色规则与 Agent 配置的交集
+func (p *agentProfile) apply(opts *agent.RunOptions) {
+	if p == nil {
+		return
+	}
+	if p.client != nil {
+		opts.Client = p.client
+	}
+	if opts.Model == "" {
+		opts.Model = p.cfg.Model
+	}
+	opts.SystemPrompt = p.cfg.SystemPrompt
+	opts.MaxToolRounds = p.cfg.MaxToolRounds
+
+	if len(p.cfg.Tools)+len(p.cfg.DenyTools) > 0 {
+		opts.AllowTool = both(opts.AllowTool, matcher(orAll(p.cfg.Tools), p.cfg.DenyTools))
+	}
+	if len(p.cfg.Skills)+len(p.cfg.DenySkills) > 0 {
+		opts.AllowSkill = both(opts.AllowSkill, matcher(orAll(p.cfg.Skills), p.cfg.DenySkills))
+	}
+}
+
+// timeout 单次运行的时间上限，0 表示不限制
+func (p *agentProfile) timeout() time.Duration {
+	if p == nil {
+		return 0
+	}
+	return p.cfg.Timeout
+}
+
+// model Agent 配置的模型，未设置时返回 def
+func (p *agentProfile) model(def string) string {
+	if p == nil || p.cfg.Model == "" {
+		return def
+	}
+	return p.cfg.Model
+}
+
+// orAll 空的允许列表表示不限制
+func orAll(patterns []string) []string {
+	if len(patterns) == 0 {
+		return []string{"*"}
+	}
+	return patterns
+}
+
+// both 两个条件都满足，nil 表示不限制
+func both(a, b func(string) bool) func(string) bool {
+	if a == nil {
+		return b
+	}
+	return func(name string) bool {
+		return a(name) && b(name)
+	}
+}
@@ -0,0 +1,372 @@
+package gateway
+
+import (
+	"errors"
+	"sync"
+)
+
+// 默认队列参数
+const (
+	// DefaultWorkers 默认并发处理的会话数
+	DefaultWorkers = 8
+	// DefaultQueueSize 默认全局排队消息上限
+	DefaultQueueSize = 100
+	// DefaultConversationQueueSize 默认单个会话排队消息上限
+	DefaultConversationQueueSize = 10
+)
+
+// 过载策略：队列达到上限时如何处理新消息
+const (
+	// OverloadReject 拒绝新消息并回复繁忙提示
+	OverloadReject = "reject"
+	// OverloadDropOldest 丢弃同一范围内最早的待处理消息
+	OverloadDropOldest = "drop_oldest"
+	// OverloadCoalesce 将同一用户连续的待处理消息合并为一轮，仍超限时拒绝
+	OverloadCoalesce = "coalesce"
+)
+
+// ErrBusy 队列已满，消息被拒绝
+var ErrBusy = errors.New("网关繁忙，消息已被拒绝")
+
+// QueueStats 消息队列状态
+type QueueStats struct {
+	Queued        int            `json:"queued"`        // 排队等待处理的消息数
+	Running       int            `json:"running"`       // 正在处理的消息数
+	Conversations int            `json:"conversations"` // 有消息在排队或处理中的会话数
+	Workers       int            `json:"workers"`       // 工作协程数
+	Channels      map[string]int `json:"channels"`      // 各频道排队消息数
+}
+
+// queuedMessage 排队中的消息，seq 为全局到达顺序
+type queuedMessage struct {
+	msg Message
+	seq uint64
+}
+
+// scheduler 按会话键调度消息
+//
+// 同一会话的消息严格按到达顺序逐条处理，避免并发修改会话历史、回复乱序；
+// 不同会话由固定数量的工作协程并行处理，就绪会话按先进先出轮转，
+// 保证单个会话的连续消息不会饿死其他会话。
+//
+// 排队消息数受全局、频道和会话三级上限约束，enqueue 从不阻塞。
+type scheduler struct {
+	handle func(Message)
+
+	// 上限，需在 start 之前设置；0 表示不限制
+	queueSize        int
+	convQueueSize    int
+	channelQueueSize map[string]int
+
+	mu        sync.Mutex
+	cond      *sync.Cond                 // 有会话就绪或调度器关闭
+	idle      *sync.Cond                 // 队列清空且没有正在处理的消息
+	queues    map[string][]queuedMessage // 会话键 → 待处理消息
+	running   map[string]bool            // 正在处理的会话
+	ready     []string                   // 有待处理消息且未在处理中的会话（FIFO）
+	queued    int
+	byChannel map[string]int
+	seq       uint64
+	workers   int
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// newScheduler 创建调度器
+func newScheduler(handle func(Message)) *scheduler {
+	s := &scheduler{
+		handle:           handle,
+		queueSize:        DefaultQueueSize,
+		convQueueSize:    DefaultConversationQueueSize,
+		channelQueueSize: make(map[string]int),
+		queues:           make(map[string][]queuedMessage),
+		running:          make(map[string]bool),
+		byChannel:        make(map[string]int),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	s.idle = sync.NewCond(&s.mu)
+	return s
+}
+
+// start 启动 n 个工作协程
+func (s *scheduler) start(n int) {
+	if n <= 0 {
+		n = DefaultWorkers
+	}
+
+	s.mu.Lock()
+	s.workers += n
+	s.mu.Unlock()
+
+	for i := 0; i < n; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+}
+
+// enqueue 将消息加入所属会话的队列
+//
+// 返回因 drop_oldest 被丢弃的消息；按策略拒绝时返回 ErrBusy。
+func (s *scheduler) enqueue(msg Message, policy string) ([]Message, error) {
+	key := msg.SessionKey()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 只在达到上限时合并，未满的队列照常逐条排队
+	if policy == OverloadCoalesce && s.fullLocked(key, msg.Channel) != nil && s.coalesceLocked(key, msg) {
+		return nil, nil
+	}
+
+	var dropped []Message
+	for {
+		match := s.fullLocked(key, msg.Channel)
+		if match == nil {
+			break
+		}
+		if policy != OverloadDropOldest {
+			return dropped, ErrBusy
+		}
+		victim, ok := s.removeOldestLocked(match)
+		if !ok {
+			return dropped, ErrBusy
+		}
+		dropped = append(dropped, victim)
+	}
+
+	s.seq++
+	s.queues[key] = append(s.queues[key], queuedMessage{msg: msg, seq: s.seq})
+	s.queued++
+	s.byChannel[msg.Channel]++
+	if len(s.queues[key]) == 1 && !s.running[key] {
+		s.ready = append(s.ready, key)
+		s.cond.Signal()
+	}
+	return dropped, nil
+}
+
+// coalesceLocked 会话队尾是同一用户的待处理消息时，将新消息合并进去
+//
+// 编辑后的消息、内置命令、Execute 排队的运行和引用了不同消息的回复不合并，避免丢失对应关系。
+func (s *scheduler) coalesceLocked(key string, msg Message) bool {
+	q := s.queues[key]
+	if len(q) == 0 {
+		return false
+	}
+	last := &q[len(q)-1].msg
+	if last.UserID != msg.UserID || last.Channel != msg.Channel || last.Edited || msg.Edited ||
+		last.command != nil || msg.command != nil || last.task != nil || msg.task != nil || last.ReplyToID != msg.ReplyToID {
+		return false
+	}
+
+	// 以最新消息为准回复，较早的消息 ID 记入 CoalescedIDs
+	last.CoalescedIDs = append(last.CoalescedIDs, last.ID)
+	last.claims = append(last.claims, msg.claims...)
+	last.ID = msg.ID
+	last.Timestamp = msg.Timestamp
+	if last.Text != "" && msg.Text != "" {
+		last.Text += "\n"
+	}
+	last.Text += msg.Text
+	last.Attachments = append(last.Attachments, msg.Attachments...)
+	return true
+}
+
+// fullLocked 检查是否超过上限，返回超限范围内可被丢弃消息的匹配函数，未超限时返回 nil
+func (s *scheduler) fullLocked(key, channel string) func(string, Message) bool {
+	if s.convQueueSize > 0 && len(s.queues[key]) >= s.convQueueSize {
+		return func(k string, _ Message) bool { return k == key }
+	}
+	if limit := s.channelQueueSize[channel]; limit > 0 && s.byChannel[channel] >= limit {
+		return func(_ string, m Message) bool { return m.Channel == channel }
+	}
+	if s.queueSize > 0 && s.queued >= s.queueSize {
+		return func(string, Message) bool { return true }
+	}
+	return nil
+}
+
+// removeOldestLocked 移除满足条件的最早一条待处理消息
+func (s *scheduler) removeOldestLocked(match func(string, Message) bool) (Message, bool) {
+	var oldestKey string
+	oldestIdx := -1
+	var oldestSeq uint64
+	for key, q := range s.queues {
+		for i, qm := range q {
+			if match(key, qm.msg) && (oldestIdx < 0 || qm.seq < oldestSeq) {
+				oldestKey, oldestIdx, oldestSeq = key, i, qm.seq
+			}
+		}
+	}
+	if oldestIdx < 0 {
+		return Message{}, false
+	}
+
+	q := s.queues[oldestKey]
+	victim := q[oldestIdx].msg
+	s.queues[oldestKey] = append(q[:oldestIdx:oldestIdx], q[oldestIdx+1:]...)
+	s.queued--
+	s.byChannel[victim.Channel]--
+
+	// 队列清空且未在处理中的会话移出就绪列表
+	if len(s.queues[oldestKey]) == 0 && !s.running[oldestKey] {
+		delete(s.queues, oldestKey)
+		for i, k := range s.ready {
+			if k == oldestKey {
+				s.ready = append(s.ready[:i], s.ready[i+1:]...)
+				break
+			}
+		}
+	}
+	return victim, true
+}
+
+// dropSession 移除会话所有待处理的消息，不影响正在处理的消息
+func (s *scheduler) dropSession(key string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := s.queues[key]
+	if len(q) == 0 {
+		return nil
+	}
+
+	dropped := make([]Message, 0, len(q))
+	for _, qm := range q {
+		dropped = append(dropped, qm.msg)
+		s.queued--
+		s.byChannel[qm.msg.Channel]--
+	}
+
+	if s.running[key] {
+		// 处理中的会话保留空队列，完成后由工作协程清理
+		s.queues[key] = q[:0]
+	} else {
+		delete(s.queues, key)
+		for i, k := range s.ready {
+			if k == key {
+				s.ready = append(s.ready[:i], s.ready[i+1:]...)
+				break
+			}
+		}
+	}
+	if s.queued == 0 && len(s.running) == 0 {
+		s.idle.Broadcast()
+	}
+	return dropped
+}
+
+// editQueued 用编辑后的内容替换仍在排队的消息，消息不在队列中时返回 false
+func (s *scheduler) editQueued(msg Message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, q := range s.queues {
+		for i := range q {
+			m := &q[i].msg
+			if m.Channel == msg.Channel && m.ChatID == msg.ChatID && m.ID == msg.ID {
+				m.Text = msg.Text
+				m.Attachments = msg.Attachments
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dropMessage 移除仍在排队的消息，消息不在队列中时返回 false
+func (s *scheduler) dropMessage(channel, chatID, id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.removeOldestLocked(func(_ string, m Message) bool {
+		return m.Channel == channel && m.ChatID == chatID && m.ID == id
+	})
+	if ok && s.queued == 0 && len(s.running) == 0 {
+		s.idle.Broadcast()
+	}
+	return ok
+}
+
+// work 工作协程：取出就绪会话的下一条消息并处理
+func (s *scheduler) work() {
+	defer s.wg.Done()
+
+	for {
+		s.mu.Lock()
+		for len(s.ready) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if len(s.ready) == 0 {
+			s.mu.Unlock()
+			return
+		}
+
+		key := s.ready[0]
+		s.ready = s.ready[1:]
+		msg := s.queues[key][0].msg
+		s.queues[key] = s.queues[key][1:]
+		s.queued--
+		s.byChannel[msg.Channel]--
+		s.running[key] = true
+		s.mu.Unlock()
+
+		s.handle(msg)
+
+		s.mu.Lock()
+		delete(s.running, key)
+		if len(s.queues[key]) > 0 {
+			// 重新排到队尾，让其他会话有机会先执行
+			s.ready = append(s.ready, key)
+			s.cond.Signal()
+		} else {
+			delete(s.queues, key)
+		}
+		if s.queued == 0 && len(s.running) == 0 {
+			s.idle.Broadcast()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// wait 阻塞直到队列清空且没有正在处理的消息
+func (s *scheduler) wait() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for s.queued > 0 || len(s.running) > 0 {
+		s.idle.Wait()
+	}
+}
+
+// close 停止工作协程，调用前应先通过 wait 排空队列
+func (s *scheduler) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// stats 返回队列状态
+func (s *scheduler) stats() QueueStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	channels := make(map[string]int)
+	for name, n := range s.byChannel {
+		if n > 0 {
+			channels[name] = n
+		}
+	}
+
+	// 处理中的会话在完成前保留队列项
+	return QueueStats{
+		Queued:        s.queued,
+		Running:       len(s.running),
+		Conversations: len(s.queues),
+		Workers:       s.workers,
+		Channels:      channels,
+	}
+}
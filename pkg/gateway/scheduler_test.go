@@ -0,0 +1,201 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSchedulerEnqueue(t *testing.T) {
+	msg := func(id, user, text string) Message {
+		return Message{ID: id, Channel: "telegram", ChatID: "c1", UserID: user, IsGroup: true, SharedContext: true, Text: text}
+	}
+	tests := []struct {
+		name      string
+		policy    string
+		msgs      []Message
+		wantErr   []bool     // 每条消息入队是否返回 ErrBusy
+		wantQueue []string   // 入队后会话队列中的消息 ID
+		wantText  string     // 队尾消息的正文
+		dropped   [][]string // 每条消息入队时被丢弃的消息 ID
+	}{
+		{
+			name:      "reject 未满时逐条排队",
+			policy:    OverloadReject,
+			msgs:      []Message{msg("1", "u1", "a"), msg("2", "u1", "b")},
+			wantErr:   []bool{false, false},
+			wantQueue: []string{"1", "2"},
+			wantText:  "b",
+		},
+		{
+			name:      "reject 已满时拒绝",
+			policy:    OverloadReject,
+			msgs:      []Message{msg("1", "u1", "a"), msg("2", "u1", "b"), msg("3", "u1", "c")},
+			wantErr:   []bool{false, false, true},
+			wantQueue: []string{"1", "2"},
+			wantText:  "b",
+		},
+		{
+			name:      "drop_oldest 丢弃最早的消息",
+			policy:    OverloadDropOldest,
+			msgs:      []Message{msg("1", "u1", "a"), msg("2", "u2", "b"), msg("3", "u1", "c")},
+			wantErr:   []bool{false, false, false},
+			wantQueue: []string{"2", "3"},
+			wantText:  "c",
+			dropped:   [][]string{nil, nil, {"1"}},
+		},
+		{
+			name:      "coalesce 未满时不合并",
+			policy:    OverloadCoalesce,
+			msgs:      []Message{msg("1", "u1", "a"), msg("2", "u1", "b")},
+			wantErr:   []bool{false, false},
+			wantQueue: []string{"1", "2"},
+			wantText:  "b",
+		},
+		{
+			name:      "coalesce 已满时合并同一用户的连续消息",
+			policy:    OverloadCoalesce,
+			msgs:      []Message{msg("1", "u1", "a"), msg("2", "u1", "b"), msg("3", "u1", "c"), msg("4", "u1", "d")},
+			wantErr:   []bool{false, false, false, false},
+			wantQueue: []string{"1", "4"},
+			wantText:  "b\nc\nd",
+		},
+		{
+			name:      "coalesce 队尾是其他用户时拒绝",
+			policy:    OverloadCoalesce,
+			msgs:      []Message{msg("1", "u1", "a"), msg("2", "u2", "b"), msg("3", "u1", "c")},
+			wantErr:   []bool{false, false, true},
+			wantQueue: []string{"1", "2"},
+			wantText:  "b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newScheduler(func(Message) {})
+			s.convQueueSize = 2
+			for i, m := range tt.msgs {
+				dropped, err := s.enqueue(m, tt.policy)
+				if errors.Is(err, ErrBusy) != tt.wantErr[i] {
+					t.Fatalf("enqueue(%s) error = %v", m.ID, err)
+				}
+				var ids []string
+				for _, d := range dropped {
+					ids = append(ids, d.ID)
+				}
+				if tt.dropped != nil && !reflect.DeepEqual(ids, tt.dropped[i]) {
+					t.Errorf("enqueue(%s) dropped = %v, want %v", m.ID, ids, tt.dropped[i])
+				}
+			}
+
+			q := s.queues["telegram:c1"]
+			var ids []string
+			for _, qm := range q {
+				ids = append(ids, qm.msg.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantQueue) {
+				t.Errorf("queue = %v, want %v", ids, tt.wantQueue)
+			}
+			if last := q[len(q)-1].msg; last.Text != tt.wantText {
+				t.Errorf("last.Text = %q, want %q", last.Text, tt.wantText)
+			}
+			if s.queued != len(tt.wantQueue) {
+				t.Errorf("queued = %d, want %d", s.queued, len(tt.wantQueue))
+			}
+		})
+	}
+}
+
+func TestSchedulerQueueLimits(t *testing.T) {
+	s := newScheduler(func(Message) {})
+	s.convQueueSize = 0
+	s.queueSize = 3
+	s.channelQueueSize["slack"] = 1
+
+	enqueue := func(channel, user string) error {
+		_, err := s.enqueue(Message{ID: user, Channel: channel, UserID: user}, OverloadReject)
+		return err
+	}
+	if err := enqueue("slack", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := enqueue("slack", "b"); !errors.Is(err, ErrBusy) {
+		t.Fatalf("频道上限: error = %v", err)
+	}
+	for _, user := range []string{"c", "d"} {
+		if err := enqueue("telegram", user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enqueue("telegram", "e"); !errors.Is(err, ErrBusy) {
+		t.Fatalf("全局上限: error = %v", err)
+	}
+	if st := s.stats(); st.Queued != 3 || st.Channels["slack"] != 1 || st.Channels["telegram"] != 2 {
+		t.Errorf("stats() = %+v", st)
+	}
+}
+
+func TestSchedulerOrdering(t *testing.T) {
+	const workers, sessions, perSession = 2, 4, 5
+
+	var (
+		mu       sync.Mutex
+		order    = make(map[string][]string) // 会话 → 处理顺序
+		running  = make(map[string]bool)
+		active   int
+		peak     int
+		parallel bool // 同一会话的消息被并行处理
+	)
+	s := newScheduler(func(msg Message) {
+		key := msg.SessionKey()
+		mu.Lock()
+		if running[key] {
+			parallel = true
+		}
+		running[key] = true
+		if active++; active > peak {
+			peak = active
+		}
+		mu.Unlock()
+
+		time.Sleep(2 * time.Millisecond)
+
+		mu.Lock()
+		order[key] = append(order[key], msg.ID)
+		running[key] = false
+		active--
+		mu.Unlock()
+	})
+	s.start(workers)
+	defer s.close()
+
+	for i := 0; i < perSession; i++ {
+		for u := 0; u < sessions; u++ {
+			msg := Message{ID: fmt.Sprint(i), Channel: "test", UserID: fmt.Sprint("u", u)}
+			if _, err := s.enqueue(msg, OverloadReject); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	s.wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if parallel {
+		t.Error("同一会话的消息被并行处理")
+	}
+	if peak > workers {
+		t.Errorf("最多 %d 条消息同时处理，超过工作协程数 %d", peak, workers)
+	}
+	want := []string{"0", "1", "2", "3", "4"}
+	for key, got := range order {
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("会话 %s 的处理顺序 %v，期望 %v", key, got, want)
+		}
+	}
+	if len(order) != sessions {
+		t.Errorf("处理了 %d 个会话，期望 %d", len(order), sessions)
+	}
+}
@@ -0,0 +1,89 @@
+package gateway
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	minRestartDelay = time.Second
+	maxRestartDelay = time.Minute
+)
+
+// StartChannels 在后台启动所有已注册的频道适配器
+//
+// 每个适配器由独立的 goroutine 监管：Start 返回错误或 panic 时按指数退避重启，
+// 单个适配器失败（如鉴权失败）不会影响其他适配器和消息处理循环。
+func (g *Gateway) StartChannels() {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	for _, ch := range g.channels {
+		g.wg.Add(1)
+		go g.supervise(ch)
+	}
+}
+
+// StopChannels 停止所有频道适配器并等待监管 goroutine 退出
+func (g *Gateway) StopChannels() {
+	g.stopOnce.Do(func() { close(g.stopCh) })
+
+	g.mu.RLock()
+	for _, ch := range g.channels {
+		ch.Stop()
+	}
+	g.mu.RUnlock()
+
+	g.wg.Wait()
+}
+
+// supervise 运行并监管单个频道适配器
+func (g *Gateway) supervise(ch Channel) {
+	defer g.wg.Done()
+
+	delay := minRestartDelay
+	for {
+		started := time.Now()
+		err := runChannel(ch)
+
+		select {
+		case <-g.stopCh:
+			return
+		default:
+		}
+
+		if err != nil {
+			log.Printf("[%s] 频道异常退出: %v", ch.Name(), err)
+		} else {
+			log.Printf("[%s] 频道意外停止", ch.Name())
+		}
+
+		// 稳定运行一段时间后重置退避
+		if time.Since(started) > maxRestartDelay {
+			delay = minRestartDelay
+		}
+
+		log.Printf("[%s] %v 后重启", ch.Name(), delay)
+		select {
+		case <-g.stopCh:
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+	}
+}
+
+// runChannel 运行适配器，将 panic 转换为错误
+func runChannel(ch Channel) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return ch.Start()
+}
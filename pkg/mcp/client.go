@@ -218,12 +218,26 @@ func (c *Client) call(ctx context.Context, method string, params interface{}) (*
 		}
 		return resp, nil
 	case <-ctx.Done():
+		c.cancel(id, ctx.Err().Error())
 		return nil, ctx.Err()
 	case <-time.After(30 * time.Second):
+		c.cancel(id, "request timeout")
 		return nil, fmt.Errorf("request timeout")
 	}
 }
 
+// cancel 放弃等待请求，并通知服务器停止处理
+func (c *Client) cancel(id int, reason string) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+
+	c.notify("notifications/cancelled", map[string]interface{}{
+		"requestId": id,
+		"reason":    reason,
+	})
+}
+
 // notify 发送通知（无响应）
 func (c *Client) notify(method string, params interface{}) error {
 	req := JSONRPCRequest{
@@ -265,12 +279,30 @@ func (c *Client) readResponses() {
 	}
 }
 
+// closeTimeout 关闭 stdin 后等待子进程自行退出的时间
+const closeTimeout = 3 * time.Second
+
 // Close 关闭 MCP 连接
+//
+// 先关闭 stdin 让服务器自行退出，超时后强制结束子进程。
 func (c *Client) Close() error {
-	if c.cmd != nil && c.cmd.Process != nil {
-		return c.cmd.Process.Kill()
+	if c.cmd == nil || c.cmd.Process == nil {
+		return nil
+	}
+
+	c.stdin.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- c.cmd.Wait() }()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(closeTimeout):
+		c.cmd.Process.Kill()
+		<-done
+		return nil
 	}
-	return nil
 }
 
 // GetTools 获取缓存的工具列表
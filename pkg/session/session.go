@@ -10,6 +10,10 @@ type Session struct {
 	UserID   string
 	Messages []Message
 	LastAt   time.Time
+
+	mu    sync.Mutex
+	model string   // 会话级模型覆盖，为空时使用默认模型
+	mgr   *Manager // 所属的管理器，维护轮次索引
 }
 
 // Message 会话中的消息
@@ -17,11 +21,13 @@ type Message struct {
 	Role      string    // user / assistant / system
 	Content   string
 	Timestamp time.Time
+	TurnID    string // 所属轮次（触发该轮的入站消息），用于编辑和删除，可为空
 }
 
 // Manager 会话管理器
 type Manager struct {
 	sessions map[string]*Session
+	turns    map[string]*Session // 轮次 ID → 所在会话，编辑和删除时直接定位
 	mu       sync.RWMutex
 	maxMsgs  int // 保留的最大消息数
 }
@@ -30,6 +36,7 @@ type Manager struct {
 func NewManager() *Manager {
 	return &Manager{
 		sessions: make(map[string]*Session),
+		turns:    make(map[string]*Session),
 		maxMsgs:  20, // 保留最近 20 条消息
 	}
 }
@@ -48,24 +55,167 @@ func (m *Manager) GetOrCreate(userID string) *Session {
 		UserID:   userID,
 		Messages: make([]Message, 0),
 		LastAt:   time.Now(),
+		mgr:      m,
 	}
 	m.sessions[userID] = sess
 	return sess
 }
 
+// Get 获取已存在的会话，不存在时返回 nil
+func (m *Manager) Get(userID string) *Session {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.sessions[userID]
+}
+
 // AddMessage 添加消息到会话
 func (s *Session) AddMessage(role, content string) {
+	s.AddTurnMessage(role, content, "")
+}
+
+// AddTurnMessage 添加属于某一轮的消息，入站消息被编辑或删除时按 turnID 定位
+func (s *Session) AddTurnMessage(role, content, turnID string) {
 	msg := Message{
 		Role:      role,
 		Content:   content,
 		Timestamp: time.Now(),
+		TurnID:    turnID,
 	}
+
+	s.mu.Lock()
 	s.Messages = append(s.Messages, msg)
 
 	// 限制历史长度
+	var dropped []string
 	if len(s.Messages) > 20 {
+		for _, m := range s.Messages[:len(s.Messages)-20] {
+			dropped = append(dropped, m.TurnID)
+		}
 		s.Messages = s.Messages[len(s.Messages)-20:]
 	}
+	dropped = s.goneLocked(dropped)
+	s.mu.Unlock()
+
+	if turnID != "" {
+		s.mgr.track(turnID, s)
+	}
+	s.mgr.untrack(dropped, s)
+}
+
+// goneLocked 过滤出会话中已不存在的轮次
+func (s *Session) goneLocked(turnIDs []string) []string {
+	gone := turnIDs[:0]
+	for _, id := range turnIDs {
+		if id != "" && !s.hasTurnLocked(id) {
+			gone = append(gone, id)
+		}
+	}
+	return gone
+}
+
+// HasTurn 会话中是否有该轮的消息
+func (s *Session) HasTurn(turnID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.hasTurnLocked(turnID)
+}
+
+// hasTurnLocked 需持有 s.mu
+func (s *Session) hasTurnLocked(turnID string) bool {
+	for _, m := range s.Messages {
+		if m.TurnID == turnID {
+			return true
+		}
+	}
+	return false
+}
+
+// EditTurn 替换该轮用户消息的内容
+//
+// 返回是否找到该轮，以及它是否为会话中的最后一轮（之后没有其他轮次的消息）。
+func (s *Session) EditTurn(turnID, content string) (found, last bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last = true
+	for i := range s.Messages {
+		m := &s.Messages[i]
+		switch {
+		case m.TurnID == turnID && m.Role == "user":
+			m.Content = content
+			found = true
+		case found && m.TurnID != turnID:
+			last = false
+		}
+	}
+	return found, found && last
+}
+
+// RemoveReplies 删除该轮中除用户消息以外的消息（助手回复），返回删除的条数
+func (s *Session) RemoveReplies(turnID string) int {
+	return s.removeTurn(turnID, false)
+}
+
+// RemoveTurn 删除该轮的全部消息，返回删除的条数
+func (s *Session) RemoveTurn(turnID string) int {
+	return s.removeTurn(turnID, true)
+}
+
+// removeTurn 删除该轮的消息，withUser 为 false 时保留用户消息
+func (s *Session) removeTurn(turnID string, withUser bool) int {
+	if turnID == "" {
+		return 0
+	}
+
+	s.mu.Lock()
+	kept := s.Messages[:0]
+	for _, m := range s.Messages {
+		if m.TurnID == turnID && (withUser || m.Role != "user") {
+			continue
+		}
+		kept = append(kept, m)
+	}
+	removed := len(s.Messages) - len(kept)
+	s.Messages = kept
+	gone := s.goneLocked([]string{turnID})
+	s.mu.Unlock()
+
+	s.mgr.untrack(gone, s)
+	return removed
+}
+
+// Clear 清空会话历史与模型覆盖
+func (s *Session) Clear() {
+	s.mu.Lock()
+	var turns []string
+	for _, m := range s.Messages {
+		if m.TurnID != "" {
+			turns = append(turns, m.TurnID)
+		}
+	}
+	s.Messages = s.Messages[:0]
+	s.model = ""
+	s.mu.Unlock()
+
+	s.mgr.untrack(turns, s)
+}
+
+// Model 返回会话级模型覆盖
+func (s *Session) Model() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.model
+}
+
+// SetModel 设置会话级模型覆盖，传空字符串恢复默认模型
+func (s *Session) SetModel(model string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.model = model
 }
 
 // GetMessages 获取所有消息（用于 Agent）
@@ -77,6 +227,9 @@ type MessageForAgent struct {
 
 // GetMessages 获取所有消息（用于 Agent）
 func (s *Session) GetMessages() []MessageForAgent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	result := make([]MessageForAgent, 0, len(s.Messages))
 
 	for _, m := range s.Messages {
@@ -88,15 +241,62 @@ func (s *Session) GetMessages() []MessageForAgent {
 	return result
 }
 
+// FindTurn 返回包含该轮消息的会话，找不到时返回 nil
+func (m *Manager) FindTurn(turnID string) *Session {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if sess := m.turns[turnID]; sess != nil && sess.HasTurn(turnID) {
+		return sess
+	}
+	return nil
+}
+
+// track 记录轮次所在的会话
+func (m *Manager) track(turnID string, sess *Session) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.turns[turnID] = sess
+}
+
+// untrack 删除已不在会话中的轮次索引，轮次已被其他会话记录时保留
+func (m *Manager) untrack(turnIDs []string, sess *Session) {
+	if m == nil || len(turnIDs) == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range turnIDs {
+		if m.turns[id] == sess {
+			delete(m.turns, id)
+		}
+	}
+}
+
 // CleanupOldSessions 清理过期会话（可选）
 func (m *Manager) CleanupOldSessions(maxAge time.Duration) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	now := time.Now()
+	expired := make(map[*Session]bool)
 	for id, sess := range m.sessions {
 		if now.Sub(sess.LastAt) > maxAge {
 			delete(m.sessions, id)
+			expired[sess] = true
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+	for id, sess := range m.turns {
+		if expired[sess] {
+			delete(m.turns, id)
 		}
 	}
 }
@@ -0,0 +1,59 @@
+package session
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFindTurn(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps func(m *Manager)
+		want  string // 找到的会话，空表示找不到
+	}{
+		{"按索引找到会话", func(m *Manager) {
+			m.GetOrCreate("a").AddTurnMessage("user", "hi", "t1")
+			m.GetOrCreate("b").AddTurnMessage("user", "hi", "t2")
+		}, "a"},
+		{"删除整轮后找不到", func(m *Manager) {
+			sess := m.GetOrCreate("a")
+			sess.AddTurnMessage("user", "hi", "t1")
+			sess.AddTurnMessage("assistant", "hello", "t1")
+			sess.RemoveTurn("t1")
+		}, ""},
+		{"只删除回复仍能找到", func(m *Manager) {
+			sess := m.GetOrCreate("a")
+			sess.AddTurnMessage("user", "hi", "t1")
+			sess.AddTurnMessage("assistant", "hello", "t1")
+			sess.RemoveReplies("t1")
+		}, "a"},
+		{"清空会话后找不到", func(m *Manager) {
+			sess := m.GetOrCreate("a")
+			sess.AddTurnMessage("user", "hi", "t1")
+			sess.Clear()
+		}, ""},
+		{"超出历史长度后找不到", func(m *Manager) {
+			sess := m.GetOrCreate("a")
+			sess.AddTurnMessage("user", "hi", "t1")
+			for i := 0; i < 20; i++ {
+				sess.AddTurnMessage("user", "more", fmt.Sprintf("n%d", i))
+			}
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager()
+			tt.steps(m)
+			got := ""
+			if sess := m.FindTurn("t1"); sess != nil {
+				got = sess.UserID
+			}
+			if got != tt.want {
+				t.Errorf("FindTurn() = %q, want %q", got, tt.want)
+			}
+			if tt.want == "" && m.turns["t1"] != nil {
+				t.Error("已不存在的轮次仍在索引中")
+			}
+		})
+	}
+}
@@ -257,7 +257,17 @@ func (r *Registry) GetUserInvokable() []*Skill {
 
 // BuildSystemPrompt 构建系统 prompt 中的技能部分
 func (r *Registry) BuildSystemPrompt() string {
-	skills := r.GetAutoInvokable()
+	return r.BuildSystemPromptFor(nil)
+}
+
+// BuildSystemPromptFor 构建系统 prompt 中的技能部分，只包含 allow 允许的技能（nil 表示不过滤）
+func (r *Registry) BuildSystemPromptFor(allow func(name string) bool) string {
+	var skills []*Skill
+	for _, s := range r.GetAutoInvokable() {
+		if allow == nil || allow(s.Name) {
+			skills = append(skills, s)
+		}
+	}
 	if len(skills) == 0 {
 		return ""
 	}
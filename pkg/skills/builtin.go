@@ -1,6 +1,7 @@
 package skills
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -11,7 +12,7 @@ import (
 // BuiltinHandlers 内置工具处理函数映射
 var BuiltinHandlers = map[string]ToolHandler{
 	// fs:read - 读取文件
-	"fs:read": func(args string) (string, error) {
+	"fs:read": func(ctx context.Context, args string) (string, error) {
 		var params struct{ Path string `json:"path"` }
 		if err := json.Unmarshal([]byte(args), &params); err != nil {
 			return "", err
@@ -24,7 +25,7 @@ var BuiltinHandlers = map[string]ToolHandler{
 	},
 	
 	// fs:write - 写入文件
-	"fs:write": func(args string) (string, error) {
+	"fs:write": func(ctx context.Context, args string) (string, error) {
 		var params struct {
 			Path    string `json:"path"`
 			Content string `json:"content"`
@@ -39,7 +40,7 @@ var BuiltinHandlers = map[string]ToolHandler{
 	},
 	
 	// fs:exec - 执行命令
-	"fs:exec": func(args string) (string, error) {
+	"fs:exec": func(ctx context.Context, args string) (string, error) {
 		var params struct{ Command string `json:"command"` }
 		if err := json.Unmarshal([]byte(args), &params); err != nil {
 			return "", err
@@ -50,7 +51,7 @@ var BuiltinHandlers = map[string]ToolHandler{
 			return "", fmt.Errorf("命令不安全或被禁止")
 		}
 		
-		cmd := exec.Command("sh", "-c", params.Command)
+		cmd := exec.CommandContext(ctx, "sh", "-c", params.Command)
 		output, err := cmd.CombinedOutput()
 		if err != nil {
 			return fmt.Sprintf("错误: %v\n输出: %s", err, string(output)), nil
@@ -59,7 +60,7 @@ var BuiltinHandlers = map[string]ToolHandler{
 	},
 	
 	// fs:list - 列出目录
-	"fs:list": func(args string) (string, error) {
+	"fs:list": func(ctx context.Context, args string) (string, error) {
 		var params struct{ Path string `json:"path"` }
 		if err := json.Unmarshal([]byte(args), &params); err != nil {
 			return "", err
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/0xagentlabs/mini-agent-gateway/pkg/mcp"
 )
@@ -26,10 +27,11 @@ type ToolDefinition struct {
 	Description string                 `json:"description"`
 	Parameters  map[string]interface{} `json:"parameters"`
 	Handler     ToolHandler            `json:"-"` // 内置函数（非 MCP）
+	Risk        string                 `json:"risk,omitempty"` // 风险等级：low（默认）/ high，高风险需用户审批
 }
 
-// ToolHandler 工具处理函数
-type ToolHandler func(args string) (string, error)
+// ToolHandler 工具处理函数，ctx 取消时应尽快返回
+type ToolHandler func(ctx context.Context, args string) (string, error)
 
 // MCPConfig MCP 服务器配置
 type MCPConfig struct {
@@ -178,11 +180,38 @@ func (r *Registry) GetToolDefinitions() []map[string]interface{} {
 	return defs
 }
 
+// builtinRisk 内置处理函数的风险等级，未列出的视为 low
+var builtinRisk = map[string]string{
+	"fs:write": "high",
+	"fs:exec":  "high",
+}
+
+// Risk 工具的风险等级（fullName 为 "skill:tool"）
+//
+// 内置处理函数优先于同名的技能工具执行，按 builtinRisk 判断；技能工具未标注时视为 low；
+// 模型可能调用未注册的工具名，一律视为 high，不能借此绕过审批。
+func (r *Registry) Risk(fullName string) string {
+	if _, ok := BuiltinHandlers[fullName]; ok {
+		if risk, ok := builtinRisk[fullName]; ok {
+			return risk
+		}
+		return "low"
+	}
+	tool, ok := r.tools[fullName]
+	if !ok {
+		return "high"
+	}
+	if tool.Risk != "" {
+		return tool.Risk
+	}
+	return "low"
+}
+
 // Execute 执行工具
-func (r *Registry) Execute(fullName string, args string) (string, error) {
+func (r *Registry) Execute(ctx context.Context, fullName string, args string) (string, error) {
 	// 首先检查内置 handler
 	if handler, ok := BuiltinHandlers[fullName]; ok {
-		return handler(args)
+		return handler(ctx, args)
 	}
 	
 	tool, ok := r.tools[fullName]
@@ -208,12 +237,12 @@ func (r *Registry) Execute(fullName string, args string) (string, error) {
 		if err := json.Unmarshal([]byte(args), &argsMap); err != nil {
 			return "", fmt.Errorf("解析参数: %w", err)
 		}
-		return skill.mcpClient.CallTool(context.Background(), tool.Name, argsMap)
+		return skill.mcpClient.CallTool(ctx, tool.Name, argsMap)
 	}
 	
 	// 内置技能
 	if tool.Handler != nil {
-		return tool.Handler(args)
+		return tool.Handler(ctx, args)
 	}
 	
 	return "", fmt.Errorf("工具未实现: %s", fullName)
@@ -230,11 +259,18 @@ func splitSkillTool(fullName string) []string {
 	return []string{fullName}
 }
 
-// Close 关闭所有 MCP 连接
+// Close 并行关闭所有 MCP 连接，等待子进程退出
 func (r *Registry) Close() {
+	var wg sync.WaitGroup
 	for _, skill := range r.skills {
-		if skill.mcpClient != nil {
-			skill.mcpClient.Close()
+		if skill.mcpClient == nil {
+			continue
 		}
+		wg.Add(1)
+		go func(c *mcp.Client) {
+			defer wg.Done()
+			c.Close()
+		}(skill.mcpClient)
 	}
+	wg.Wait()
 }
@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,8 +13,20 @@ import (
 	"time"
 )
 
-// Handler 工具处理函数类型
-type Handler func(args string) (string, error)
+// SendFileTool 随回复发送文件的工具名，Agent 据此通知网关附加文件
+const SendFileTool = "send_file"
+
+// maxSendFileSize 可随回复发送的文件大小上限
+const maxSendFileSize = 20 << 20
+
+// 工具风险等级：高风险工具执行前需要用户审批
+const (
+	RiskLow  = "low"
+	RiskHigh = "high"
+)
+
+// Handler 工具处理函数类型，ctx 取消时应尽快返回
+type Handler func(ctx context.Context, args string) (string, error)
 
 // Tool 工具定义
 type Tool struct {
@@ -21,6 +34,7 @@ type Tool struct {
 	Description string
 	Parameters  map[string]interface{}
 	Handler     Handler
+	Risk        string // 风险等级，为空视为 RiskLow
 }
 
 // ToolDefinition LLM 工具定义 (OpenAI 格式)
@@ -66,7 +80,7 @@ func (r *Registry) registerDefaults() {
 			},
 			"required": []string{"path"},
 		},
-		Handler: func(args string) (string, error) {
+		Handler: func(ctx context.Context, args string) (string, error) {
 			var params struct{ Path string `json:"path"` }
 			if err := json.Unmarshal([]byte(args), &params); err != nil {
 				return "", err
@@ -97,7 +111,8 @@ func (r *Registry) registerDefaults() {
 			},
 			"required": []string{"path", "content"},
 		},
-		Handler: func(args string) (string, error) {
+		Risk: RiskHigh,
+		Handler: func(ctx context.Context, args string) (string, error) {
 			var params struct {
 				Path    string `json:"path"`
 				Content string `json:"content"`
@@ -112,6 +127,39 @@ func (r *Registry) registerDefaults() {
 		},
 	})
 
+	// 发送文件
+	r.Register(Tool{
+		Name:        SendFileTool,
+		Description: "将本地文件（如生成的图片、报告）作为附件随回复发送给用户",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]string{
+					"type":        "string",
+					"description": "文件路径",
+				},
+			},
+			"required": []string{"path"},
+		},
+		Handler: func(ctx context.Context, args string) (string, error) {
+			var params struct{ Path string `json:"path"` }
+			if err := json.Unmarshal([]byte(args), &params); err != nil {
+				return "", err
+			}
+			info, err := os.Stat(params.Path)
+			if err != nil {
+				return "", err
+			}
+			if info.IsDir() {
+				return "", fmt.Errorf("%s 是目录", params.Path)
+			}
+			if info.Size() > maxSendFileSize {
+				return "", fmt.Errorf("文件过大: %d 字节，上限 %d 字节", info.Size(), maxSendFileSize)
+			}
+			return fmt.Sprintf("文件将随回复发送: %s", params.Path), nil
+		},
+	})
+
 	// 执行 Shell
 	r.Register(Tool{
 		Name:        "exec_shell",
@@ -126,7 +174,8 @@ func (r *Registry) registerDefaults() {
 			},
 			"required": []string{"command"},
 		},
-		Handler: func(args string) (string, error) {
+		Risk: RiskHigh,
+		Handler: func(ctx context.Context, args string) (string, error) {
 			var params struct{ Command string `json:"command"` }
 			if err := json.Unmarshal([]byte(args), &params); err != nil {
 				return "", err
@@ -135,7 +184,7 @@ func (r *Registry) registerDefaults() {
 			if !isSafeCommand(params.Command) {
 				return "", fmt.Errorf("命令不安全或被禁止")
 			}
-			cmd := exec.Command("sh", "-c", params.Command)
+			cmd := exec.CommandContext(ctx, "sh", "-c", params.Command)
 			output, err := cmd.CombinedOutput()
 			if err != nil {
 				return fmt.Sprintf("错误: %v\n输出: %s", err, string(output)), nil
@@ -158,12 +207,12 @@ func (r *Registry) registerDefaults() {
 			},
 			"required": []string{"query"},
 		},
-		Handler: func(args string) (string, error) {
+		Handler: func(ctx context.Context, args string) (string, error) {
 			var params struct{ Query string `json:"query"` }
 			if err := json.Unmarshal([]byte(args), &params); err != nil {
 				return "", err
 			}
-			return duckduckgoSearch(params.Query)
+			return duckduckgoSearch(ctx, params.Query)
 		},
 	})
 }
@@ -193,26 +242,38 @@ func (r *Registry) GetDefinitions() []ToolDefinition {
 func (r *Registry) GetToolDefinitions() []map[string]interface{} {
 	defs := make([]map[string]interface{}, 0, len(r.tools))
 	for _, tool := range r.tools {
-		def := map[string]interface{}{
-			"type": "function",
-			"function": map[string]interface{}{
-				"name":        tool.Name,
-				"description": tool.Description,
-				"parameters":  tool.Parameters,
-			},
-		}
-		defs = append(defs, def)
+		defs = append(defs, tool.Definition())
 	}
 	return defs
 }
 
+// Definition 工具定义（map 格式，用于 LLM）
+func (t Tool) Definition() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        t.Name,
+			"description": t.Description,
+			"parameters":  t.Parameters,
+		},
+	}
+}
+
+// Risk 工具的风险等级，未知工具视为 RiskLow
+func (r *Registry) Risk(name string) string {
+	if tool, ok := r.tools[name]; ok && tool.Risk != "" {
+		return tool.Risk
+	}
+	return RiskLow
+}
+
 // Execute 执行工具
-func (r *Registry) Execute(name string, args string) (string, error) {
+func (r *Registry) Execute(ctx context.Context, name string, args string) (string, error) {
 	tool, ok := r.tools[name]
 	if !ok {
 		return "", fmt.Errorf("未知工具: %s", name)
 	}
-	return tool.Handler(args)
+	return tool.Handler(ctx, args)
 }
 
 // isSafeCommand 检查命令安全性
@@ -228,12 +289,17 @@ func isSafeCommand(cmd string) bool {
 }
 
 // duckduckgoSearch DuckDuckGo 搜索
-func duckduckgoSearch(query string) (string, error) {
+func duckduckgoSearch(ctx context.Context, query string) (string, error) {
 	// 使用 DuckDuckGo HTML 版本
 	searchURL := fmt.Sprintf("https://html.duckduckgo.com/html/?q=%s", url.QueryEscape(query))
 
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, searchURL, nil)
+	if err != nil {
+		return "", err
+	}
+
 	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Get(searchURL)
+	resp, err := client.Do(req)
 	if err != nil {
 		return "", err
 	}